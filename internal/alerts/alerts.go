@@ -0,0 +1,524 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/logger"
+	"cod/internal/metrics"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// Alert states
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Alert is the state of one rule for one cluster
+type Alert struct {
+	Key            string     `json:"key"` // rule/cluster, the deduplication key
+	Rule           string     `json:"rule"`
+	Cluster        string     `json:"cluster"`
+	Severity       string     `json:"severity"`
+	State          string     `json:"state"`
+	Summary        string     `json:"summary"`
+	Value          float64    `json:"value"`
+	ActiveSince    time.Time  `json:"activeSince"`
+	FiringSince    *time.Time `json:"firingSince,omitempty"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+	LastNotifiedAt *time.Time `json:"lastNotifiedAt,omitempty"`
+	Silenced       bool       `json:"silenced"`
+	SilencedBy     string     `json:"silencedBy,omitempty"` // ID of the matching silence
+}
+
+// Silence suppresses notifications for alerts matching its rule and cluster until EndsAt.
+// An empty rule or cluster matches any.
+type Silence struct {
+	ID        string    `json:"id"`
+	Rule      string    `json:"rule,omitempty"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	EndsAt    time.Time `json:"endsAt"`
+}
+
+// Event is a Warning event attributed to a cluster
+type Event struct {
+	Cluster string
+	Kind    string
+	Name    string
+	Reason  string
+	Message string
+	Time    time.Time
+}
+
+// sample is one observation of a metric rule's value
+type sample struct {
+	at    time.Time
+	value float64
+}
+
+// Engine evaluates the alert rules and delivers notifications for state changes
+type Engine struct {
+	rules          []Rule
+	receivers      []Receiver
+	repeatInterval time.Duration
+	alerts         map[string]*Alert   // Pending and firing alerts by key
+	silences       map[string]Silence  // Active silences by ID
+	events         map[string][]Event  // Matching events per key within the rule window
+	samples        map[string][]sample // Metric samples per key for increase rules
+	silenceSeq     uint64
+	notifications  chan Notification // Delivery queue, so slow receivers don't hold up evaluation
+	mutex          sync.Mutex
+}
+
+func NewEngine(config Config, receivers []Receiver, defaultRepeatInterval time.Duration) *Engine {
+	repeatInterval := time.Duration(config.RepeatInterval)
+	if repeatInterval <= 0 {
+		repeatInterval = defaultRepeatInterval
+	}
+	return &Engine{
+		rules:          config.Rules,
+		receivers:      receivers,
+		repeatInterval: repeatInterval,
+		alerts:         make(map[string]*Alert),
+		silences:       make(map[string]Silence),
+		events:         make(map[string][]Event),
+		samples:        make(map[string][]sample),
+		notifications:  make(chan Notification, 256),
+	}
+}
+
+// ObserveEvent records a Warning event against the event rules it matches
+func (e *Engine) ObserveEvent(event Event) {
+	if event.Cluster == "" {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if rule.Event == nil || !rule.Event.matches(event) {
+			continue
+		}
+		if time.Since(event.Time) > time.Duration(rule.Event.Window) {
+			continue
+		}
+		key := alertKey(rule.Name, event.Cluster)
+		e.events[key] = append(e.events[key], event)
+	}
+}
+
+// Run evaluates the rules every interval over the metrics history's latest scrape, and reports alert
+// state changes through onChange
+func (e *Engine) Run(ctx context.Context, interval time.Duration,
+	clusterNames func() []string,
+	conditions func() map[string][]map[string]interface{},
+	latestMetrics func() ([]*dto.MetricFamily, error),
+	onChange func(alert Alert)) {
+
+	go e.deliverNotifications(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		families, err := latestMetrics()
+		if err != nil {
+			logger.Log.Debug("No operator metrics for alert evaluation", zap.Error(err))
+		}
+
+		for _, alert := range e.Evaluate(time.Now(), clusterNames(), conditions(), families, err == nil) {
+			onChange(alert)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate applies every rule to every cluster and returns the alerts whose state changed.
+// When metricsAvailable is false, metric-based alerts keep their current state.
+func (e *Engine) Evaluate(now time.Time, clusterNames []string,
+	conditions map[string][]map[string]interface{},
+	families []*dto.MetricFamily, metricsAvailable bool) []Alert {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for id, silence := range e.silences {
+		if now.After(silence.EndsAt) {
+			delete(e.silences, id)
+		}
+	}
+
+	var changed []Alert
+	seen := make(map[string]bool)
+	for i := range e.rules {
+		rule := &e.rules[i]
+
+		var values map[string]float64
+		if rule.Metric != nil {
+			if !metricsAvailable {
+				for _, clusterName := range clusterNames {
+					seen[alertKey(rule.Name, clusterName)] = true
+				}
+				continue
+			}
+			values = metrics.ClusterValues(families, rule.Metric.Name)
+		}
+
+		for _, clusterName := range clusterNames {
+			key := alertKey(rule.Name, clusterName)
+			seen[key] = true
+
+			var matching bool
+			var since time.Time
+			var value float64
+			var summary string
+			switch {
+			case rule.Condition != nil:
+				matching, since, summary = e.evaluateCondition(rule.Condition, conditions[clusterName])
+			case rule.Metric != nil:
+				value, matching, summary = e.evaluateMetric(key, rule.Metric, values, clusterName, now)
+			case rule.Event != nil:
+				value, matching, summary = e.evaluateEvents(key, rule.Event, now)
+			}
+
+			if alert, transitioned := e.transition(rule, key, clusterName, matching, since, value, summary, now); transitioned {
+				changed = append(changed, alert)
+			}
+		}
+	}
+
+	// Alerts of deleted clusters or removed rules resolve
+	for key, alert := range e.alerts {
+		if !seen[key] {
+			if resolved, transitioned := e.transition(&Rule{Name: alert.Rule, Severity: alert.Severity}, key, alert.Cluster, false, time.Time{}, 0, "", now); transitioned {
+				changed = append(changed, resolved)
+			}
+			delete(e.events, key)
+			delete(e.samples, key)
+		}
+	}
+
+	// Notify firing alerts that are new, due for a repeat, or no longer silenced
+	for _, alert := range e.alerts {
+		if alert.State != StateFiring {
+			continue
+		}
+		silencedBy := e.matchSilence(alert)
+		if (silencedBy != "") != alert.Silenced {
+			alert.Silenced = silencedBy != ""
+			alert.SilencedBy = silencedBy
+			changed = append(changed, *alert)
+		}
+		if alert.Silenced {
+			continue
+		}
+		if alert.LastNotifiedAt == nil || now.Sub(*alert.LastNotifiedAt) >= e.repeatInterval {
+			notifiedAt := now
+			alert.LastNotifiedAt = &notifiedAt
+			e.enqueue(Notification{Status: NotificationFiring, Alert: *alert})
+		}
+	}
+
+	return changed
+}
+
+// transition moves an alert between pending, firing and resolved
+func (e *Engine) transition(rule *Rule, key, clusterName string, matching bool, since time.Time, value float64, summary string, now time.Time) (Alert, bool) {
+	alert, exists := e.alerts[key]
+
+	if !matching {
+		if !exists {
+			return Alert{}, false
+		}
+		delete(e.alerts, key)
+		if alert.State != StateFiring {
+			return Alert{}, false
+		}
+
+		resolvedAt := now
+		alert.State = StateResolved
+		alert.ResolvedAt = &resolvedAt
+		logger.Log.Info("Alert resolved",
+			zap.String("rule", alert.Rule),
+			zap.String("cluster", alert.Cluster))
+
+		// Only resolve what receivers were told about
+		if alert.LastNotifiedAt != nil {
+			e.enqueue(Notification{Status: NotificationResolved, Alert: *alert})
+		}
+		return *alert, true
+	}
+
+	if !exists {
+		if since.IsZero() || since.After(now) {
+			since = now
+		}
+		alert = &Alert{
+			Key:         key,
+			Rule:        rule.Name,
+			Cluster:     clusterName,
+			Severity:    rule.Severity,
+			State:       StatePending,
+			ActiveSince: since,
+		}
+		e.alerts[key] = alert
+	}
+	alert.Summary = summary
+	alert.Value = value
+
+	if alert.State == StatePending && now.Sub(alert.ActiveSince) >= time.Duration(rule.For) {
+		firingSince := now
+		alert.State = StateFiring
+		alert.FiringSince = &firingSince
+		logger.Log.Warn("Alert firing",
+			zap.String("rule", alert.Rule),
+			zap.String("cluster", alert.Cluster),
+			zap.String("severity", alert.Severity),
+			zap.String("summary", alert.Summary))
+		return *alert, true
+	}
+	return *alert, false
+}
+
+func (e *Engine) evaluateCondition(rule *ConditionRule, conditions []map[string]interface{}) (bool, time.Time, string) {
+	for _, condition := range conditions {
+		if conditionType, _ := condition["type"].(string); conditionType != rule.Type {
+			continue
+		}
+		status, _ := condition["status"].(string)
+		if !strings.EqualFold(status, rule.Status) {
+			return false, time.Time{}, ""
+		}
+
+		// Measure the duration from the condition's own transition so restarts don't reset it
+		var since time.Time
+		if transition, ok := condition["lastTransitionTime"].(string); ok {
+			since, _ = time.Parse(time.RFC3339, transition)
+		}
+
+		summary := fmt.Sprintf("condition %s is %s", rule.Type, status)
+		if message, _ := condition["message"].(string); message != "" {
+			summary += ": " + message
+		} else if reason, _ := condition["reason"].(string); reason != "" {
+			summary += ": " + reason
+		}
+		return true, since, summary
+	}
+	return false, time.Time{}, ""
+}
+
+func (e *Engine) evaluateMetric(key string, rule *MetricRule, values map[string]float64, clusterName string, now time.Time) (float64, bool, string) {
+	current, exists := values[clusterName]
+
+	if rule.Op != "increase" {
+		if !exists {
+			return 0, false, ""
+		}
+		return current, compare(rule.Op, current, rule.Threshold),
+			fmt.Sprintf("%s is %s (%s %s)", rule.Name, formatValue(current), rule.Op, formatValue(rule.Threshold))
+	}
+
+	window := time.Duration(rule.Window)
+	samples := e.samples[key]
+	if exists {
+		samples = append(samples, sample{at: now, value: current})
+	}
+	for len(samples) > 0 && now.Sub(samples[0].at) > window {
+		samples = samples[1:]
+	}
+	e.samples[key] = samples
+
+	// Sum positive steps so counter resets don't hide increases
+	var increase float64
+	for i := 1; i < len(samples); i++ {
+		if delta := samples[i].value - samples[i-1].value; delta > 0 {
+			increase += delta
+		} else if delta < 0 {
+			increase += samples[i].value
+		}
+	}
+	return increase, compare(rule.Op, increase, rule.Threshold),
+		fmt.Sprintf("%s increased by %s in the last %s", rule.Name, formatValue(increase), window)
+}
+
+func (e *Engine) evaluateEvents(key string, rule *EventRule, now time.Time) (float64, bool, string) {
+	window := time.Duration(rule.Window)
+	events := e.events[key]
+	for len(events) > 0 && now.Sub(events[0].Time) > window {
+		events = events[1:]
+	}
+	if len(events) == 0 {
+		delete(e.events, key)
+		return 0, false, ""
+	}
+	e.events[key] = events
+
+	latest := events[len(events)-1]
+	summary := fmt.Sprintf("%d Warning events in the last %s, latest %s %s/%s: %s",
+		len(events), window, latest.Reason, latest.Kind, latest.Name, latest.Message)
+	return float64(len(events)), len(events) >= rule.Threshold, summary
+}
+
+func (e *Engine) matchSilence(alert *Alert) string {
+	for id, silence := range e.silences {
+		if (silence.Rule == "" || silence.Rule == alert.Rule) && (silence.Cluster == "" || silence.Cluster == alert.Cluster) {
+			return id
+		}
+	}
+	return ""
+}
+
+func (e *Engine) enqueue(notification Notification) {
+	select {
+	case e.notifications <- notification:
+	default:
+		logger.Log.Error("Alert notification queue full, dropping notification",
+			zap.String("rule", notification.Alert.Rule),
+			zap.String("cluster", notification.Alert.Cluster),
+			zap.String("status", notification.Status))
+	}
+}
+
+func (e *Engine) deliverNotifications(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-e.notifications:
+			deliver(ctx, e.receivers, notification)
+		}
+	}
+}
+
+// AddSilence silences matching alerts for duration. At least one of rule or cluster is required.
+func (e *Engine) AddSilence(rule, cluster string, duration time.Duration, comment, createdBy string) (Silence, error) {
+	if rule == "" && cluster == "" {
+		return Silence{}, fmt.Errorf("a silence needs a rule, a cluster or both")
+	}
+	if duration <= 0 {
+		return Silence{}, fmt.Errorf("a silence needs a positive duration")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.silenceSeq++
+	now := time.Now()
+	silence := Silence{
+		ID:        "silence-" + strconv.FormatUint(e.silenceSeq, 10),
+		Rule:      rule,
+		Cluster:   cluster,
+		Comment:   comment,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		EndsAt:    now.Add(duration),
+	}
+	e.silences[silence.ID] = silence
+
+	logger.Log.Info("Alert silence added",
+		zap.String("id", silence.ID),
+		zap.String("rule", rule),
+		zap.String("cluster", cluster),
+		zap.Time("endsAt", silence.EndsAt))
+	return silence, nil
+}
+
+// RemoveSilence expires a silence early
+func (e *Engine) RemoveSilence(id string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, exists := e.silences[id]; !exists {
+		return false
+	}
+	delete(e.silences, id)
+	logger.Log.Info("Alert silence removed", zap.String("id", id))
+	return true
+}
+
+// Silences returns the active silences, soonest to end first
+func (e *Engine) Silences() []Silence {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	silences := make([]Silence, 0, len(e.silences))
+	for _, silence := range e.silences {
+		silences = append(silences, silence)
+	}
+	sort.Slice(silences, func(i, j int) bool { return silences[i].EndsAt.Before(silences[j].EndsAt) })
+	return silences
+}
+
+// Alerts returns the pending and firing alerts, optionally for one cluster only
+func (e *Engine) Alerts(clusterName string) []Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		if clusterName == "" || alert.Cluster == clusterName {
+			alerts = append(alerts, *alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Key < alerts[j].Key })
+	return alerts
+}
+
+// Rules returns the configured rules
+func (e *Engine) Rules() []Rule {
+	return e.rules
+}
+
+// Receivers returns the names and types of the configured receivers
+func (e *Engine) Receivers() []DeliveryResult {
+	receivers := make([]DeliveryResult, 0, len(e.receivers))
+	for _, receiver := range e.receivers {
+		receivers = append(receivers, DeliveryResult{Receiver: receiver.Name(), Type: receiver.Type()})
+	}
+	return receivers
+}
+
+// Test sends a test notification to every receiver and reports the outcome of each
+func (e *Engine) Test(ctx context.Context) []DeliveryResult {
+	now := time.Now()
+	return deliver(ctx, e.receivers, Notification{
+		Status: NotificationTest,
+		Alert: Alert{
+			Key:         alertKey("TestNotification", "none"),
+			Rule:        "TestNotification",
+			Cluster:     "none",
+			Severity:    "info",
+			State:       StateFiring,
+			Summary:     "Test notification from the Couchbase Operator Dashboard",
+			ActiveSince: now,
+			FiringSince: &now,
+		},
+	})
+}
+
+func alertKey(rule, clusterName string) string {
+	return rule + "/" + clusterName
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
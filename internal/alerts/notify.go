@@ -0,0 +1,285 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cod/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// Notification statuses
+const (
+	NotificationFiring   = "firing"
+	NotificationResolved = "resolved"
+	NotificationTest     = "test"
+)
+
+// Notification is a single alert delivered to the receivers
+type Notification struct {
+	Status string `json:"status"`
+	Alert  Alert  `json:"alert"`
+}
+
+// Receiver delivers notifications to one destination
+type Receiver interface {
+	Name() string
+	Type() string
+	Send(ctx context.Context, notification Notification) error
+}
+
+// DeliveryResult is the outcome of sending a notification to one receiver
+type DeliveryResult struct {
+	Receiver string `json:"receiver"`
+	Type     string `json:"type"`
+	Error    string `json:"error,omitempty"`
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// NewReceivers builds the receivers from the rules file and the COD_ALERT_* environment variables
+func NewReceivers(configs []ReceiverConfig) ([]Receiver, error) {
+	configs = append(configs, receiversFromEnv()...)
+
+	receivers := make([]Receiver, 0, len(configs))
+	for _, config := range configs {
+		if config.Name == "" {
+			config.Name = config.Type
+		}
+		switch config.Type {
+		case "webhook":
+			if config.URL == "" {
+				return nil, fmt.Errorf("receiver %q: webhook needs a url", config.Name)
+			}
+			receivers = append(receivers, &webhookReceiver{config: config})
+		case "slack":
+			if config.URL == "" {
+				return nil, fmt.Errorf("receiver %q: slack needs a url", config.Name)
+			}
+			receivers = append(receivers, &slackReceiver{config: config})
+		case "smtp":
+			if config.Host == "" || config.From == "" || len(config.To) == 0 {
+				return nil, fmt.Errorf("receiver %q: smtp needs a host, from and to", config.Name)
+			}
+			if config.Port == 0 {
+				config.Port = 25
+			}
+			receivers = append(receivers, &smtpReceiver{config: config})
+		default:
+			return nil, fmt.Errorf("receiver %q: unknown type %q", config.Name, config.Type)
+		}
+	}
+	return receivers, nil
+}
+
+func receiversFromEnv() []ReceiverConfig {
+	var configs []ReceiverConfig
+	if url := os.Getenv("COD_ALERT_WEBHOOK_URL"); url != "" {
+		configs = append(configs, ReceiverConfig{Name: "env-webhook", Type: "webhook", URL: url})
+	}
+	if url := os.Getenv("COD_ALERT_SLACK_URL"); url != "" {
+		configs = append(configs, ReceiverConfig{Name: "env-slack", Type: "slack", URL: url})
+	}
+	if host := os.Getenv("COD_ALERT_SMTP_HOST"); host != "" {
+		port, _ := strconv.Atoi(os.Getenv("COD_ALERT_SMTP_PORT"))
+		configs = append(configs, ReceiverConfig{
+			Name:     "env-smtp",
+			Type:     "smtp",
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("COD_ALERT_SMTP_USERNAME"),
+			Password: os.Getenv("COD_ALERT_SMTP_PASSWORD"),
+			From:     os.Getenv("COD_ALERT_SMTP_FROM"),
+			To:       splitList(os.Getenv("COD_ALERT_SMTP_TO")),
+		})
+	}
+	return configs
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// deliver sends a notification to every receiver, retrying transient failures
+func deliver(ctx context.Context, receivers []Receiver, notification Notification) []DeliveryResult {
+	results := make([]DeliveryResult, 0, len(receivers))
+	for _, receiver := range receivers {
+		var err error
+		for attempt := 1; attempt <= 3; attempt++ {
+			if err = receiver.Send(ctx, notification); err == nil {
+				break
+			}
+			logger.Log.Warn("Failed to deliver alert notification",
+				zap.Error(err),
+				zap.String("receiver", receiver.Name()),
+				zap.String("alert", notification.Alert.Rule),
+				zap.Int("attempt", attempt))
+
+			select {
+			case <-ctx.Done():
+				attempt = 3
+			case <-time.After(time.Duration(attempt) * 2 * time.Second):
+			}
+		}
+
+		result := DeliveryResult{Receiver: receiver.Name(), Type: receiver.Type()}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// summaryLine renders a notification as a single line of text
+func summaryLine(notification Notification) string {
+	alert := notification.Alert
+	return fmt.Sprintf("[%s] %s on cluster %s: %s",
+		strings.ToUpper(notification.Status), alert.Rule, alert.Cluster, alert.Summary)
+}
+
+func postJSON(ctx context.Context, url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("received status %s from %s", resp.Status, url)
+	}
+	return nil
+}
+
+// webhookReceiver posts the notification as JSON
+type webhookReceiver struct {
+	config ReceiverConfig
+}
+
+func (r *webhookReceiver) Name() string { return r.config.Name }
+func (r *webhookReceiver) Type() string { return r.config.Type }
+
+func (r *webhookReceiver) Send(ctx context.Context, notification Notification) error {
+	return postJSON(ctx, r.config.URL, r.config.Headers, map[string]interface{}{
+		"receiver": r.config.Name,
+		"status":   notification.Status,
+		"alerts":   []Alert{notification.Alert},
+	})
+}
+
+// slackReceiver posts to a Slack-compatible incoming webhook
+type slackReceiver struct {
+	config ReceiverConfig
+}
+
+func (r *slackReceiver) Name() string { return r.config.Name }
+func (r *slackReceiver) Type() string { return r.config.Type }
+
+func (r *slackReceiver) Send(ctx context.Context, notification Notification) error {
+	color := "#2eb886"
+	if notification.Status == NotificationFiring {
+		color = "#d00000"
+		if notification.Alert.Severity != "critical" {
+			color = "#daa038"
+		}
+	}
+
+	alert := notification.Alert
+	return postJSON(ctx, r.config.URL, r.config.Headers, map[string]interface{}{
+		"text": summaryLine(notification),
+		"attachments": []map[string]interface{}{{
+			"color": color,
+			"fields": []map[string]interface{}{
+				{"title": "Cluster", "value": alert.Cluster, "short": true},
+				{"title": "Severity", "value": alert.Severity, "short": true},
+				{"title": "Since", "value": alert.ActiveSince.Format(time.RFC3339), "short": true},
+			},
+		}},
+	})
+}
+
+// smtpReceiver sends a plain-text email. STARTTLS is used when the server offers it.
+type smtpReceiver struct {
+	config ReceiverConfig
+}
+
+func (r *smtpReceiver) Name() string { return r.config.Name }
+func (r *smtpReceiver) Type() string { return r.config.Type }
+
+func (r *smtpReceiver) Send(ctx context.Context, notification Notification) error {
+	alert := notification.Alert
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", headerValue(r.config.From))
+	fmt.Fprintf(&body, "To: %s\r\n", headerValue(strings.Join(r.config.To, ", ")))
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(summaryLine(notification))))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&body, "Status:   %s\r\n", notification.Status)
+	fmt.Fprintf(&body, "Rule:     %s\r\n", alert.Rule)
+	fmt.Fprintf(&body, "Cluster:  %s\r\n", alert.Cluster)
+	fmt.Fprintf(&body, "Severity: %s\r\n", alert.Severity)
+	fmt.Fprintf(&body, "Since:    %s\r\n", alert.ActiveSince.Format(time.RFC3339))
+	if alert.ResolvedAt != nil {
+		fmt.Fprintf(&body, "Resolved: %s\r\n", alert.ResolvedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&body, "\r\n%s\r\n", alert.Summary)
+
+	var auth smtp.Auth
+	if r.config.Username != "" {
+		auth = smtp.PlainAuth("", r.config.Username, r.config.Password, r.config.Host)
+	}
+	address := net.JoinHostPort(r.config.Host, strconv.Itoa(r.config.Port))
+
+	// net/smtp has no context support, so bound the exchange from the outside
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(address, auth, r.config.From, r.config.To, []byte(body.String()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(30 * time.Second):
+		return fmt.Errorf("timed out sending mail via %s", address)
+	}
+}
+
+// headerValue folds a value onto one line, so that event and condition text cannot start new mail headers
+func headerValue(value string) string {
+	return strings.Join(strings.FieldsFunc(value, func(r rune) bool { return r == '\r' || r == '\n' }), " ")
+}
@@ -0,0 +1,206 @@
+package alerts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testNotification() Notification {
+	return Notification{
+		Status: NotificationFiring,
+		Alert: Alert{
+			Rule:        "WarningEvents",
+			Cluster:     "cb-example",
+			Severity:    "critical",
+			Summary:     "5 Warning events\r\nBcc: victim@example.com",
+			ActiveSince: time.Now(),
+		},
+	}
+}
+
+// captureHTTP starts a stand-in receiver that records the decoded JSON body of each request
+func captureHTTP(t *testing.T) (*httptest.Server, <-chan map[string]interface{}) {
+	t.Helper()
+	bodies := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("configured header not sent, Authorization = %q", r.Header.Get("Authorization"))
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		bodies <- body
+	}))
+	t.Cleanup(server.Close)
+	return server, bodies
+}
+
+func TestWebhookReceiver(t *testing.T) {
+	server, bodies := captureHTTP(t)
+	receivers, err := NewReceivers([]ReceiverConfig{{Name: "hook", Type: "webhook", URL: server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := receivers[0].Send(context.Background(), testNotification()); err != nil {
+		t.Fatal(err)
+	}
+	body := <-bodies
+	if body["status"] != NotificationFiring || body["receiver"] != "hook" {
+		t.Errorf("unexpected payload %v", body)
+	}
+	alerts, _ := body["alerts"].([]interface{})
+	if len(alerts) != 1 || alerts[0].(map[string]interface{})["cluster"] != "cb-example" {
+		t.Errorf("unexpected alerts %v", body["alerts"])
+	}
+}
+
+func TestSlackReceiver(t *testing.T) {
+	server, bodies := captureHTTP(t)
+	receivers, err := NewReceivers([]ReceiverConfig{{Type: "slack", URL: server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := receivers[0].Send(context.Background(), testNotification()); err != nil {
+		t.Fatal(err)
+	}
+	body := <-bodies
+	if text, _ := body["text"].(string); !strings.HasPrefix(text, "[FIRING] WarningEvents on cluster cb-example") {
+		t.Errorf("unexpected text %q", text)
+	}
+	attachments, _ := body["attachments"].([]interface{})
+	if len(attachments) != 1 || attachments[0].(map[string]interface{})["color"] != "#d00000" {
+		t.Errorf("unexpected attachments %v", body["attachments"])
+	}
+}
+
+func TestWebhookReceiverError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	receiver := &webhookReceiver{config: ReceiverConfig{Name: "hook", Type: "webhook", URL: server.URL}}
+	if err := receiver.Send(context.Background(), testNotification()); err == nil {
+		t.Fatal("expected an error for a 503 response")
+	}
+}
+
+// smtpStandIn accepts one mail over a minimal SMTP dialogue and returns its recipients and data
+func smtpStandIn(t *testing.T) (string, <-chan []string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	recipients := make(chan []string, 1)
+	data := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		var rcpt []string
+		reply("220 stand-in ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 stand-in")
+			case strings.HasPrefix(command, "MAIL FROM"):
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO"):
+				rcpt = append(rcpt, strings.TrimSpace(line[len("RCPT TO:"):]))
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var message strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					message.WriteString(line)
+				}
+				recipients <- rcpt
+				data <- message.String()
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), recipients, data
+}
+
+func TestSMTPReceiver(t *testing.T) {
+	address, recipients, data := smtpStandIn(t)
+	host, port, _ := net.SplitHostPort(address)
+	portNumber, _ := net.LookupPort("tcp", port)
+
+	receivers, err := NewReceivers([]ReceiverConfig{{Type: "smtp", Host: host, Port: portNumber,
+		From: "cod@example.com", To: []string{"ops@example.com"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receivers[0].Send(context.Background(), testNotification()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rcpt := <-recipients; len(rcpt) != 1 || rcpt[0] != "<ops@example.com>" {
+		t.Errorf("unexpected recipients %v", rcpt)
+	}
+	message := <-data
+	headers, _, _ := strings.Cut(message, "\r\n\r\n")
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(strings.ToLower(line), "bcc:") {
+			t.Errorf("alert text injected a header: %q", line)
+		}
+	}
+	if !strings.Contains(headers, "Subject: [FIRING] WarningEvents on cluster cb-example: 5 Warning events Bcc: victim@example.com\r\n") {
+		t.Errorf("unexpected headers:\n%s", headers)
+	}
+}
+
+func TestHeaderValue(t *testing.T) {
+	tests := map[string]string{
+		"plain":                   "plain",
+		"line\r\nBcc: x@y":        "line Bcc: x@y",
+		"cr\rlf\nboth\r\n\r\nend": "cr lf both end",
+	}
+	for input, want := range tests {
+		if got := headerValue(input); got != want {
+			t.Errorf("headerValue(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Duration is a time.Duration read from strings like "5m" in the rules file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Rule is a single alert rule. Exactly one of Condition, Metric or Event is set.
+type Rule struct {
+	Name      string         `json:"name"`
+	Severity  string         `json:"severity,omitempty"` // critical, warning or info
+	For       Duration       `json:"for,omitempty"`      // How long the rule must match before the alert fires
+	Condition *ConditionRule `json:"condition,omitempty"`
+	Metric    *MetricRule    `json:"metric,omitempty"`
+	Event     *EventRule     `json:"event,omitempty"`
+}
+
+// ConditionRule matches a CouchbaseCluster status condition, e.g. Available=False
+type ConditionRule struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// MetricRule compares an operator metric per cluster. The "increase" op compares the
+// counter's increase over Window with Threshold; the other ops compare the current value.
+type MetricRule struct {
+	Name      string   `json:"name"`
+	Op        string   `json:"op"` // increase, >, >=, <, <=, == or !=
+	Threshold float64  `json:"threshold"`
+	Window    Duration `json:"window,omitempty"`
+}
+
+// EventRule counts matching Warning events per cluster over Window
+type EventRule struct {
+	Reason    string   `json:"reason,omitempty"`  // Regular expression on the event reason
+	Message   string   `json:"message,omitempty"` // Regular expression on the event message
+	Kind      string   `json:"kind,omitempty"`    // Involved object kind, e.g. Pod
+	Threshold int      `json:"threshold,omitempty"`
+	Window    Duration `json:"window,omitempty"`
+
+	reason  *regexp.Regexp
+	message *regexp.Regexp
+}
+
+// ReceiverConfig describes a notification destination
+type ReceiverConfig struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"` // webhook, slack or smtp
+	URL      string            `json:"url,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Host     string            `json:"host,omitempty"`
+	Port     int               `json:"port,omitempty"`
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	From     string            `json:"from,omitempty"`
+	To       []string          `json:"to,omitempty"`
+}
+
+// Config is the content of the alert rules file
+type Config struct {
+	RepeatInterval Duration         `json:"repeatInterval,omitempty"` // How often a still-firing alert is re-sent
+	Rules          []Rule           `json:"rules"`
+	Receivers      []ReceiverConfig `json:"receivers,omitempty"`
+}
+
+// DefaultRules are used when no rules file is configured
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:     "ClusterUnavailable",
+			Severity: "critical",
+			For:      Duration(5 * time.Minute),
+			Condition: &ConditionRule{
+				Type:   "Available",
+				Status: "False",
+			},
+		},
+		{
+			Name:     "ReconcileFailuresIncreasing",
+			Severity: "warning",
+			Metric: &MetricRule{
+				Name:      "couchbase_operator_reconcile_failures",
+				Op:        "increase",
+				Threshold: 0,
+				Window:    Duration(10 * time.Minute),
+			},
+		},
+		{
+			Name:     "PodRecoveryFailures",
+			Severity: "warning",
+			Metric: &MetricRule{
+				Name:      "couchbase_operator_pod_recovery_failures_total",
+				Op:        "increase",
+				Threshold: 0,
+				Window:    Duration(10 * time.Minute),
+			},
+		},
+		{
+			Name:     "RepeatedWarningEvents",
+			Severity: "warning",
+			Event: &EventRule{
+				Threshold: 5,
+				Window:    Duration(10 * time.Minute),
+			},
+		},
+	}
+}
+
+// LoadConfig reads a YAML or JSON rules file. An empty path yields the default rules.
+func LoadConfig(path string) (Config, error) {
+	config := Config{}
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return config, err
+		}
+		defer file.Close()
+
+		if err := yaml.NewYAMLOrJSONDecoder(file, 4096).Decode(&config); err != nil {
+			return config, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	if len(config.Rules) == 0 {
+		config.Rules = DefaultRules()
+	}
+	if err := validateRules(config.Rules); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+func validateRules(rules []Rule) error {
+	names := make(map[string]bool, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d has no name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+
+		kinds := 0
+		if rule.Condition != nil {
+			kinds++
+			if rule.Condition.Type == "" || rule.Condition.Status == "" {
+				return fmt.Errorf("rule %q: condition needs a type and a status", rule.Name)
+			}
+		}
+		if rule.Metric != nil {
+			kinds++
+			switch rule.Metric.Op {
+			case "increase":
+				if rule.Metric.Window <= 0 {
+					rule.Metric.Window = Duration(10 * time.Minute)
+				}
+			case ">", ">=", "<", "<=", "==", "!=":
+			default:
+				return fmt.Errorf("rule %q: unknown metric op %q", rule.Name, rule.Metric.Op)
+			}
+			if rule.Metric.Name == "" {
+				return fmt.Errorf("rule %q: metric needs a name", rule.Name)
+			}
+		}
+		if rule.Event != nil {
+			kinds++
+			if err := rule.Event.compile(); err != nil {
+				return fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+		}
+		if kinds != 1 {
+			return fmt.Errorf("rule %q must set exactly one of condition, metric or event", rule.Name)
+		}
+	}
+	return nil
+}
+
+func (e *EventRule) compile() error {
+	var err error
+	if e.Reason != "" {
+		if e.reason, err = regexp.Compile(e.Reason); err != nil {
+			return fmt.Errorf("invalid reason pattern: %w", err)
+		}
+	}
+	if e.Message != "" {
+		if e.message, err = regexp.Compile(e.Message); err != nil {
+			return fmt.Errorf("invalid message pattern: %w", err)
+		}
+	}
+	if e.Threshold < 1 {
+		e.Threshold = 1
+	}
+	if e.Window <= 0 {
+		e.Window = Duration(10 * time.Minute)
+	}
+	return nil
+}
+
+func (e *EventRule) matches(event Event) bool {
+	if e.Kind != "" && !strings.EqualFold(e.Kind, event.Kind) {
+		return false
+	}
+	if e.reason != nil && !e.reason.MatchString(event.Reason) {
+		return false
+	}
+	if e.message != nil && !e.message.MatchString(event.Message) {
+		return false
+	}
+	return true
+}
+
+// compare applies a metric rule's comparison op
+func compare(op string, value, threshold float64) bool {
+	switch op {
+	case ">", "increase":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/logger"
+	"cod/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// Sources of audited actions
+const (
+	SourceProxy     = "proxy"     // Requests proxied to Couchbase Server through /cui/
+	SourceDashboard = "dashboard" // Changes made through the dashboard's own API
+)
+
+// Entry is one audited action
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Source     string    `json:"source"`
+	User       string    `json:"user,omitempty"` // Identity from the trusted user header
+	RemoteAddr string    `json:"remoteAddr"`
+	Cluster    string    `json:"cluster,omitempty"`
+	Node       string    `json:"node,omitempty"` // Pod, for requests to a single node
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Body       string    `json:"body,omitempty"` // Sanitized summary of the request body
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"durationMs"`
+	Rule       string    `json:"rule,omitempty"` // Policy rule that blocked the request
+}
+
+// Config sets where audit entries are kept
+type Config struct {
+	File     string // JSON lines; empty keeps entries in memory only
+	MaxSize  int64  // Bytes before the file is rotated
+	MaxFiles int    // Rotated files kept besides the current one
+	Memory   int    // Recent entries kept for searching
+	Events   bool   // Also emit Kubernetes Events on the CouchbaseCluster
+}
+
+// ConfigFromEnv reads the audit settings from COD_AUDIT_* variables
+func ConfigFromEnv() Config {
+	return Config{
+		File:     os.Getenv("COD_AUDIT_FILE"),
+		MaxSize:  int64(utils.GetEnvInt("COD_AUDIT_MAX_SIZE_MB", 10)) << 20,
+		MaxFiles: utils.GetEnvInt("COD_AUDIT_MAX_FILES", 5),
+		Memory:   utils.GetEnvInt("COD_AUDIT_MEMORY", 1000),
+		Events:   utils.GetEnvBool("COD_AUDIT_EVENTS", false),
+	}
+}
+
+// Query selects audit entries. Empty fields match every entry.
+type Query struct {
+	Cluster string
+	User    string
+	Source  string
+	Text    string // Case-insensitive substring of the method, path, body or user
+	Since   time.Time
+	Limit   int
+}
+
+// Log records audit entries to a rotating file, keeps the recent ones for searching and
+// passes them to an optional emitter
+type Log struct {
+	config  Config
+	emit    func(Entry)
+	file    *os.File
+	size    int64
+	entries []Entry // Ring buffer of the most recent entries
+	next    int
+	mutex   sync.Mutex
+}
+
+// NewLog opens the audit file, loading its most recent entries. emit may be nil.
+func NewLog(config Config, emit func(Entry)) (*Log, error) {
+	l := &Log{config: config, emit: emit, entries: make([]Entry, 0, max(config.Memory, 1))}
+	if config.File == "" {
+		return l, nil
+	}
+
+	if err := l.load(); err != nil {
+		logger.Log.Warn("Failed to load previous audit entries", zap.Error(err), zap.String("file", config.File))
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record stores an entry. Failing to write the file is logged, not returned, so that audited
+// actions are never blocked by the audit log.
+func (l *Log) Record(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	l.mutex.Lock()
+	l.remember(entry)
+	if l.file != nil {
+		if err := l.write(entry); err != nil {
+			logger.Log.Error("Failed to write audit entry", zap.Error(err), zap.String("file", l.config.File))
+		}
+	}
+	l.mutex.Unlock()
+
+	logger.Log.Info("Audit",
+		zap.String("source", entry.Source),
+		zap.String("user", entry.User),
+		zap.String("cluster", entry.Cluster),
+		zap.String("method", entry.Method),
+		zap.String("path", entry.Path),
+		zap.Int("status", entry.Status))
+	if l.emit != nil {
+		l.emit(entry)
+	}
+}
+
+// Search returns the recent entries matching a query, newest first
+func (l *Log) Search(query Query) []Entry {
+	text := strings.ToLower(query.Text)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	result := []Entry{}
+	for i := 0; i < len(l.entries); i++ {
+		// Walk backwards from the newest entry
+		entry := l.entries[(l.next-1-i+2*len(l.entries))%len(l.entries)]
+		if (query.Cluster != "" && entry.Cluster != query.Cluster) ||
+			(query.User != "" && entry.User != query.User) ||
+			(query.Source != "" && entry.Source != query.Source) ||
+			entry.Time.Before(query.Since) {
+			continue
+		}
+		if text != "" && !strings.Contains(strings.ToLower(entry.Method+" "+entry.Path+" "+entry.Body+" "+entry.User+" "+entry.Node), text) {
+			continue
+		}
+		result = append(result, entry)
+		if query.Limit > 0 && len(result) >= query.Limit {
+			break
+		}
+	}
+	return result
+}
+
+// remember adds an entry to the ring buffer
+func (l *Log) remember(entry Entry) {
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, entry)
+		l.next = len(l.entries) % cap(l.entries)
+		return
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+func (l *Log) write(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if l.config.MaxSize > 0 && l.size+int64(len(line)) > l.config.MaxSize && l.size > 0 {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// rotate renames the file to <file>.1, shifting older files up to MaxFiles
+func (l *Log) rotate() error {
+	l.file.Close()
+	l.file = nil
+	os.Remove(fmt.Sprintf("%s.%d", l.config.File, l.config.MaxFiles))
+	for i := l.config.MaxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.config.File, i), fmt.Sprintf("%s.%d", l.config.File, i+1))
+	}
+	if l.config.MaxFiles > 0 {
+		if err := os.Rename(l.config.File, l.config.File+".1"); err != nil {
+			return fmt.Errorf("failed to rotate audit file: %w", err)
+		}
+	} else if err := os.Truncate(l.config.File, 0); err != nil {
+		return fmt.Errorf("failed to rotate audit file: %w", err)
+	}
+	return l.open()
+}
+
+// load fills the ring buffer from the current audit file
+func (l *Log) load() error {
+	file, err := os.Open(l.config.File)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			l.remember(entry)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cod/internal/logger"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// eventReason is the reason of the Kubernetes Events emitted for audit entries
+const eventReason = "DashboardAudit"
+
+// EventEmitter returns an emitter that records audit entries of a cluster as Kubernetes Events
+// on its CouchbaseCluster, so they show up in `kubectl describe`
+func EventEmitter(clientset kubernetes.Interface, clusterObject func(clusterName string) (*unstructured.Unstructured, bool)) func(Entry) {
+	return func(entry Entry) {
+		if entry.Cluster == "" {
+			return
+		}
+		clusterObj, exists := clusterObject(entry.Cluster)
+		if !exists {
+			return
+		}
+		go emitEvent(clientset, clusterObj, entry)
+	}
+}
+
+func emitEvent(clientset kubernetes.Interface, clusterObj *unstructured.Unstructured, entry Entry) {
+	user := entry.User
+	if user == "" {
+		user = "unknown user"
+	}
+	message := fmt.Sprintf("%s %s %s through the dashboard %s: %d", user, entry.Method, entry.Path, entry.Source, entry.Status)
+	if entry.Node != "" {
+		message += " (node " + entry.Node + ")"
+	}
+	if entry.Rule != "" {
+		message += " blocked by rule " + entry.Rule
+	}
+	eventType := v1.EventTypeNormal
+	if entry.Status >= 400 {
+		eventType = v1.EventTypeWarning
+	}
+
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: clusterObj.GetName() + "-audit-",
+			Namespace:    clusterObj.GetNamespace(),
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion: clusterObj.GetAPIVersion(),
+			Kind:       clusterObj.GetKind(),
+			Name:       clusterObj.GetName(),
+			Namespace:  clusterObj.GetNamespace(),
+			UID:        clusterObj.GetUID(),
+		},
+		Reason:         eventReason,
+		Message:        message,
+		Type:           eventType,
+		Source:         v1.EventSource{Component: "couchbase-operator-dashboard"},
+		FirstTimestamp: metav1.NewTime(entry.Time),
+		LastTimestamp:  metav1.NewTime(entry.Time),
+		Count:          1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := clientset.CoreV1().Events(clusterObj.GetNamespace()).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		logger.Log.Warn("Failed to emit audit event",
+			zap.Error(err),
+			zap.String("cluster", clusterObj.GetName()))
+	}
+}
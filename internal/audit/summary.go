@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	maxBodyCapture = 64 * 1024 // Bytes of a request body read for its summary
+	maxSummary     = 512       // Characters of a body summary
+	maxValue       = 64        // Characters of a single value in a summary
+)
+
+// sensitiveKeys mark fields whose values are never recorded, matched anywhere in the lowercased
+// field name: "pass" catches Couchbase's bindPass and emailPass, "key" its pkey
+var sensitiveKeys = []string{"pass", "secret", "token", "credential", "key", "auth", "cert"}
+
+// CaptureBody summarizes a request's body and leaves the body intact for the handler
+func CaptureBody(r *http.Request) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+	captured, err := io.ReadAll(io.LimitReader(r.Body, maxBodyCapture))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(captured), r.Body), r.Body}
+	if err != nil {
+		return fmt.Sprintf("<unreadable body: %v>", err)
+	}
+	return Summarize(r.Header.Get("Content-Type"), captured)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Summarize describes a request body with sensitive values redacted: form and JSON fields as
+// key=value pairs, anything else by size and type
+func Summarize(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var fields []string
+	switch {
+	case mediaType == "application/x-www-form-urlencoded" || (mediaType == "" && bytes.Contains(body, []byte("="))):
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			break
+		}
+		for key, value := range values {
+			fields = append(fields, field(key, strings.Join(value, ",")))
+		}
+	case strings.HasSuffix(mediaType, "json"):
+		var object map[string]interface{}
+		if json.Unmarshal(body, &object) != nil {
+			break
+		}
+		for key, value := range object {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				fields = append(fields, key+"={…}")
+			case []interface{}:
+				fields = append(fields, fmt.Sprintf("%s=[%d items]", key, len(v)))
+			default:
+				fields = append(fields, field(key, fmt.Sprint(v)))
+			}
+		}
+	}
+	if fields == nil {
+		if mediaType == "" {
+			mediaType = "unknown type"
+		}
+		return fmt.Sprintf("<%d bytes of %s>", len(body), mediaType)
+	}
+
+	sort.Strings(fields)
+	summary := strings.Join(fields, " ")
+	if len(summary) > maxSummary {
+		summary = summary[:maxSummary] + "…"
+	}
+	return summary
+}
+
+func field(key, value string) string {
+	lower := strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(lower, sensitive) {
+			return key + "=***"
+		}
+	}
+	if len(value) > maxValue {
+		value = value[:maxValue] + "…"
+	}
+	return key + "=" + value
+}
+
+// StatusWriter records the status code written through a ResponseWriter
+type StatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w}
+}
+
+func (w *StatusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *StatusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the status written, 200 if the handler wrote nothing
+func (w *StatusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
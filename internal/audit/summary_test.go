@@ -0,0 +1,68 @@
+package audit
+
+import "testing"
+
+func TestSummarize(t *testing.T) {
+	const form = "application/x-www-form-urlencoded"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{
+			name:        "ldap settings",
+			contentType: form,
+			body:        "hosts=ldap.example.com&port=636&encryption=TLS&bindDN=cn%3Dadmin&bindPass=s3cret",
+			want:        "bindDN=cn=admin bindPass=*** encryption=TLS hosts=ldap.example.com port=636",
+		},
+		{
+			name:        "local user",
+			contentType: form,
+			body:        "name=Alice&roles=ro_admin&password=s3cret",
+			want:        "name=Alice password=*** roles=ro_admin",
+		},
+		{
+			name:        "remote cluster reference",
+			contentType: form,
+			body:        "name=dr&hostname=10.0.0.1&username=Administrator&pass=s3cret&demandEncryption=1",
+			want:        "demandEncryption=1 hostname=10.0.0.1 name=dr pass=*** username=Administrator",
+		},
+		{
+			name:        "email alerts",
+			contentType: form,
+			body:        "enabled=true&emailHost=smtp.example.com&emailUser=cb&emailPass=s3cret",
+			want:        "emailHost=smtp.example.com emailPass=*** emailUser=cb enabled=true",
+		},
+		{
+			name:        "node certificate key",
+			contentType: form,
+			body:        "pkey=-----BEGIN+PRIVATE+KEY-----&chain=-----BEGIN+CERTIFICATE-----",
+			want:        "chain=-----BEGIN CERTIFICATE----- pkey=***",
+		},
+		{
+			name:        "ldap settings as JSON",
+			contentType: "application/json",
+			body:        `{"hosts":["ldap.example.com"],"bindPass":"s3cret","port":636}`,
+			want:        "bindPass=*** hosts=[1 items] port=636",
+		},
+		{
+			name:        "form without content type",
+			body:        "password=s3cret&memoryQuota=512",
+			want:        "memoryQuota=512 password=***",
+		},
+		{
+			name:        "binary upload",
+			contentType: "application/octet-stream",
+			body:        "\x00\x01\x02",
+			want:        "<3 bytes of application/octet-stream>",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Summarize(test.contentType, []byte(test.body)); got != test.want {
+				t.Errorf("Summarize() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"time"
 
@@ -13,13 +14,36 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 )
 
-func StartClusterWatcher(ctx context.Context, dynamicClient dynamic.Interface,
+// ClusterGVR identifies the CouchbaseCluster custom resource
+var ClusterGVR = schema.GroupVersionResource{
+	Group:    "couchbase.com",
+	Version:  "v2",
+	Resource: "couchbaseclusters",
+}
+
+// UserGVR identifies the CouchbaseUser custom resource
+var UserGVR = schema.GroupVersionResource{
+	Group:    "couchbase.com",
+	Version:  "v2",
+	Resource: "couchbaseusers",
+}
+
+// NewClusterInformer creates the CouchbaseCluster informer for the given namespace.
+// The informer's store doubles as the authoritative cache of cluster objects.
+func NewClusterInformer(dynamicClient dynamic.Interface, namespace string) cache.SharedIndexInformer {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 30*time.Second, namespace, nil)
+	return factory.ForResource(ClusterGVR).Informer()
+}
+
+func StartClusterWatcher(ctx context.Context, clusterInformer cache.SharedIndexInformer,
 	addCluster func(obj interface{}),
 	deleteCluster func(obj interface{}),
-	updateCondition func(obj interface{})) {
+	updateCondition func(obj interface{}),
+	updateCluster func(oldObj, newObj interface{})) {
 
 	namespace := os.Getenv("WATCH_NAMESPACE")
 	if namespace == "" {
@@ -27,15 +51,6 @@ func StartClusterWatcher(ctx context.Context, dynamicClient dynamic.Interface,
 		return
 	}
 
-	gvr := schema.GroupVersionResource{
-		Group:    "couchbase.com",
-		Version:  "v2",
-		Resource: "couchbaseclusters",
-	}
-
-	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 30*time.Second, namespace, nil)
-	clusterInformer := factory.ForResource(gvr).Informer()
-
 	logger.Log.Info("Starting cluster watcher", zap.String("namespace", namespace))
 
 	clusterInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -55,7 +70,7 @@ func StartClusterWatcher(ctx context.Context, dynamicClient dynamic.Interface,
 			addCluster(obj)
 			updateCondition(obj)
 		},
-		UpdateFunc: func(_, newObj interface{}) {
+		UpdateFunc: func(oldObj, newObj interface{}) {
 			unstructuredObj, ok := newObj.(*unstructured.Unstructured)
 			if !ok {
 				logger.Log.Error("UpdateFunc received unknown object type",
@@ -64,6 +79,12 @@ func StartClusterWatcher(ctx context.Context, dynamicClient dynamic.Interface,
 				return
 			}
 
+			// Periodic resyncs replay the cached object unchanged - nothing to do
+			if oldUnstructured, ok := oldObj.(*unstructured.Unstructured); ok &&
+				oldUnstructured.GetResourceVersion() == unstructuredObj.GetResourceVersion() {
+				return
+			}
+
 			// Only log at Info level if it's being deleted, otherwise Debug
 			if unstructuredObj.GetDeletionTimestamp() != nil {
 				logger.Log.Info("Cluster marked for deletion",
@@ -76,6 +97,7 @@ func StartClusterWatcher(ctx context.Context, dynamicClient dynamic.Interface,
 					zap.String("namespace", namespace))
 			}
 
+			updateCluster(oldObj, newObj)
 			updateCondition(newObj)
 		},
 		DeleteFunc: func(obj interface{}) {
@@ -112,7 +134,7 @@ func StartClusterWatcher(ctx context.Context, dynamicClient dynamic.Interface,
 		},
 	})
 
-	factory.Start(ctx.Done())
+	go clusterInformer.Run(ctx.Done())
 	sync := cache.WaitForCacheSync(ctx.Done(), clusterInformer.HasSynced)
 	if !sync {
 		logger.Log.Error("Failed to sync cluster informer cache",
@@ -121,40 +143,76 @@ func StartClusterWatcher(ctx context.Context, dynamicClient dynamic.Interface,
 	}
 }
 
-// LoadClusterConditions fetches all existing CouchbaseCluster objects and updates their conditions
-// This should be called when a new client connects to immediately get all cluster conditions
-func LoadClusterConditions(dynamicClient dynamic.Interface, updateCondition func(obj interface{})) error {
-	namespace := os.Getenv("WATCH_NAMESPACE")
-	if namespace == "" {
-		logger.Log.Warn("WATCH_NAMESPACE not set - cannot load cluster conditions")
-		return nil
+// ExtractConditions returns the `.status.conditions` of a CouchbaseCluster object.
+// found is false when the object has no status yet.
+func ExtractConditions(obj *unstructured.Unstructured) (conditions []map[string]interface{}, found bool, err error) {
+	status, found, err := unstructured.NestedMap(obj.Object, "status")
+	if err != nil || !found {
+		return nil, false, err
 	}
 
-	// Create the CouchbaseCluster GVR
-	gvr := schema.GroupVersionResource{
-		Group:    "couchbase.com",
-		Version:  "v2",
-		Resource: "couchbaseclusters",
+	conditionsRaw, _, err := unstructured.NestedSlice(status, "conditions")
+	if err != nil {
+		return nil, true, err
 	}
 
-	// List all CouchbaseCluster objects in the namespace
-	clusters, err := dynamicClient.Resource(gvr).Namespace(namespace).List(context.Background(), metav1.ListOptions{})
+	// Convert []interface{} to []map[string]interface{}
+	conditions = make([]map[string]interface{}, 0, len(conditionsRaw))
+	for _, condition := range conditionsRaw {
+		if condMap, ok := condition.(map[string]interface{}); ok {
+			conditions = append(conditions, condMap)
+		} else {
+			logger.Log.Warn("Condition item is not a map[string]interface{}",
+				zap.String("cluster", obj.GetName()),
+				zap.Any("condition", condition))
+		}
+	}
+
+	return conditions, true, nil
+}
+
+// AdminCredentials reads the Couchbase administrator username and password from the
+// Secret named by the cluster's spec.security.adminSecret
+func AdminCredentials(ctx context.Context, clientset kubernetes.Interface, clusterObj *unstructured.Unstructured) (string, string, error) {
+	secretName, found, err := unstructured.NestedString(clusterObj.Object, "spec", "security", "adminSecret")
+	if err != nil || !found || secretName == "" {
+		return "", "", fmt.Errorf("cluster %s has no spec.security.adminSecret", clusterObj.GetName())
+	}
+
+	secret, err := clientset.CoreV1().Secrets(clusterObj.GetNamespace()).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
-		logger.Log.Error("Failed to list CouchbaseCluster objects",
-			zap.Error(err),
-			zap.String("namespace", namespace),
-			zap.String("resource", "couchbaseclusters"))
-		return err
+		return "", "", fmt.Errorf("failed to read admin secret %s: %w", secretName, err)
 	}
 
-	logger.Log.Info("Loading cluster conditions",
-		zap.String("namespace", namespace),
-		zap.Int("clusterCount", len(clusters.Items)))
+	username, password := string(secret.Data["username"]), string(secret.Data["password"])
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("admin secret %s must contain username and password", secretName)
+	}
+	return username, password, nil
+}
 
-	// Process each cluster to update conditions
-	for _, cluster := range clusters.Items {
-		updateCondition(&cluster)
+// UserCredentials reads the username and password of a local CouchbaseUser from the Secret named
+// by its spec.authSecret. The username is the CouchbaseUser's name.
+func UserCredentials(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, namespace, name string) (string, string, error) {
+	user, err := dynamicClient.Resource(UserGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read CouchbaseUser %s: %w", name, err)
+	}
+	if domain, _, _ := unstructured.NestedString(user.Object, "spec", "authDomain"); domain != "" && domain != "local" {
+		return "", "", fmt.Errorf("CouchbaseUser %s is in the %s domain; only local users have a password", name, domain)
+	}
+	secretName, _, _ := unstructured.NestedString(user.Object, "spec", "authSecret")
+	if secretName == "" {
+		return "", "", fmt.Errorf("CouchbaseUser %s has no spec.authSecret", name)
 	}
 
-	return nil
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read auth secret %s: %w", secretName, err)
+	}
+	password := string(secret.Data["password"])
+	if password == "" {
+		return "", "", fmt.Errorf("auth secret %s must contain password", secretName)
+	}
+	return name, password, nil
 }
@@ -0,0 +1,150 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"cod/internal/utils"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Client certificate policies of spec.networking.tls.clientCertificatePolicy
+const (
+	ClientCertificateEnable    = "enable"
+	ClientCertificateMandatory = "mandatory"
+)
+
+// TLS is the PEM material needed to reach a cluster that has spec.networking.tls
+type TLS struct {
+	CA                      []byte // CA bundle the cluster's server certificates are verified against
+	Certificate             []byte // Client certificate, only read when the cluster requires one
+	Key                     []byte
+	ClientCertificatePolicy string
+}
+
+// Equal reports whether two TLS settings hold the same material
+func (t *TLS) Equal(other *TLS) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	return bytes.Equal(t.CA, other.CA) && bytes.Equal(t.Certificate, other.Certificate) &&
+		bytes.Equal(t.Key, other.Key) && t.ClientCertificatePolicy == other.ClientCertificatePolicy
+}
+
+// TLSSettings reads a cluster's TLS material from the Secrets named by spec.networking.tls.
+// It returns nil when the cluster does not use TLS. On error, the settings hold what could be read.
+// The client certificate authenticates as the operator's own Couchbase identity, so it is only read
+// when clientCertificatePolicy is mandatory and there is no other way in.
+func TLSSettings(ctx context.Context, clientset kubernetes.Interface, clusterObj *unstructured.Unstructured) (*TLS, error) {
+	spec, found, err := unstructured.NestedMap(clusterObj.Object, "spec", "networking", "tls")
+	if err != nil || !found || spec == nil {
+		return nil, err
+	}
+
+	settings := &TLS{}
+	settings.ClientCertificatePolicy, _, _ = unstructured.NestedString(spec, "clientCertificatePolicy")
+	secrets := clientset.CoreV1().Secrets(clusterObj.GetNamespace())
+	readSecret := func(name string) (map[string][]byte, error) {
+		secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS secret %s: %w", name, err)
+		}
+		return secret.Data, nil
+	}
+
+	// Secrets holding the CA and client certificate: secretSource (CAO 2.2+) or the legacy static
+	// settings, whose operator Secret names the client pair after the operator
+	serverSecret, _, _ := unstructured.NestedString(spec, "secretSource", "serverSecretName")
+	clientSecret, _, _ := unstructured.NestedString(spec, "secretSource", "clientSecretName")
+	certKey, keyKey := "tls.crt", "tls.key"
+	if operatorSecret, _, _ := unstructured.NestedString(spec, "static", "operatorSecret"); operatorSecret != "" {
+		serverSecret, clientSecret = operatorSecret, operatorSecret
+		certKey, keyKey = "couchbase-operator.crt", "couchbase-operator.key"
+	}
+
+	if serverSecret != "" {
+		data, err := readSecret(serverSecret)
+		if err != nil {
+			return settings, err
+		}
+		settings.CA = append(settings.CA, data["ca.crt"]...)
+	}
+
+	// Additional trusted CAs, e.g. when the server certificate is signed by an intermediate
+	rootCAs, _, _ := unstructured.NestedStringSlice(spec, "rootCAs")
+	for _, name := range rootCAs {
+		data, err := readSecret(name)
+		if err != nil {
+			return settings, err
+		}
+		if ca, ok := data["ca.crt"]; ok {
+			settings.CA = append(settings.CA, ca...)
+		} else {
+			settings.CA = append(settings.CA, data["tls.crt"]...)
+		}
+	}
+
+	if settings.ClientCertificatePolicy != ClientCertificateMandatory {
+		return settings, nil
+	}
+	if clientSecret != "" {
+		data, err := readSecret(clientSecret)
+		if err != nil {
+			return settings, err
+		}
+		settings.Certificate, settings.Key = data[certKey], data[keyKey]
+	}
+	if len(settings.Certificate) == 0 || len(settings.Key) == 0 {
+		return settings, fmt.Errorf("cluster %s requires client certificates but no client secret provides %s and %s",
+			clusterObj.GetName(), certKey, keyKey)
+	}
+	return settings, nil
+}
+
+// ClientConfig verifies a cluster's server certificates against its CA and presents the client
+// certificate it requires. The operator's server certificates name the pods and the -srv service
+// rather than the console Service or pod IPs, so a certificate valid for any of those names, or the
+// given hosts, is accepted.
+func (t *TLS) ClientConfig(clusterName, namespace string, hosts ...string) (*tls.Config, error) {
+	config, err := utils.TLSConfigFromPEM(t.CA, t.Certificate, t.Key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{
+		fmt.Sprintf("%s-srv.%s.svc", clusterName, namespace),
+		fmt.Sprintf("%s-0000.%s.%s.svc", clusterName, clusterName, namespace), // Matches *.<cluster>.<ns>.svc
+	}
+	for _, host := range hosts {
+		names = append(names, host, strings.TrimSuffix(host, ".cluster.local"))
+	}
+	roots := config.RootCAs
+	config.InsecureSkipVerify = true // Replaced by VerifyConnection, which accepts any of the names
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return fmt.Errorf("cluster %s presented no certificate", clusterName)
+		}
+		options := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+		for _, intermediate := range state.PeerCertificates[1:] {
+			options.Intermediates.AddCert(intermediate)
+		}
+		leaf := state.PeerCertificates[0]
+		if _, err := leaf.Verify(options); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if leaf.VerifyHostname(name) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("certificate of cluster %s is not valid for any of %s", clusterName, strings.Join(names, ", "))
+	}
+	return config, nil
+}
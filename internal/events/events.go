@@ -32,8 +32,9 @@ func StartEventWatcher(ctx context.Context, clientset *kubernetes.Clientset, dyn
 		zap.String("namespace", namespace),
 		zap.String("cluster", clusterName))
 
-	eventInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
+	eventInformer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		// The initial list replays existing events, which must not count as a burst
+		AddFunc: func(obj interface{}, isInInitialList bool) {
 			event, ok := obj.(*v1.Event)
 			if !ok || !isRelevantEvent(event, clientset, dynamicClient, clusterName) {
 				return
@@ -52,6 +53,8 @@ func StartEventWatcher(ctx context.Context, clientset *kubernetes.Clientset, dyn
 				Message:     event.Message,
 				Kind:        event.InvolvedObject.Kind,
 				ObjectName:  event.InvolvedObject.Name,
+				OccurredAt:  LastSeen(event),
+				Replayed:    isInInitialList,
 			}
 			broadcast <- msg
 		},
@@ -130,3 +133,49 @@ func GetInitialEvents(clientset *kubernetes.Clientset, dynamicClient dynamic.Int
 
 	return initialEvents
 }
+
+// WatchWarningEvents runs a namespace-wide informer over Warning events and hands every new
+// or recurring event to handle. Unlike StartEventWatcher it runs regardless of connected clients.
+func WatchWarningEvents(ctx context.Context, clientset *kubernetes.Clientset, namespace string, handle func(event *v1.Event)) {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 5*time.Minute,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = "type=" + v1.EventTypeWarning
+		}))
+	eventInformer := factory.Core().V1().Events().Informer()
+
+	eventInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if event, ok := obj.(*v1.Event); ok {
+				handle(event)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldEvent, ok := oldObj.(*v1.Event)
+			if !ok {
+				return
+			}
+			// Repeated occurrences bump the count of the existing event
+			if event, ok := newObj.(*v1.Event); ok && event.Count != oldEvent.Count {
+				handle(event)
+			}
+		},
+	})
+
+	logger.Log.Info("Starting warning event watcher", zap.String("namespace", namespace))
+	factory.Start(ctx.Done())
+	cache.WaitForCacheSync(ctx.Done(), eventInformer.HasSynced)
+}
+
+// LastSeen returns when an event last occurred
+func LastSeen(event *v1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
@@ -0,0 +1,425 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/utils"
+)
+
+// StormKind is the kind of the event feed entries that summarise a storm
+const StormKind = "EventStorm"
+
+// Storm types
+const (
+	StormRepeat = "repeat" // The same message from one object over and over
+	StormSpike  = "spike"  // A cluster's event rate far above its baseline
+)
+
+const (
+	maxStormsPerCluster = 50
+	baselineMinutes     = 30
+	spikeFactor         = 3 // Rate over the last minute relative to the baseline that counts as a spike
+	maxTopObjects       = 5
+)
+
+// digitsPattern matches the counters and durations that vary between otherwise identical messages
+var digitsPattern = regexp.MustCompile(`[0-9]+`)
+
+// StormConfig sets when repeated or bursty events are collapsed
+type StormConfig struct {
+	Window          time.Duration // Repeats are counted within, and storms end after, this much quiet
+	RepeatThreshold int           // Identical messages from one object within the window that start a storm
+	RateThreshold   int           // Events per minute of a cluster that can start a spike
+	UpdateInterval  time.Duration // Minimum time between published updates of a storm
+}
+
+// Storm is a summarised burst of events that were collapsed out of the feed
+type Storm struct {
+	ID         string         `json:"id"`
+	Cluster    string         `json:"cluster"`
+	Type       string         `json:"type"`
+	Kind       string         `json:"kind,omitempty"`
+	ObjectName string         `json:"objectName,omitempty"`
+	Message    string         `json:"message"` // Latest collapsed message
+	Count      int            `json:"count"`   // Events in the storm, including those shown before it was detected
+	Suppressed int            `json:"suppressed"`
+	TopObjects []ObjectCount  `json:"topObjects,omitempty"` // Noisiest objects of a spike
+	FirstSeen  time.Time      `json:"firstSeen"`
+	LastSeen   time.Time      `json:"lastSeen"`
+	Active     bool           `json:"active"`
+	EndedAt    *time.Time     `json:"endedAt,omitempty"`
+	objects    map[string]int // Events per kind/object of a spike
+	published  time.Time
+	dirty      bool // Collapsed events not yet published
+}
+
+// ObjectCount is the number of events of one object within a spike
+type ObjectCount struct {
+	Object string `json:"object"`
+	Count  int    `json:"count"`
+}
+
+// Anomaly is a cluster's event rate compared to its baseline, and its active storms
+type Anomaly struct {
+	Cluster           string  `json:"cluster"`
+	Anomalous         bool    `json:"anomalous"`
+	ActiveStorms      int     `json:"activeStorms"`
+	RatePerMinute     int     `json:"ratePerMinute"`
+	BaselinePerMinute float64 `json:"baselinePerMinute"`
+}
+
+// clusterStorms is the detection state of one cluster
+type clusterStorms struct {
+	firstSeen  time.Time
+	recent     []time.Time            // Event times within the last minute
+	perMinute  map[int64]int          // Event counts per Unix minute for the baseline
+	repeats    map[string][]time.Time // Event times per object and normalised message within the window
+	active     map[string]*Storm      // Active storms by repeat key, or the spike
+	storms     []*Storm               // Recent storms, oldest first
+	anomalous  bool                   // Last reported anomaly state
+	spikeStart time.Time
+}
+
+// StormDetector collapses event storms out of the event feed
+type StormDetector struct {
+	config   StormConfig
+	clusters map[string]*clusterStorms
+	seq      uint64
+	mutex    sync.Mutex
+}
+
+func NewStormDetector(config StormConfig) *StormDetector {
+	return &StormDetector{
+		config:   config,
+		clusters: make(map[string]*clusterStorms),
+	}
+}
+
+// Observe passes an event through the detector. It returns the message to deliver, which is
+// the storm's summary entry when the event was collapsed into a storm, and false when the
+// event was collapsed and no update is due yet. Events are counted at the time they occurred;
+// replayed events only seed the cluster's baseline.
+func (d *StormDetector) Observe(msg utils.Message, now time.Time) (utils.Message, bool) {
+	if msg.Kind == StormKind {
+		return msg, true
+	}
+
+	at := msg.OccurredAt
+	if at.IsZero() || at.After(now) {
+		at = now
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	state := d.cluster(msg.ClusterName, at)
+	if at.Before(state.firstSeen) {
+		state.firstSeen = at
+	}
+	if now.Sub(at) <= baselineMinutes*time.Minute {
+		state.perMinute[at.Unix()/60]++
+	}
+	if msg.Replayed {
+		return msg, true
+	}
+
+	// Rate of the cluster over the last minute
+	state.recent = insertTime(state.recent, at)
+	for len(state.recent) > 0 && now.Sub(state.recent[0]) > time.Minute {
+		state.recent = state.recent[1:]
+	}
+
+	// Repeats of the same message from the same object
+	key := msg.Kind + "/" + msg.ObjectName + "/" + digitsPattern.ReplaceAllString(msg.Message, "#")
+	times := insertTime(state.repeats[key], at)
+	for len(times) > 0 && now.Sub(times[0]) > d.config.Window {
+		times = times[1:]
+	}
+	state.repeats[key] = times
+
+	object := msg.Kind + "/" + msg.ObjectName
+	if storm, exists := state.active[key]; exists {
+		storm.collapse(msg, object, at)
+		return d.due(storm, now)
+	}
+	if storm, exists := state.active[StormSpike]; exists {
+		storm.collapse(msg, object, at)
+		return d.due(storm, now)
+	}
+
+	if len(times) >= d.config.RepeatThreshold {
+		storm := d.start(state, msg.ClusterName, StormRepeat, times[0], now)
+		storm.Kind, storm.ObjectName = msg.Kind, msg.ObjectName
+		storm.Count = len(times) - 1
+		storm.collapse(msg, object, at)
+		state.active[key] = storm
+		return d.summary(storm, now), true
+	}
+
+	if rate := len(state.recent); rate >= d.config.RateThreshold && float64(rate) >= spikeFactor*d.baseline(state, now) {
+		storm := d.start(state, msg.ClusterName, StormSpike, state.recent[0], now)
+		storm.Count = rate - 1
+		storm.collapse(msg, object, at)
+		state.active[StormSpike] = storm
+		return d.summary(storm, now), true
+	}
+
+	return msg, true
+}
+
+// Run publishes pending storm updates and ends quiet storms every interval. publish receives
+// storm summary entries for the event feed; onAnomaly receives clusters whose anomaly state changed.
+func (d *StormDetector) Run(ctx context.Context, interval time.Duration, publish func(msg utils.Message), onAnomaly func(anomaly Anomaly)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		messages, anomalies := d.Expire(time.Now())
+		for _, msg := range messages {
+			publish(msg)
+		}
+		for _, anomaly := range anomalies {
+			onAnomaly(anomaly)
+		}
+	}
+}
+
+// Expire ends storms that have gone quiet, and returns the summaries that are due and the
+// clusters whose anomaly state changed
+func (d *StormDetector) Expire(now time.Time) ([]utils.Message, []Anomaly) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var messages []utils.Message
+	var anomalies []Anomaly
+	for clusterName, state := range d.clusters {
+		for len(state.recent) > 0 && now.Sub(state.recent[0]) > time.Minute {
+			state.recent = state.recent[1:]
+		}
+		for minute := range state.perMinute {
+			if now.Unix()/60-minute > baselineMinutes {
+				delete(state.perMinute, minute)
+			}
+		}
+		for key, times := range state.repeats {
+			if len(times) == 0 || now.Sub(times[len(times)-1]) > d.config.Window {
+				delete(state.repeats, key)
+			}
+		}
+
+		for key, storm := range state.active {
+			quiet := now.Sub(storm.LastSeen) > d.config.Window
+			if key == StormSpike {
+				// A spike ends once the cluster's rate is back under the threshold
+				quiet = len(state.recent) < d.config.RateThreshold && now.Sub(state.spikeStart) > time.Minute
+			}
+			if quiet {
+				storm.Active = false
+				endedAt := now
+				storm.EndedAt = &endedAt
+				delete(state.active, key)
+				messages = append(messages, d.summary(storm, now))
+			} else if storm.dirty && now.Sub(storm.published) >= d.config.UpdateInterval {
+				messages = append(messages, d.summary(storm, now))
+			}
+		}
+
+		anomaly := d.anomaly(clusterName, state, now)
+		if anomaly.Anomalous != state.anomalous {
+			state.anomalous = anomaly.Anomalous
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+	return messages, anomalies
+}
+
+// Storms returns the recent storms of a cluster, newest first
+func (d *StormDetector) Storms(clusterName string) []Storm {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	storms := []Storm{}
+	if state, exists := d.clusters[clusterName]; exists {
+		for i := len(state.storms) - 1; i >= 0; i-- {
+			storms = append(storms, state.storms[i].snapshot())
+		}
+	}
+	return storms
+}
+
+// Anomalies returns the anomaly state of every cluster that has emitted events
+func (d *StormDetector) Anomalies() []Anomaly {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	anomalies := make([]Anomaly, 0, len(d.clusters))
+	for clusterName, state := range d.clusters {
+		anomalies = append(anomalies, d.anomaly(clusterName, state, now))
+	}
+	sort.Slice(anomalies, func(i, j int) bool { return anomalies[i].Cluster < anomalies[j].Cluster })
+	return anomalies
+}
+
+// Forget drops a deleted cluster
+func (d *StormDetector) Forget(clusterName string) {
+	d.mutex.Lock()
+	delete(d.clusters, clusterName)
+	d.mutex.Unlock()
+}
+
+func (d *StormDetector) cluster(clusterName string, now time.Time) *clusterStorms {
+	state, exists := d.clusters[clusterName]
+	if !exists {
+		state = &clusterStorms{
+			firstSeen: now,
+			perMinute: make(map[int64]int),
+			repeats:   make(map[string][]time.Time),
+			active:    make(map[string]*Storm),
+		}
+		d.clusters[clusterName] = state
+	}
+	return state
+}
+
+func (d *StormDetector) start(state *clusterStorms, clusterName, stormType string, firstSeen, now time.Time) *Storm {
+	d.seq++
+	storm := &Storm{
+		ID:        fmt.Sprintf("storm-%d", d.seq),
+		Cluster:   clusterName,
+		Type:      stormType,
+		FirstSeen: firstSeen,
+		Active:    true,
+		objects:   make(map[string]int),
+	}
+	if stormType == StormSpike {
+		state.spikeStart = now
+	}
+	state.storms = append(state.storms, storm)
+	if len(state.storms) > maxStormsPerCluster {
+		state.storms = state.storms[1:]
+	}
+	return storm
+}
+
+// baseline is the cluster's average events per minute before the last minute
+func (d *StormDetector) baseline(state *clusterStorms, now time.Time) float64 {
+	current := now.Unix() / 60
+	var total int
+	for minute, count := range state.perMinute {
+		if minute < current && current-minute <= baselineMinutes {
+			total += count
+		}
+	}
+	minutes := min(max(int(now.Sub(state.firstSeen).Minutes()), 1), baselineMinutes)
+	return float64(total) / float64(minutes)
+}
+
+func (d *StormDetector) anomaly(clusterName string, state *clusterStorms, now time.Time) Anomaly {
+	return Anomaly{
+		Cluster:           clusterName,
+		Anomalous:         len(state.active) > 0,
+		ActiveStorms:      len(state.active),
+		RatePerMinute:     len(state.recent),
+		BaselinePerMinute: d.baseline(state, now),
+	}
+}
+
+// due returns the storm's summary when an update may be published
+func (d *StormDetector) due(storm *Storm, now time.Time) (utils.Message, bool) {
+	if now.Sub(storm.published) < d.config.UpdateInterval {
+		return utils.Message{}, false
+	}
+	return d.summary(storm, now), true
+}
+
+// summary builds the event feed entry of a storm
+func (d *StormDetector) summary(storm *Storm, now time.Time) utils.Message {
+	storm.published = now
+	storm.dirty = false
+	snapshot := storm.snapshot()
+
+	duration := storm.LastSeen.Sub(storm.FirstSeen).Round(time.Second)
+	var text string
+	switch storm.Type {
+	case StormRepeat:
+		text = fmt.Sprintf("Repeated %d times in %s (%d collapsed): %s", storm.Count, duration, storm.Suppressed, storm.Message)
+	case StormSpike:
+		top := make([]string, 0, len(snapshot.TopObjects))
+		for _, object := range snapshot.TopObjects {
+			top = append(top, fmt.Sprintf("%s (%d)", object.Object, object.Count))
+		}
+		text = fmt.Sprintf("Event rate spike: %d events in %s (%d collapsed), noisiest %s", storm.Count, duration, storm.Suppressed, strings.Join(top, ", "))
+	}
+	if !storm.Active {
+		text = "Ended: " + text
+	}
+
+	objectName := storm.ObjectName
+	if objectName == "" {
+		objectName = storm.Cluster
+	}
+	return utils.Message{
+		Type:        "event",
+		ClusterName: storm.Cluster,
+		Name:        storm.ID,
+		Message:     text,
+		Kind:        StormKind,
+		ObjectName:  objectName,
+		Data:        snapshot,
+	}
+}
+
+func (s *Storm) collapse(msg utils.Message, object string, at time.Time) {
+	s.Count++
+	s.Suppressed++
+	s.Message = msg.Message
+	if at.After(s.LastSeen) {
+		s.LastSeen = at
+	}
+	s.objects[object]++
+	s.dirty = true
+}
+
+// insertTime adds a time to a sorted slice, as events can arrive out of order
+func insertTime(times []time.Time, t time.Time) []time.Time {
+	i := sort.Search(len(times), func(i int) bool { return times[i].After(t) })
+	times = append(times, time.Time{})
+	copy(times[i+1:], times[i:])
+	times[i] = t
+	return times
+}
+
+// snapshot copies the storm with its noisiest objects for publishing
+func (s *Storm) snapshot() Storm {
+	snapshot := *s
+	snapshot.objects = nil
+	snapshot.TopObjects = nil
+	if s.Type == StormSpike {
+		for object, count := range s.objects {
+			snapshot.TopObjects = append(snapshot.TopObjects, ObjectCount{object, count})
+		}
+		sort.Slice(snapshot.TopObjects, func(i, j int) bool {
+			if snapshot.TopObjects[i].Count != snapshot.TopObjects[j].Count {
+				return snapshot.TopObjects[i].Count > snapshot.TopObjects[j].Count
+			}
+			return snapshot.TopObjects[i].Object < snapshot.TopObjects[j].Object
+		})
+		if len(snapshot.TopObjects) > maxTopObjects {
+			snapshot.TopObjects = snapshot.TopObjects[:maxTopObjects]
+		}
+	}
+	return snapshot
+}
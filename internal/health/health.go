@@ -0,0 +1,321 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/reconcile"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Health statuses, from healthy to unhealthy
+const (
+	StatusHealthy  = "Healthy"
+	StatusDegraded = "Degraded"
+	StatusCritical = "Critical"
+)
+
+// Signals a deduction can be attributed to
+const (
+	SignalConditions = "conditions"
+	SignalEvents     = "events"
+	SignalPods       = "pods"
+	SignalReconcile  = "reconcile"
+)
+
+// Deduction weights. A cluster starts at 100 and each finding subtracts its points.
+const (
+	notAvailablePoints     = 40
+	noAvailablePoints      = 10 // The operator has not reported Available yet
+	errorPoints            = 30
+	notBalancedPoints      = 15
+	upgradingPoints        = 5
+	eventPoints            = 2 // Per Warning event in the window
+	maxEventPoints         = 20
+	unreadyPodsPoints      = 30 // Scaled by the share of pods that are not ready
+	reconcileFailingPoints = 15
+	reconcileStuckPoints   = 25
+)
+
+// Deduction explains points taken off a cluster's score
+type Deduction struct {
+	Signal string `json:"signal"`
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
+}
+
+// Summary is the health of a single cluster
+type Summary struct {
+	Cluster        string      `json:"cluster"`
+	Rank           int         `json:"rank"` // 1 is the least healthy cluster of the fleet
+	Score          int         `json:"score"`
+	Status         string      `json:"status"`
+	Deductions     []Deduction `json:"deductions"`
+	WarningEvents  int         `json:"warningEvents"`
+	PodsReady      int         `json:"podsReady"`
+	PodsTotal      int         `json:"podsTotal"`
+	ReconcileState string      `json:"reconcileState,omitempty"`
+	EvaluatedAt    time.Time   `json:"evaluatedAt"`
+}
+
+// Inputs are the signals a cluster's score is computed from
+type Inputs struct {
+	Conditions []map[string]interface{}
+	Pods       []*v1.Pod
+	Reconcile  *reconcile.Status
+}
+
+// Scorer computes the health of every cluster and ranks the fleet
+type Scorer struct {
+	eventWindow time.Duration
+	events      map[string][]time.Time // Warning event times per cluster within the window
+	fleet       []Summary              // Last evaluation, least healthy first
+	mutex       sync.Mutex
+}
+
+func NewScorer(eventWindow time.Duration) *Scorer {
+	return &Scorer{
+		eventWindow: eventWindow,
+		events:      make(map[string][]time.Time),
+		fleet:       []Summary{},
+	}
+}
+
+// ObserveEvent records a Warning event of a cluster. Replays and relists deliver events out of
+// order, so times are kept sorted for Evaluate to expire the oldest first.
+func (s *Scorer) ObserveEvent(clusterName string, at time.Time) {
+	if clusterName == "" || time.Since(at) > s.eventWindow {
+		return
+	}
+	s.mutex.Lock()
+	events := s.events[clusterName]
+	i := sort.Search(len(events), func(i int) bool { return events[i].After(at) })
+	events = append(events, time.Time{})
+	copy(events[i+1:], events[i:])
+	events[i] = at
+	s.events[clusterName] = events
+	s.mutex.Unlock()
+}
+
+// Forget drops a deleted cluster
+func (s *Scorer) Forget(clusterName string) {
+	s.mutex.Lock()
+	delete(s.events, clusterName)
+	s.mutex.Unlock()
+}
+
+// Fleet returns the last evaluation, least healthy first
+func (s *Scorer) Fleet() []Summary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Summary(nil), s.fleet...)
+}
+
+// Summary returns the last evaluation of a single cluster
+func (s *Scorer) Summary(clusterName string) (Summary, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, summary := range s.fleet {
+		if summary.Cluster == clusterName {
+			return summary, true
+		}
+	}
+	return Summary{}, false
+}
+
+// Run re-evaluates the fleet every interval and reports it through onChange when any
+// cluster's score or deductions changed
+func (s *Scorer) Run(ctx context.Context, interval time.Duration,
+	clusterNames func() []string,
+	inputs func(clusterName string) Inputs,
+	onChange func(fleet []Summary)) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		clusters := make(map[string]Inputs)
+		for _, clusterName := range clusterNames() {
+			clusters[clusterName] = inputs(clusterName)
+		}
+		if fleet, changed := s.Evaluate(time.Now(), clusters); changed {
+			onChange(fleet)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate scores every cluster, ranks the fleet least healthy first and reports whether
+// it differs from the previous evaluation
+func (s *Scorer) Evaluate(now time.Time, clusters map[string]Inputs) ([]Summary, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fleet := make([]Summary, 0, len(clusters))
+	for clusterName, inputs := range clusters {
+		events := s.events[clusterName]
+		for len(events) > 0 && now.Sub(events[0]) > s.eventWindow {
+			events = events[1:]
+		}
+		if len(events) == 0 {
+			delete(s.events, clusterName)
+		} else {
+			s.events[clusterName] = events
+		}
+		fleet = append(fleet, score(clusterName, inputs, len(events), s.eventWindow, now))
+	}
+
+	sort.Slice(fleet, func(i, j int) bool {
+		if fleet[i].Score != fleet[j].Score {
+			return fleet[i].Score < fleet[j].Score
+		}
+		return fleet[i].Cluster < fleet[j].Cluster
+	})
+	for i := range fleet {
+		fleet[i].Rank = i + 1
+	}
+
+	changed := len(fleet) != len(s.fleet)
+	for i := 0; !changed && i < len(fleet); i++ {
+		previous := s.fleet[i]
+		changed = fleet[i].Cluster != previous.Cluster || fleet[i].Score != previous.Score ||
+			!reflect.DeepEqual(fleet[i].Deductions, previous.Deductions)
+	}
+	s.fleet = fleet
+	return append([]Summary(nil), fleet...), changed
+}
+
+// score applies the deductions of every signal to a cluster
+func score(clusterName string, inputs Inputs, warningEvents int, eventWindow time.Duration, now time.Time) Summary {
+	summary := Summary{
+		Cluster:       clusterName,
+		Deductions:    []Deduction{},
+		WarningEvents: warningEvents,
+		EvaluatedAt:   now,
+	}
+	deduct := func(signal string, points int, reason string) {
+		if points > 0 {
+			summary.Deductions = append(summary.Deductions, Deduction{signal, points, reason})
+		}
+	}
+
+	// Conditions
+	available := condition(inputs.Conditions, "Available")
+	switch {
+	case available == nil:
+		deduct(SignalConditions, noAvailablePoints, "Available condition not reported")
+	case !isTrue(available):
+		deduct(SignalConditions, notAvailablePoints, describe(available))
+	}
+	if errorCondition := condition(inputs.Conditions, "Error"); errorCondition != nil && isTrue(errorCondition) {
+		deduct(SignalConditions, errorPoints, describe(errorCondition))
+	}
+	if balanced := condition(inputs.Conditions, "Balanced"); balanced != nil && !isTrue(balanced) {
+		deduct(SignalConditions, notBalancedPoints, describe(balanced))
+	}
+	if upgrading := condition(inputs.Conditions, "Upgrading"); upgrading != nil && isTrue(upgrading) {
+		deduct(SignalConditions, upgradingPoints, describe(upgrading))
+	}
+
+	// Warning events
+	if warningEvents > 0 {
+		deduct(SignalEvents, min(warningEvents*eventPoints, maxEventPoints),
+			fmt.Sprintf("%d Warning events in the last %s", warningEvents, eventWindow))
+	}
+
+	// Pod readiness
+	summary.PodsTotal = len(inputs.Pods)
+	var unready []string
+	for _, pod := range inputs.Pods {
+		if podReady(pod) {
+			summary.PodsReady++
+		} else {
+			unready = append(unready, pod.Name)
+		}
+	}
+	if len(unready) > 0 {
+		sort.Strings(unready)
+		points := int(math.Ceil(float64(unreadyPodsPoints) * float64(len(unready)) / float64(summary.PodsTotal)))
+		deduct(SignalPods, points, fmt.Sprintf("%d of %d pods not ready: %s", len(unready), summary.PodsTotal, strings.Join(unready, ", ")))
+	}
+
+	// Reconcile
+	if status := inputs.Reconcile; status != nil {
+		summary.ReconcileState = status.State
+		reason := "reconcile " + strings.ToLower(status.State)
+		if status.Reason != "" {
+			reason += ": " + status.Reason
+		} else if status.LastError != "" {
+			reason += ": " + status.LastError
+		}
+		switch status.State {
+		case reconcile.StateStuck:
+			deduct(SignalReconcile, reconcileStuckPoints, reason)
+		case reconcile.StateFailing:
+			deduct(SignalReconcile, reconcileFailingPoints, reason)
+		}
+	}
+
+	summary.Score = 100
+	for _, deduction := range summary.Deductions {
+		summary.Score -= deduction.Points
+	}
+	summary.Score = max(summary.Score, 0)
+	switch {
+	case summary.Score >= 90:
+		summary.Status = StatusHealthy
+	case summary.Score >= 60:
+		summary.Status = StatusDegraded
+	default:
+		summary.Status = StatusCritical
+	}
+	return summary
+}
+
+func condition(conditions []map[string]interface{}, conditionType string) map[string]interface{} {
+	for _, c := range conditions {
+		if t, _ := c["type"].(string); t == conditionType {
+			return c
+		}
+	}
+	return nil
+}
+
+func isTrue(condition map[string]interface{}) bool {
+	status, _ := condition["status"].(string)
+	return strings.EqualFold(status, "True")
+}
+
+// describe explains a condition's state with its reason or message
+func describe(condition map[string]interface{}) string {
+	conditionType, _ := condition["type"].(string)
+	status, _ := condition["status"].(string)
+	description := fmt.Sprintf("%s is %s", conditionType, status)
+	if message, _ := condition["message"].(string); message != "" {
+		description += ": " + message
+	} else if reason, _ := condition["reason"].(string); reason != "" {
+		description += ": " + reason
+	}
+	return description
+}
+
+func podReady(pod *v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
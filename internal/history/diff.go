@@ -0,0 +1,262 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DiffEntry is a single changed field between two spec generations
+type DiffEntry struct {
+	Path     string        `json:"path"`
+	Op       string        `json:"op"` // added, removed or changed
+	Old      interface{}   `json:"old,omitempty"`
+	New      interface{}   `json:"new,omitempty"`
+	Managers []string      `json:"managers,omitempty"`
+	segments []pathSegment // Structured path, used for managedFields attribution
+}
+
+// pathSegment is one step of a field path: a map key, or a list element
+// identified by its name (preferred) or its index
+type pathSegment struct {
+	key   string
+	name  string
+	index int
+}
+
+// Diff computes the structured differences between two specs
+func Diff(oldSpec, newSpec map[string]interface{}) []DiffEntry {
+	var entries []DiffEntry
+	diffValues([]pathSegment{{key: "spec", index: -1}}, oldSpec, newSpec, &entries)
+	return entries
+}
+
+func diffValues(path []pathSegment, oldValue, newValue interface{}, entries *[]DiffEntry) {
+	switch {
+	case oldValue == nil && newValue == nil:
+		return
+	case oldValue == nil:
+		appendEntry(entries, path, "added", nil, newValue)
+		return
+	case newValue == nil:
+		appendEntry(entries, path, "removed", oldValue, nil)
+		return
+	}
+
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		for _, key := range unionKeys(oldMap, newMap) {
+			diffValues(appendSegment(path, pathSegment{key: key, index: -1}), oldMap[key], newMap[key], entries)
+		}
+		return
+	}
+
+	oldList, oldIsList := oldValue.([]interface{})
+	newList, newIsList := newValue.([]interface{})
+	if oldIsList && newIsList {
+		diffLists(path, oldList, newList, entries)
+		return
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		appendEntry(entries, path, "changed", oldValue, newValue)
+	}
+}
+
+// diffLists matches list elements by their "name" field when every element has one
+// (e.g. spec.servers, spec.buckets), otherwise by position
+func diffLists(path []pathSegment, oldList, newList []interface{}, entries *[]DiffEntry) {
+	oldByName, oldNamed := indexByName(oldList)
+	newByName, newNamed := indexByName(newList)
+
+	if oldNamed && newNamed {
+		for _, name := range unionKeys(oldByName, newByName) {
+			segment := pathSegment{name: name, index: -1}
+			diffValues(appendSegment(path, segment), oldByName[name], newByName[name], entries)
+		}
+		return
+	}
+
+	length := len(oldList)
+	if len(newList) > length {
+		length = len(newList)
+	}
+	for i := 0; i < length; i++ {
+		var oldItem, newItem interface{}
+		if i < len(oldList) {
+			oldItem = oldList[i]
+		}
+		if i < len(newList) {
+			newItem = newList[i]
+		}
+		diffValues(appendSegment(path, pathSegment{index: i}), oldItem, newItem, entries)
+	}
+}
+
+func indexByName(list []interface{}) (map[string]interface{}, bool) {
+	byName := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := itemMap["name"].(string)
+		if !ok || name == "" {
+			return nil, false
+		}
+		byName[name] = item
+	}
+	return byName, true
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, exists := a[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendSegment(path []pathSegment, segment pathSegment) []pathSegment {
+	extended := make([]pathSegment, len(path), len(path)+1)
+	copy(extended, path)
+	return append(extended, segment)
+}
+
+func appendEntry(entries *[]DiffEntry, path []pathSegment, op string, oldValue, newValue interface{}) {
+	*entries = append(*entries, DiffEntry{
+		Path:     formatPath(path),
+		Op:       op,
+		Old:      oldValue,
+		New:      newValue,
+		segments: path,
+	})
+}
+
+func formatPath(path []pathSegment) string {
+	var builder strings.Builder
+	for i, segment := range path {
+		switch {
+		case segment.key != "":
+			if i > 0 {
+				builder.WriteByte('.')
+			}
+			builder.WriteString(segment.key)
+		case segment.name != "":
+			fmt.Fprintf(&builder, "[name=%s]", segment.name)
+		default:
+			fmt.Fprintf(&builder, "[%d]", segment.index)
+		}
+	}
+	return builder.String()
+}
+
+// attributeManagers resolves the field managers owning each changed path from the
+// object's managedFields. Removed fields have no owner any more, so they are attributed
+// to the most recent writers. Returns the combined set of managers for the change.
+func attributeManagers(obj *unstructured.Unstructured, diff []DiffEntry) []string {
+	managedFields := obj.GetManagedFields()
+	if len(managedFields) == 0 {
+		return nil
+	}
+
+	type ownership struct {
+		manager string
+		fields  map[string]interface{}
+	}
+	owners := make([]ownership, 0, len(managedFields))
+	var latestManagers []string
+	var latestTime int64
+	for _, entry := range managedFields {
+		if entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		owners = append(owners, ownership{manager: entry.Manager, fields: fields})
+
+		if entry.Time == nil {
+			continue
+		}
+		switch updated := entry.Time.Unix(); {
+		case updated > latestTime:
+			latestTime = updated
+			latestManagers = []string{entry.Manager}
+		case updated == latestTime:
+			latestManagers = append(latestManagers, entry.Manager)
+		}
+	}
+
+	all := make(map[string]bool)
+	for i := range diff {
+		for _, owner := range owners {
+			if ownsPath(owner.fields, diff[i].segments) {
+				diff[i].Managers = appendUnique(diff[i].Managers, owner.manager)
+			}
+		}
+		if len(diff[i].Managers) == 0 {
+			diff[i].Managers = latestManagers
+		}
+		for _, manager := range diff[i].Managers {
+			all[manager] = true
+		}
+	}
+
+	managers := make([]string, 0, len(all))
+	for manager := range all {
+		managers = append(managers, manager)
+	}
+	sort.Strings(managers)
+	return managers
+}
+
+// ownsPath walks a fieldsV1 set along the path. A manager owns the path when the walk
+// reaches its end or stops at a leaf (an atomic field covering the whole subtree).
+func ownsPath(fields map[string]interface{}, path []pathSegment) bool {
+	node := fields
+	for _, segment := range path {
+		if len(node) == 0 || (len(node) == 1 && node["."] != nil) {
+			return true
+		}
+
+		var key string
+		switch {
+		case segment.key != "":
+			key = "f:" + segment.key
+		case segment.name != "":
+			key = fmt.Sprintf(`k:{"name":%q}`, segment.name)
+		default:
+			// Positional list elements are not addressable in managedFields
+			return false
+		}
+
+		child, ok := node[key].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		node = child
+	}
+	return true
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
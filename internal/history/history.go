@@ -0,0 +1,124 @@
+package history
+
+import (
+	"sync"
+	"time"
+
+	"cod/internal/logger"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Change describes a single spec generation of a CouchbaseCluster
+type Change struct {
+	Timestamp          time.Time              `json:"timestamp"`
+	Generation         int64                  `json:"generation"`
+	PreviousGeneration int64                  `json:"previousGeneration,omitempty"`
+	Initial            bool                   `json:"initial,omitempty"` // Spec as first observed, not a change
+	Diff               []DiffEntry            `json:"diff,omitempty"`
+	Managers           []string               `json:"managers,omitempty"` // Field managers responsible for the change
+	Spec               map[string]interface{} `json:"spec,omitempty"`
+}
+
+// Store retains the recent spec generations of every cluster
+type Store struct {
+	history map[string][]Change // Changes per cluster, oldest first
+	limit   int                 // Maximum number of changes retained per cluster
+	mutex   sync.RWMutex
+}
+
+func NewStore(limit int) *Store {
+	if limit < 1 {
+		limit = 1
+	}
+	return &Store{
+		history: make(map[string][]Change),
+		limit:   limit,
+	}
+}
+
+// Seed records the spec of a newly observed cluster as its initial history entry
+func (s *Store) Seed(obj *unstructured.Unstructured) {
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.history[obj.GetName()]; exists {
+		return
+	}
+	s.history[obj.GetName()] = []Change{{
+		Timestamp:  obj.GetCreationTimestamp().Time,
+		Generation: obj.GetGeneration(),
+		Initial:    true,
+		Spec:       spec,
+	}}
+}
+
+// Record diffs the spec of two versions of a cluster and stores the result.
+// Updates that did not bump metadata.generation (status-only) are ignored.
+// Returns the recorded change, or nil if nothing was recorded.
+func (s *Store) Record(oldObj, newObj *unstructured.Unstructured) *Change {
+	if oldObj.GetGeneration() == newObj.GetGeneration() {
+		return nil
+	}
+
+	oldSpec, _, _ := unstructured.NestedMap(oldObj.Object, "spec")
+	newSpec, _, _ := unstructured.NestedMap(newObj.Object, "spec")
+
+	diff := Diff(oldSpec, newSpec)
+	if len(diff) == 0 {
+		logger.Log.Debug("Generation changed without spec differences",
+			zap.String("cluster", newObj.GetName()),
+			zap.Int64("generation", newObj.GetGeneration()))
+		return nil
+	}
+
+	managers := attributeManagers(newObj, diff)
+
+	change := Change{
+		Timestamp:          time.Now(),
+		Generation:         newObj.GetGeneration(),
+		PreviousGeneration: oldObj.GetGeneration(),
+		Diff:               diff,
+		Managers:           managers,
+		Spec:               newSpec,
+	}
+
+	s.mutex.Lock()
+	clusterHistory := append(s.history[newObj.GetName()], change)
+	if len(clusterHistory) > s.limit {
+		clusterHistory = clusterHistory[len(clusterHistory)-s.limit:]
+	}
+	s.history[newObj.GetName()] = clusterHistory
+	s.mutex.Unlock()
+
+	logger.Log.Info("Recorded cluster spec change",
+		zap.String("cluster", newObj.GetName()),
+		zap.Int64("generation", change.Generation),
+		zap.Int("changedFields", len(diff)),
+		zap.Strings("managers", managers))
+
+	return &change
+}
+
+// Delete drops the history of a removed cluster
+func (s *Store) Delete(clusterName string) {
+	s.mutex.Lock()
+	delete(s.history, clusterName)
+	s.mutex.Unlock()
+}
+
+// History returns the retained changes of a cluster, newest first
+func (s *Store) History(clusterName string) []Change {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	clusterHistory := s.history[clusterName]
+	result := make([]Change, 0, len(clusterHistory))
+	for i := len(clusterHistory) - 1; i >= 0; i-- {
+		result = append(result, clusterHistory[i])
+	}
+	return result
+}
@@ -0,0 +1,310 @@
+package limits
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"cod/internal/utils"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Limits, as named in rejection metrics
+const (
+	LimitConnections       = "connections"         // WebSockets in total
+	LimitClientConnections = "client_connections"  // WebSockets per client
+	LimitLogSessions       = "log_sessions"        // Log streams in total
+	LimitClientLogSessions = "client_log_sessions" // Log streams per client
+	LimitClientMessages    = "client_messages"     // WebSocket messages per second per connection
+	LimitProxyRate         = "proxy_rate"          // Couchbase console requests per second per cluster
+)
+
+// Config caps the work clients can cause. A limit of 0 disables it.
+type Config struct {
+	MaxConnections         int     `json:"maxConnections"`
+	ConnectionsPerClient   int     `json:"connectionsPerClient"`
+	MaxLogSessions         int     `json:"maxLogSessions"`
+	LogSessionsPerClient   int     `json:"logSessionsPerClient"`
+	MessagesPerSecond      float64 `json:"messagesPerSecond"` // Per WebSocket connection
+	MessageBurst           int     `json:"messageBurst"`
+	ProxyRequestsPerSecond float64 `json:"proxyRequestsPerSecond"` // Per cluster
+	ProxyBurst             int     `json:"proxyBurst"`
+}
+
+// ConfigFromEnv reads the limits from COD_LIMIT_* variables
+func ConfigFromEnv() Config {
+	return Config{
+		MaxConnections:         utils.GetEnvInt("COD_LIMIT_CONNECTIONS", 200),
+		ConnectionsPerClient:   utils.GetEnvInt("COD_LIMIT_CONNECTIONS_PER_CLIENT", 10),
+		MaxLogSessions:         utils.GetEnvInt("COD_LIMIT_LOG_SESSIONS", 20),
+		LogSessionsPerClient:   utils.GetEnvInt("COD_LIMIT_LOG_SESSIONS_PER_CLIENT", 3),
+		MessagesPerSecond:      float64(utils.GetEnvInt("COD_LIMIT_MESSAGES_PER_SECOND", 5)),
+		MessageBurst:           utils.GetEnvInt("COD_LIMIT_MESSAGE_BURST", 20),
+		ProxyRequestsPerSecond: float64(utils.GetEnvInt("COD_LIMIT_PROXY_RPS", 50)),
+		ProxyBurst:             utils.GetEnvInt("COD_LIMIT_PROXY_BURST", 200),
+	}
+}
+
+// Stats are the limits with their current use and rejection counts
+type Stats struct {
+	Config      Config            `json:"config"`
+	Connections int               `json:"connections"`
+	LogSessions int               `json:"logSessions"`
+	Rejections  []RejectionCount  `json:"rejections"`
+	Clients     map[string]Usage  `json:"clients"`
+	Clusters    map[string]uint64 `json:"proxyRejectionsPerCluster,omitempty"`
+}
+
+// Usage is what one client holds
+type Usage struct {
+	Connections int `json:"connections"`
+	LogSessions int `json:"logSessions"`
+}
+
+// RejectionCount counts the requests a limit rejected
+type RejectionCount struct {
+	Limit string `json:"limit"`
+	Count uint64 `json:"count"`
+}
+
+type rejectionKey struct {
+	limit   string
+	cluster string
+}
+
+// Limiter tracks connections, log sessions and proxy request rates against their limits
+type Limiter struct {
+	config      Config
+	connections map[string]int // Per client
+	logSessions map[string]int // Per client
+	connTotal   int
+	logTotal    int
+	proxyRates  map[string]*Bucket
+	rejections  map[rejectionKey]uint64
+	mutex       sync.Mutex
+}
+
+func NewLimiter(config Config) *Limiter {
+	return &Limiter{
+		config:      config,
+		connections: make(map[string]int),
+		logSessions: make(map[string]int),
+		proxyRates:  make(map[string]*Bucket),
+		rejections:  make(map[rejectionKey]uint64),
+	}
+}
+
+// Client identifies who a request counts against: the authenticated user when known, else the
+// client's address
+func Client(user, address string) string {
+	if user != "" {
+		return "user:" + user
+	}
+	return "addr:" + address
+}
+
+// AcquireConnection reserves a WebSocket connection for a client. It returns the limit that was
+// hit, or a release func to call when the connection closes.
+func (l *Limiter) AcquireConnection(client string) (release func(), limit string) {
+	return l.acquire(client, l.connections, &l.connTotal, l.config.MaxConnections, l.config.ConnectionsPerClient,
+		LimitConnections, LimitClientConnections)
+}
+
+// AcquireLogSession reserves a log stream for a client, like AcquireConnection
+func (l *Limiter) AcquireLogSession(client string) (release func(), limit string) {
+	return l.acquire(client, l.logSessions, &l.logTotal, l.config.MaxLogSessions, l.config.LogSessionsPerClient,
+		LimitLogSessions, LimitClientLogSessions)
+}
+
+func (l *Limiter) acquire(client string, perClient map[string]int, total *int, maxTotal, maxPerClient int,
+	totalLimit, clientLimit string) (func(), string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if maxTotal > 0 && *total >= maxTotal {
+		l.rejections[rejectionKey{limit: totalLimit}]++
+		return nil, totalLimit
+	}
+	if maxPerClient > 0 && perClient[client] >= maxPerClient {
+		l.rejections[rejectionKey{limit: clientLimit}]++
+		return nil, clientLimit
+	}
+	*total++
+	perClient[client]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mutex.Lock()
+			defer l.mutex.Unlock()
+			*total--
+			if perClient[client]--; perClient[client] <= 0 {
+				delete(perClient, client)
+			}
+		})
+	}, ""
+}
+
+// NewMessageBudget returns the message rate limit of one WebSocket connection, nil when disabled
+func (l *Limiter) NewMessageBudget() *Bucket {
+	if l.config.MessagesPerSecond <= 0 {
+		return nil
+	}
+	return NewBucket(l.config.MessagesPerSecond, l.config.MessageBurst)
+}
+
+// AllowProxyRequest takes a console request of a cluster from its rate limit
+func (l *Limiter) AllowProxyRequest(cluster string) bool {
+	if l.config.ProxyRequestsPerSecond <= 0 {
+		return true
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	bucket, exists := l.proxyRates[cluster]
+	if !exists {
+		bucket = NewBucket(l.config.ProxyRequestsPerSecond, l.config.ProxyBurst)
+		l.proxyRates[cluster] = bucket
+	}
+	if bucket.Allow() {
+		return true
+	}
+	l.rejections[rejectionKey{limit: LimitProxyRate, cluster: cluster}]++
+	return false
+}
+
+// Rejected counts a rejection by a limit enforced outside the Limiter, e.g. a message budget
+func (l *Limiter) Rejected(limit string) {
+	l.mutex.Lock()
+	l.rejections[rejectionKey{limit: limit}]++
+	l.mutex.Unlock()
+}
+
+// Forget drops the proxy rate limit of a deleted cluster
+func (l *Limiter) Forget(cluster string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.proxyRates, cluster)
+	for key := range l.rejections {
+		if key.cluster == cluster {
+			delete(l.rejections, key)
+		}
+	}
+}
+
+// Stats returns the limits, their use and rejections
+func (l *Limiter) Stats() Stats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	stats := Stats{
+		Config:      l.config,
+		Connections: l.connTotal,
+		LogSessions: l.logTotal,
+		Clients:     make(map[string]Usage),
+		Clusters:    make(map[string]uint64),
+	}
+	for client, count := range l.connections {
+		usage := stats.Clients[client]
+		usage.Connections = count
+		stats.Clients[client] = usage
+	}
+	for client, count := range l.logSessions {
+		usage := stats.Clients[client]
+		usage.LogSessions = count
+		stats.Clients[client] = usage
+	}
+	totals := make(map[string]uint64)
+	for key, count := range l.rejections {
+		totals[key.limit] += count
+		if key.cluster != "" {
+			stats.Clusters[key.cluster] += count
+		}
+	}
+	for limit, count := range totals {
+		stats.Rejections = append(stats.Rejections, RejectionCount{Limit: limit, Count: count})
+	}
+	sort.Slice(stats.Rejections, func(i, j int) bool { return stats.Rejections[i].Limit < stats.Rejections[j].Limit })
+	return stats
+}
+
+// MetricFamilies exposes the current use and rejection counts as Prometheus metrics
+func (l *Limiter) MetricFamilies() []*dto.MetricFamily {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	rejections := &dto.MetricFamily{
+		Name: proto.String("cod_limit_rejections_total"),
+		Help: proto.String("Requests, connections and messages rejected by the dashboard's limits."),
+		Type: dto.MetricType_COUNTER.Enum(),
+	}
+	keys := make([]rejectionKey, 0, len(l.rejections))
+	for key := range l.rejections {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].limit != keys[j].limit {
+			return keys[i].limit < keys[j].limit
+		}
+		return keys[i].cluster < keys[j].cluster
+	})
+	for _, key := range keys {
+		labels := []*dto.LabelPair{{Name: proto.String("limit"), Value: proto.String(key.limit)}}
+		if key.cluster != "" {
+			labels = append(labels, &dto.LabelPair{Name: proto.String("cluster"), Value: proto.String(key.cluster)})
+		}
+		rejections.Metric = append(rejections.Metric, &dto.Metric{
+			Label:   labels,
+			Counter: &dto.Counter{Value: proto.Float64(float64(l.rejections[key]))},
+		})
+	}
+
+	families := []*dto.MetricFamily{
+		gauge("cod_websocket_connections", "Open dashboard WebSocket connections.", l.connTotal),
+		gauge("cod_log_sessions", "Active operator log streams of dashboard clients.", l.logTotal),
+	}
+	if len(rejections.Metric) > 0 {
+		families = append(families, rejections)
+	}
+	return families
+}
+
+func gauge(name, help string, value int) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name:   proto.String(name),
+		Help:   proto.String(help),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(float64(value))}}},
+	}
+}
+
+// Bucket is a token bucket refilling at a steady rate up to its burst
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Allow takes a token if one is left
+func (b *Bucket) Allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,120 @@
+package limits
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAcquireLogSession(t *testing.T) {
+	limiter := NewLimiter(Config{MaxLogSessions: 3, LogSessionsPerClient: 2})
+
+	first, limit := limiter.AcquireLogSession("addr:127.0.0.1")
+	if limit != "" {
+		t.Fatalf("first session rejected by %s", limit)
+	}
+	if _, limit := limiter.AcquireLogSession("addr:127.0.0.1"); limit != "" {
+		t.Fatalf("second session rejected by %s", limit)
+	}
+	if _, limit := limiter.AcquireLogSession("addr:127.0.0.1"); limit != LimitClientLogSessions {
+		t.Fatalf("third session of a client: limit %q, want %q", limit, LimitClientLogSessions)
+	}
+	if _, limit := limiter.AcquireLogSession("user:alice"); limit != "" {
+		t.Fatalf("other client rejected by %s", limit)
+	}
+	if _, limit := limiter.AcquireLogSession("user:bob"); limit != LimitLogSessions {
+		t.Fatalf("session beyond the total: limit %q, want %q", limit, LimitLogSessions)
+	}
+
+	// Releasing twice, as on a view switch and again when the stream ends, returns one session
+	first()
+	first()
+	if stats := limiter.Stats(); stats.LogSessions != 2 || stats.Clients["addr:127.0.0.1"].LogSessions != 1 {
+		t.Fatalf("after release: %+v", stats)
+	}
+	if _, limit := limiter.AcquireLogSession("addr:127.0.0.1"); limit != "" {
+		t.Fatalf("session after release rejected by %s", limit)
+	}
+
+	stats := limiter.Stats()
+	if len(stats.Rejections) != 2 || stats.Rejections[0].Limit != LimitClientLogSessions || stats.Rejections[1].Limit != LimitLogSessions {
+		t.Errorf("rejections %+v", stats.Rejections)
+	}
+}
+
+func TestAcquireConnectionUnlimited(t *testing.T) {
+	limiter := NewLimiter(Config{})
+	for i := 0; i < 100; i++ {
+		if _, limit := limiter.AcquireConnection("addr:127.0.0.1"); limit != "" {
+			t.Fatalf("connection %d rejected by %s with limits disabled", i, limit)
+		}
+	}
+}
+
+func TestAllowProxyRequest(t *testing.T) {
+	limiter := NewLimiter(Config{ProxyRequestsPerSecond: 1, ProxyBurst: 3})
+	for i := 0; i < 3; i++ {
+		if !limiter.AllowProxyRequest("dev") {
+			t.Fatalf("request %d within the burst rejected", i)
+		}
+	}
+	if limiter.AllowProxyRequest("dev") {
+		t.Fatal("request beyond the burst allowed")
+	}
+	if !limiter.AllowProxyRequest("prod") {
+		t.Fatal("another cluster's request rejected")
+	}
+	if stats := limiter.Stats(); stats.Clusters["dev"] != 1 || stats.Clusters["prod"] != 0 {
+		t.Errorf("rejections per cluster %v", stats.Clusters)
+	}
+
+	limiter.Forget("dev")
+	if !limiter.AllowProxyRequest("dev") {
+		t.Fatal("forgotten cluster still limited")
+	}
+	if stats := limiter.Stats(); stats.Clusters["dev"] != 0 {
+		t.Errorf("rejections of a forgotten cluster kept: %v", stats.Clusters)
+	}
+}
+
+func TestMetricFamilies(t *testing.T) {
+	limiter := NewLimiter(Config{MaxConnections: 1})
+	limiter.AcquireConnection("addr:127.0.0.1")
+	limiter.AcquireConnection("addr:127.0.0.1")
+
+	values := make(map[string]float64)
+	for _, mf := range limiter.MetricFamilies() {
+		for _, m := range mf.GetMetric() {
+			values[mf.GetName()] += m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	if values["cod_websocket_connections"] != 1 || values["cod_limit_rejections_total"] != 1 {
+		t.Errorf("metric values %v", values)
+	}
+}
+
+func TestBucket(t *testing.T) {
+	bucket := NewBucket(1000, 2)
+	if !bucket.Allow() || !bucket.Allow() {
+		t.Fatal("burst not available")
+	}
+	if bucket.Allow() {
+		t.Fatal("token taken beyond the burst")
+	}
+	time.Sleep(5 * time.Millisecond) // Refills at 1000 per second
+	if !bucket.Allow() {
+		t.Fatal("bucket did not refill")
+	}
+
+	if bucket := NewBucket(1, 0); !bucket.Allow() || bucket.Allow() {
+		t.Error("a burst below 1 must allow exactly one request")
+	}
+}
+
+func TestClient(t *testing.T) {
+	if got := Client("alice", "10.0.0.1"); got != "user:alice" {
+		t.Errorf("Client() = %q", got)
+	}
+	if got := Client("", "10.0.0.1"); got != "addr:10.0.0.1" {
+		t.Errorf("Client() = %q", got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"cod/internal/logger"
@@ -169,3 +170,128 @@ func StartLogWatcher(ctx context.Context, clientset *kubernetes.Clientset, broad
 		}
 	}
 }
+
+// FollowOperatorLogs continuously streams the operator's log and hands every line to handleLine.
+// Unlike StartLogWatcher it is not tied to a client session: the stream is re-established
+// after errors until ctx is canceled, resuming from the last line seen. Every running operator
+// replica is followed, as only the leader reconciles and leadership can move at any time.
+func FollowOperatorLogs(ctx context.Context, clientset *kubernetes.Clientset, namespace string, handleLine func(line string)) {
+	started := time.Now()
+	retryDelay := 10 * time.Second
+	followers := make(map[string]*podFollower)
+
+	for {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: "app=couchbase-operator",
+		})
+		if err != nil || len(pods.Items) == 0 {
+			logger.Log.Debug("Operator pod not available for log following",
+				zap.Error(err),
+				zap.String("namespace", namespace))
+		}
+
+		listed := make(map[string]bool)
+		if err == nil {
+			for _, pod := range pods.Items {
+				if pod.Status.Phase != v1.PodRunning {
+					continue
+				}
+				listed[pod.Name] = true
+				follower, exists := followers[pod.Name]
+				if !exists {
+					// Replicas started later are read from their start, e.g. a new leader's first reconciles
+					follower = &podFollower{since: started}
+					if pod.CreationTimestamp.Time.After(started) {
+						follower.since = pod.CreationTimestamp.Time
+					}
+					followers[pod.Name] = follower
+				} else if follower.running() {
+					continue
+				}
+				follower.done = make(chan struct{})
+				go func(podName string, follower *podFollower) {
+					defer close(follower.done)
+					follower.follow(ctx, clientset, namespace, podName, handleLine)
+				}(pod.Name, follower)
+			}
+		}
+		for podName, follower := range followers {
+			if !listed[podName] && !follower.running() {
+				delete(followers, podName)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// podFollower streams the log of one operator pod, remembering where it stopped. The API server
+// resumes from whole seconds, so lines are read with their timestamps and those already handled
+// are skipped after reconnecting.
+type podFollower struct {
+	since  time.Time     // Timestamp of the last line handled
+	atLast int           // Lines handled with exactly that timestamp
+	done   chan struct{} // Closed when the current stream ends
+}
+
+func (f *podFollower) running() bool {
+	if f.done == nil {
+		return false
+	}
+	select {
+	case <-f.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (f *podFollower) follow(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string, handleLine func(line string)) {
+	sinceTime := metav1.NewTime(f.since)
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &v1.PodLogOptions{
+		Container:  "couchbase-operator",
+		Follow:     true,
+		Timestamps: true,
+		SinceTime:  &sinceTime,
+	}).Stream(ctx)
+	if err != nil {
+		logger.Log.Warn("Failed to establish operator log stream",
+			zap.Error(err),
+			zap.String("podName", podName))
+		return
+	}
+	defer stream.Close()
+	logger.Log.Debug("Following operator logs", zap.String("podName", podName))
+
+	reader := bufio.NewReader(stream)
+	skipped := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		stamp, text, found := strings.Cut(line, " ")
+		at, err := time.Parse(time.RFC3339Nano, stamp)
+		if !found || err != nil {
+			handleLine(line)
+			continue
+		}
+		switch {
+		case at.Before(f.since):
+			continue // Replayed from the second the stream resumed in
+		case at.Equal(f.since):
+			if skipped < f.atLast {
+				skipped++
+				continue
+			}
+			f.atLast++
+		default:
+			f.since, f.atLast = at, 1
+		}
+		handleLine(text)
+	}
+}
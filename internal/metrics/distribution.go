@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefaultQuantiles are computed for histograms when none are requested
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Quantile is the estimated value below which a fraction of the observations fall
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// DistributionStats summarise the observations of a histogram or summary series.
+// Average and Rate are null when they are undefined, e.g. without observations.
+type DistributionStats struct {
+	Count     float64    `json:"count"`
+	Sum       float64    `json:"sum"`
+	Average   *float64   `json:"average"`
+	Rate      *float64   `json:"rate"` // Observations per second; only set over a window
+	Quantiles []Quantile `json:"quantiles"`
+}
+
+// DistributionSeries are the stats of one label set, since the process started and
+// over the requested window of the metrics history
+type DistributionSeries struct {
+	Labels  map[string]string  `json:"labels"`
+	Current DistributionStats  `json:"current"`
+	Window  *DistributionStats `json:"window"` // Null until the history holds two scrapes in the window
+}
+
+// Distribution is a histogram or summary family
+type Distribution struct {
+	Name   string               `json:"name"`
+	Type   string               `json:"type"`
+	Help   string               `json:"help,omitempty"`
+	Series []DistributionSeries `json:"series"`
+}
+
+// bucket is a cumulative histogram bucket
+type bucket struct {
+	upperBound float64
+	count      float64
+}
+
+// Distributions computes the stats of the histogram and summary families. Histogram quantiles
+// are estimated from the buckets; summaries report the quantiles they expose.
+func Distributions(families []*dto.MetricFamily, quantiles []float64) []Distribution {
+	var result []Distribution
+	for _, mf := range families {
+		var distribution Distribution
+		switch mf.GetType() {
+		case dto.MetricType_HISTOGRAM:
+			distribution.Type = "histogram"
+		case dto.MetricType_SUMMARY:
+			distribution.Type = "summary"
+		default:
+			continue
+		}
+		distribution.Name = mf.GetName()
+		distribution.Help = mf.GetHelp()
+		distribution.Series = []DistributionSeries{}
+
+		for _, m := range mf.GetMetric() {
+			var stats DistributionStats
+			if histogram := m.GetHistogram(); histogram != nil {
+				stats = newStats(float64(histogram.GetSampleCount()), histogram.GetSampleSum())
+				stats.Quantiles = histogramQuantiles(quantiles, cumulativeBuckets(histogram))
+			} else if summary := m.GetSummary(); summary != nil {
+				stats = newStats(float64(summary.GetSampleCount()), summary.GetSampleSum())
+				for _, q := range summary.GetQuantile() {
+					if !math.IsNaN(q.GetValue()) {
+						stats.Quantiles = append(stats.Quantiles, Quantile{q.GetQuantile(), q.GetValue()})
+					}
+				}
+			}
+			distribution.Series = append(distribution.Series, DistributionSeries{Labels: labelMap(m), Current: stats})
+		}
+		result = append(result, distribution)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// cumulativeBuckets returns the buckets of a histogram ending with +Inf, which is implicit
+// in the protobuf exposition and equals the sample count
+func cumulativeBuckets(histogram *dto.Histogram) []bucket {
+	buckets := make([]bucket, 0, len(histogram.GetBucket())+1)
+	for _, b := range histogram.GetBucket() {
+		buckets = append(buckets, bucket{b.GetUpperBound(), float64(b.GetCumulativeCount())})
+	}
+	if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].upperBound, 1) {
+		buckets = append(buckets, bucket{math.Inf(1), float64(histogram.GetSampleCount())})
+	}
+	return buckets
+}
+
+func newStats(count, sum float64) DistributionStats {
+	stats := DistributionStats{Count: count, Sum: sum, Quantiles: []Quantile{}}
+	if count > 0 {
+		average := sum / count
+		stats.Average = &average
+	}
+	return stats
+}
+
+// Window computes the stats of a histogram or summary series from the increases of its
+// counters over the window ending at the given time
+func (h *History) Window(distribution Distribution, labels map[string]string, window time.Duration, at time.Time, quantiles []float64) *DistributionStats {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	from, to := at.Add(-window).UnixMilli(), at.UnixMilli()
+	count := h.series[seriesKey(distribution.Name+"_count", labels)]
+	sum := h.series[seriesKey(distribution.Name+"_sum", labels)]
+	if count == nil || sum == nil {
+		return nil
+	}
+	countPoints := count.between(from, to)
+	sumPoints := sum.between(from, to)
+	if len(countPoints) < 2 || len(sumPoints) < 2 {
+		return nil
+	}
+
+	stats := newStats(counterIncrease(countPoints), counterIncrease(sumPoints))
+	if elapsed := float64(countPoints[len(countPoints)-1].T-countPoints[0].T) / 1000; elapsed > 0 {
+		rate := stats.Count / elapsed
+		stats.Rate = &rate
+	}
+
+	switch distribution.Type {
+	case "histogram":
+		stats.Quantiles = histogramQuantiles(quantiles, h.bucketIncreases(distribution.Name, labels, from, to))
+	case "summary":
+		// Summary quantiles are already computed over a sliding window by the client
+		for _, s := range h.series {
+			if s.name != distribution.Name || !sameLabelsExcept(s.labels, labels, "quantile") {
+				continue
+			}
+			points := s.between(from, to)
+			q, err := strconv.ParseFloat(s.labels["quantile"], 64)
+			if len(points) == 0 || err != nil || math.IsNaN(points[len(points)-1].V) {
+				continue
+			}
+			stats.Quantiles = append(stats.Quantiles, Quantile{q, points[len(points)-1].V})
+		}
+		sort.Slice(stats.Quantiles, func(i, j int) bool { return stats.Quantiles[i].Quantile < stats.Quantiles[j].Quantile })
+	}
+	return &stats
+}
+
+// bucketIncreases returns the increase of each bucket of a histogram series between from and to
+func (h *History) bucketIncreases(name string, labels map[string]string, from, to int64) []bucket {
+	var buckets []bucket
+	for _, s := range h.series {
+		if s.name != name+"_bucket" || !sameLabelsExcept(s.labels, labels, "le") {
+			continue
+		}
+		upperBound, err := strconv.ParseFloat(s.labels["le"], 64)
+		if err != nil {
+			continue
+		}
+		points := s.between(from, to)
+		if len(points) < 2 {
+			continue
+		}
+		buckets = append(buckets, bucket{upperBound, counterIncrease(points)})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].upperBound < buckets[j].upperBound })
+	return buckets
+}
+
+// histogramQuantiles estimates each quantile, leaving out those that are undefined
+func histogramQuantiles(quantiles []float64, buckets []bucket) []Quantile {
+	result := []Quantile{}
+	for _, q := range quantiles {
+		if value := histogramQuantile(q, buckets); !math.IsNaN(value) {
+			result = append(result, Quantile{q, value})
+		}
+	}
+	return result
+}
+
+// histogramQuantile interpolates linearly within the bucket holding the quantile's rank, as
+// Prometheus' histogram_quantile does. Buckets must be sorted and end with +Inf.
+func histogramQuantile(q float64, buckets []bucket) float64 {
+	if len(buckets) < 2 || !math.IsInf(buckets[len(buckets)-1].upperBound, 1) || q < 0 || q > 1 {
+		return math.NaN()
+	}
+
+	// Increases of separate series can leave the cumulative counts slightly non-monotonic
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i].count < buckets[i-1].count {
+			buckets[i].count = buckets[i-1].count
+		}
+	}
+
+	total := buckets[len(buckets)-1].count
+	if total == 0 {
+		return math.NaN()
+	}
+	rank := q * total
+	i := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].count >= rank })
+
+	if i == len(buckets)-1 {
+		// The quantile falls in the +Inf bucket; the highest finite bound is the best estimate
+		return buckets[len(buckets)-2].upperBound
+	}
+	if i == 0 && buckets[0].upperBound <= 0 {
+		return buckets[0].upperBound
+	}
+
+	var start, below float64
+	if i > 0 {
+		start, below = buckets[i-1].upperBound, buckets[i-1].count
+	}
+	inBucket := buckets[i].count - below
+	if inBucket == 0 {
+		return buckets[i].upperBound
+	}
+	return start + (buckets[i].upperBound-start)*(rank-below)/inBucket
+}
+
+// sameLabelsExcept reports whether labels equal want after dropping the named label
+func sameLabelsExcept(labels, want map[string]string, except string) bool {
+	if _, has := labels[except]; !has || len(labels) != len(want)+1 {
+		return false
+	}
+	for name, value := range want {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
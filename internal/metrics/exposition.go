@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/munnerz/goautoneg"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prom2json"
+)
+
+// Exposition formats served by /metrics
+const (
+	FormatText        = "text"
+	FormatOpenMetrics = "openmetrics"
+	FormatProtobuf    = "protobuf"
+	FormatJSON        = "json"
+	FormatCSV         = "csv"
+)
+
+// formatMediaTypes maps media types to formats, in order of preference for wildcard requests
+var formatMediaTypes = []struct {
+	mediaType string
+	format    string
+}{
+	{"text/plain", FormatText},
+	{"application/openmetrics-text", FormatOpenMetrics},
+	{"application/vnd.google.protobuf", FormatProtobuf},
+	{"application/json", FormatJSON},
+	{"text/csv", FormatCSV},
+}
+
+// Negotiate picks the response format from the format query parameter or the Accept header,
+// defaulting to the Prometheus text format
+func Negotiate(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		for _, entry := range formatMediaTypes {
+			if entry.format == format {
+				return format, nil
+			}
+		}
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+
+	alternatives := make([]string, 0, len(formatMediaTypes))
+	for _, entry := range formatMediaTypes {
+		alternatives = append(alternatives, entry.mediaType)
+	}
+	chosen := goautoneg.Negotiate(r.Header.Get("Accept"), alternatives)
+	for _, entry := range formatMediaTypes {
+		if entry.mediaType == chosen {
+			return entry.format, nil
+		}
+	}
+	return FormatText, nil
+}
+
+// expfmtFormat returns the exposition format to encode with, honouring the OpenMetrics
+// version requested by the client
+func expfmtFormat(format string, header http.Header) expfmt.Format {
+	switch format {
+	case FormatOpenMetrics:
+		if negotiated := expfmt.NegotiateIncludingOpenMetrics(header); negotiated.FormatType() == expfmt.TypeOpenMetrics {
+			return negotiated
+		}
+		return expfmt.FmtOpenMetrics_1_0_0
+	case FormatProtobuf:
+		return expfmt.NewFormat(expfmt.TypeProtoDelim)
+	default:
+		return expfmt.NewFormat(expfmt.TypeTextPlain)
+	}
+}
+
+// ContentType returns the Content-Type header of a format
+func ContentType(format string, header http.Header) string {
+	switch format {
+	case FormatJSON:
+		return "application/json"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return string(expfmtFormat(format, header))
+	}
+}
+
+// Encode writes the families in the given format. Exemplars are only kept by OpenMetrics
+// and protobuf.
+func Encode(w io.Writer, format string, header http.Header, families []*dto.MetricFamily) error {
+	switch format {
+	case FormatJSON:
+		result := make([]*prom2json.Family, 0, len(families))
+		for _, mf := range families {
+			result = append(result, prom2json.NewFamily(mf))
+		}
+		return json.NewEncoder(w).Encode(result)
+	case FormatCSV:
+		return writeCSV(w, families)
+	}
+
+	encoder := expfmt.NewEncoder(w, expfmtFormat(format, header))
+	for _, mf := range families {
+		if err := encoder.Encode(mf); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", mf.GetName(), err)
+		}
+	}
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// csvSample is one row of the CSV export
+type csvSample struct {
+	name      string
+	kind      string
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// writeCSV writes one row per sample with a column per label name, for spreadsheet export.
+// Histograms and summaries are expanded into their _bucket, quantile, _sum and _count samples.
+func writeCSV(w io.Writer, families []*dto.MetricFamily) error {
+	var samples []csvSample
+	labelNames := make(map[string]bool)
+	add := func(name, kind string, labels map[string]string, value float64, timestamp int64) {
+		for label := range labels {
+			labelNames[label] = true
+		}
+		samples = append(samples, csvSample{name, kind, labels, value, timestamp})
+	}
+
+	for _, mf := range families {
+		name := mf.GetName()
+		kind := strings.ToLower(mf.GetType().String())
+		for _, m := range mf.GetMetric() {
+			labels := labelMap(m)
+			timestamp := m.GetTimestampMs()
+			switch mf.GetType() {
+			case dto.MetricType_HISTOGRAM:
+				histogram := m.GetHistogram()
+				for _, bucket := range cumulativeBuckets(histogram) {
+					add(name+"_bucket", kind, withLabel(labels, "le", formatBound(bucket.upperBound)), bucket.count, timestamp)
+				}
+				add(name+"_sum", kind, labels, histogram.GetSampleSum(), timestamp)
+				add(name+"_count", kind, labels, float64(histogram.GetSampleCount()), timestamp)
+			case dto.MetricType_SUMMARY:
+				summary := m.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					add(name, kind, withLabel(labels, "quantile", formatBound(quantile.GetQuantile())), quantile.GetValue(), timestamp)
+				}
+				add(name+"_sum", kind, labels, summary.GetSampleSum(), timestamp)
+				add(name+"_count", kind, labels, float64(summary.GetSampleCount()), timestamp)
+			default:
+				add(name, kind, labels, sampleValue(m), timestamp)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(labelNames))
+	for name := range labelNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writer := csv.NewWriter(w)
+	header := append([]string{"metric", "type"}, names...)
+	if err := writer.Write(append(header, "value", "timestamp_ms")); err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		row := make([]string, 0, len(names)+4)
+		row = append(row, sample.name, sample.kind)
+		for _, name := range names {
+			row = append(row, sample.labels[name])
+		}
+		row = append(row, strconv.FormatFloat(sample.value, 'g', -1, 64), "")
+		if sample.timestamp != 0 {
+			row[len(row)-1] = strconv.FormatInt(sample.timestamp, 10)
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// FilterClusters keeps the series labelled with one of the clusters. Families without
+// such series are dropped.
+func FilterClusters(families []*dto.MetricFamily, clusters []string) []*dto.MetricFamily {
+	wanted := make(map[string]bool, len(clusters))
+	for _, cluster := range clusters {
+		wanted[cluster] = true
+	}
+
+	var result []*dto.MetricFamily
+	for _, mf := range families {
+		var metrics []*dto.Metric
+		for _, m := range mf.GetMetric() {
+			if wanted[ClusterLabel(m)] {
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) > 0 {
+			result = append(result, &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type, Unit: mf.Unit, Metric: metrics})
+		}
+	}
+	return result
+}
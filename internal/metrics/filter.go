@@ -0,0 +1,340 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"cod/internal/logger"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Selector matches metric families by exact name or regular expression, optionally
+// narrowed to the series whose labels satisfy every matcher
+type Selector struct {
+	Name     string   `json:"name,omitempty"`
+	Regex    string   `json:"regex,omitempty"`    // Anchored: must match the whole name
+	Matchers []string `json:"matchers,omitempty"` // PromQL-style, e.g. bucket!~"_system.*"
+}
+
+// FilterConfig selects the metrics exposed by the dashboard. A series is exposed when it
+// matches an include selector and no exclude selector.
+type FilterConfig struct {
+	Include []Selector `json:"include"`
+	Exclude []Selector `json:"exclude,omitempty"`
+}
+
+// DefaultFilterConfig exposes the operator's cluster management metrics and the dashboard's limits
+func DefaultFilterConfig() FilterConfig {
+	return FilterConfig{
+		Include: []Selector{
+			{Name: "couchbase_operator_cpu_under_management"},
+			{Name: "couchbase_operator_in_place_upgrade_failures"},
+			{Name: "couchbase_operator_memory_under_management_bytes"},
+			{Name: "couchbase_operator_reconcile_failures"},
+			{Name: "couchbase_operator_pod_replacements_failed"},
+			{Name: "couchbase_operator_pod_recovery_failures_total"},
+			{Name: "couchbase_operator_pod_recoveries_total"},
+			{Name: "couchbase_operator_swap_rebalance_failures"},
+			{Name: "couchbase_operator_swap_rebalances_total"},
+			{Name: "couchbase_operator_volume_size_under_management_bytes"},
+			{Name: "couchbase_operator_pod_replacements_total"},
+			{Name: "couchbase_operator_in_place_upgrades_total"},
+			{Name: "cod_websocket_connections"},
+			{Name: "cod_log_sessions"},
+			{Name: "cod_limit_rejections_total"},
+		},
+	}
+}
+
+// labelMatcher is a parsed PromQL-style label matcher
+type labelMatcher struct {
+	name  string
+	op    string // =, !=, =~ or !~
+	value string
+	regex *regexp.Regexp
+}
+
+var matcherPattern = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*"(.*)"\s*$`)
+
+func parseMatcher(text string) (labelMatcher, error) {
+	parts := matcherPattern.FindStringSubmatch(text)
+	if parts == nil {
+		return labelMatcher{}, fmt.Errorf("invalid label matcher %q, expected e.g. label=\"value\"", text)
+	}
+	matcher := labelMatcher{name: parts[1], op: parts[2], value: parts[3]}
+	if matcher.op == "=~" || matcher.op == "!~" {
+		regex, err := regexp.Compile("^(?:" + matcher.value + ")$")
+		if err != nil {
+			return labelMatcher{}, fmt.Errorf("invalid regular expression in matcher %q: %w", text, err)
+		}
+		matcher.regex = regex
+	}
+	return matcher, nil
+}
+
+func (m labelMatcher) matches(labels map[string]string) bool {
+	value := labels[m.name]
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.regex.MatchString(value)
+	default:
+		return !m.regex.MatchString(value)
+	}
+}
+
+// compiledSelector is a Selector ready for matching
+type compiledSelector struct {
+	name     string
+	regex    *regexp.Regexp
+	matchers []labelMatcher
+}
+
+func compileSelectors(selectors []Selector) ([]compiledSelector, error) {
+	compiled := make([]compiledSelector, 0, len(selectors))
+	for i, selector := range selectors {
+		if (selector.Name == "") == (selector.Regex == "") {
+			return nil, fmt.Errorf("selector %d must set exactly one of name or regex", i)
+		}
+		entry := compiledSelector{name: selector.Name}
+		if selector.Regex != "" {
+			regex, err := regexp.Compile("^(?:" + selector.Regex + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("selector %d: invalid regex: %w", i, err)
+			}
+			entry.regex = regex
+		}
+		for _, text := range selector.Matchers {
+			matcher, err := parseMatcher(text)
+			if err != nil {
+				return nil, fmt.Errorf("selector %d: %w", i, err)
+			}
+			entry.matchers = append(entry.matchers, matcher)
+		}
+		compiled = append(compiled, entry)
+	}
+	return compiled, nil
+}
+
+func (c compiledSelector) matchesName(name string) bool {
+	if c.regex != nil {
+		return c.regex.MatchString(name)
+	}
+	return c.name == name
+}
+
+func (c compiledSelector) matchesLabels(labels map[string]string) bool {
+	for _, matcher := range c.matchers {
+		if !matcher.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// compiledFilter is an immutable, compiled FilterConfig
+type compiledFilter struct {
+	config  FilterConfig
+	include []compiledSelector
+	exclude []compiledSelector
+}
+
+func compileFilter(config FilterConfig) (*compiledFilter, error) {
+	include, err := compileSelectors(config.Include)
+	if err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	exclude, err := compileSelectors(config.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	return &compiledFilter{config: config, include: include, exclude: exclude}, nil
+}
+
+// Filter applies a FilterConfig that can be reloaded from a file while in use
+type Filter struct {
+	path     string // YAML or JSON file; empty uses the default config
+	current  *compiledFilter
+	modTime  time.Time
+	loadedAt time.Time
+	mutex    sync.RWMutex
+}
+
+// NewFilter loads the filter from path, or uses the default config when path is empty
+func NewFilter(path string) (*Filter, error) {
+	filter := &Filter{path: path}
+	if err := filter.Reload(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Reload re-reads the filter file. On error the previous filter stays in effect.
+func (f *Filter) Reload() error {
+	config := DefaultFilterConfig()
+	var modTime time.Time
+	if f.path != "" {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			return err
+		}
+		modTime = info.ModTime()
+
+		file, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		config = FilterConfig{}
+		if err := yaml.NewYAMLOrJSONDecoder(file, 4096).Decode(&config); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", f.path, err)
+		}
+	}
+
+	compiled, err := compileFilter(config)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	f.current = compiled
+	f.modTime = modTime
+	f.loadedAt = time.Now()
+	f.mutex.Unlock()
+
+	logger.Log.Info("Loaded metrics filter",
+		zap.String("file", f.path),
+		zap.Int("include", len(config.Include)),
+		zap.Int("exclude", len(config.Exclude)))
+	return nil
+}
+
+// Watch reloads the filter whenever its file changes, e.g. when a mounted ConfigMap is updated
+func (f *Filter) Watch(stop <-chan struct{}, interval time.Duration) {
+	if f.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(f.path)
+		if err != nil {
+			logger.Log.Warn("Failed to check metrics filter file", zap.Error(err), zap.String("file", f.path))
+			continue
+		}
+		f.mutex.RLock()
+		changed := !info.ModTime().Equal(f.modTime)
+		f.mutex.RUnlock()
+
+		if changed {
+			if err := f.Reload(); err != nil {
+				logger.Log.Error("Failed to reload metrics filter, keeping the previous one",
+					zap.Error(err),
+					zap.String("file", f.path))
+			}
+		}
+	}
+}
+
+// Config returns the filter config in effect and when it was loaded
+func (f *Filter) Config() (FilterConfig, time.Time) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.current.config, f.loadedAt
+}
+
+// Apply returns the families and series selected by the filter. The input is not modified.
+func (f *Filter) Apply(families []*dto.MetricFamily) []*dto.MetricFamily {
+	f.mutex.RLock()
+	current := f.current
+	f.mutex.RUnlock()
+
+	var result []*dto.MetricFamily
+	for _, mf := range families {
+		name := mf.GetName()
+
+		var includes, excludes []compiledSelector
+		for _, selector := range current.include {
+			if selector.matchesName(name) {
+				includes = append(includes, selector)
+			}
+		}
+		if len(includes) == 0 {
+			continue
+		}
+		for _, selector := range current.exclude {
+			if selector.matchesName(name) {
+				excludes = append(excludes, selector)
+			}
+		}
+
+		metrics := make([]*dto.Metric, 0, len(mf.GetMetric()))
+		for _, m := range mf.GetMetric() {
+			labels := labelMap(m)
+			if selectsSeries(includes, labels) && !selectsSeries(excludes, labels) {
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+
+		filtered := &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type, Unit: mf.Unit, Metric: metrics}
+		result = append(result, filtered)
+	}
+	return result
+}
+
+// Selects tells whether the filter exposes a series of the named family. With nil labels, it tells
+// whether the filter may expose any series of the family, for checks before the series are known.
+func (f *Filter) Selects(name string, labels map[string]string) bool {
+	f.mutex.RLock()
+	current := f.current
+	f.mutex.RUnlock()
+
+	included := false
+	for _, selector := range current.include {
+		if selector.matchesName(name) && (labels == nil || selector.matchesLabels(labels)) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, selector := range current.exclude {
+		if !selector.matchesName(name) {
+			continue
+		}
+		if labels == nil && len(selector.matchers) == 0 || labels != nil && selector.matchesLabels(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func selectsSeries(selectors []compiledSelector, labels map[string]string) bool {
+	for _, selector := range selectors {
+		if selector.matchesLabels(labels) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,368 @@
+package metrics
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/logger"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// Point is a single sample, timestamped in Unix milliseconds
+type Point struct {
+	T int64   `json:"t"`
+	V float64 `json:"v"`
+}
+
+// Family describes a scraped metric family
+type Family struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Help   string `json:"help,omitempty"`
+	Series int    `json:"series"`
+}
+
+// series is a ring buffer of the samples of one label set
+type series struct {
+	name     string
+	family   string // Family the series belongs to, e.g. "x" for "x_bucket"
+	kind     string // counter or gauge, decides whether rates apply
+	labels   map[string]string
+	points   []Point // Ring buffer storage, grown up to capacity
+	capacity int
+	head     int // Index of the oldest point
+	count    int
+}
+
+func (s *series) append(point Point) {
+	// Scrapes can overlap with a restored snapshot; keep timestamps increasing
+	if s.count > 0 && point.T <= s.at(s.count-1).T {
+		return
+	}
+	// Until the ring is full, head stays at 0 and points are appended
+	if s.count < s.capacity {
+		s.points = append(s.points, point)
+		s.count++
+		return
+	}
+	s.points[s.head] = point
+	s.head = (s.head + 1) % len(s.points)
+}
+
+func (s *series) at(i int) Point {
+	return s.points[(s.head+i)%len(s.points)]
+}
+
+// between returns the points with from < T <= to, oldest first
+func (s *series) between(from, to int64) []Point {
+	first := sort.Search(s.count, func(i int) bool { return s.at(i).T > from })
+	var points []Point
+	for i := first; i < s.count && s.at(i).T <= to; i++ {
+		points = append(points, s.at(i))
+	}
+	return points
+}
+
+// History keeps a bounded in-memory time series of scraped metrics
+type History struct {
+	series    map[string]*series
+	families  map[string]Family
+	capacity  int // Points retained per series
+	interval  time.Duration
+	retention time.Duration
+	latest    []*dto.MetricFamily // Last scrape, unfiltered, for the alert engine and reconcile tracker
+	latestAt  time.Time
+	mutex     sync.RWMutex
+}
+
+func NewHistory(interval, retention time.Duration) *History {
+	capacity := int(retention / interval)
+	if capacity < 2 {
+		capacity = 2
+	}
+	return &History{
+		series:    make(map[string]*series),
+		families:  make(map[string]Family),
+		capacity:  capacity,
+		interval:  interval,
+		retention: retention,
+	}
+}
+
+// Append records a scrape. Histograms and summaries are stored as their
+// _bucket, _sum and _count (and quantile) series.
+func (h *History) Append(families []*dto.MetricFamily, at time.Time) {
+	t := at.UnixMilli()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, mf := range families {
+		name := mf.GetName()
+		family := Family{Name: name, Type: strings.ToLower(mf.GetType().String()), Help: mf.GetHelp()}
+
+		for _, m := range mf.GetMetric() {
+			labels := labelMap(m)
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				h.appendSample(name, name, "counter", labels, Point{t, m.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				h.appendSample(name, name, "gauge", labels, Point{t, m.GetGauge().GetValue()})
+			case dto.MetricType_UNTYPED:
+				h.appendSample(name, name, "gauge", labels, Point{t, m.GetUntyped().GetValue()})
+			case dto.MetricType_HISTOGRAM:
+				histogram := m.GetHistogram()
+				for _, bucket := range cumulativeBuckets(histogram) {
+					h.appendSample(name+"_bucket", name, "counter", withLabel(labels, "le", formatBound(bucket.upperBound)),
+						Point{t, bucket.count})
+				}
+				h.appendSample(name+"_sum", name, "counter", labels, Point{t, histogram.GetSampleSum()})
+				h.appendSample(name+"_count", name, "counter", labels, Point{t, float64(histogram.GetSampleCount())})
+			case dto.MetricType_SUMMARY:
+				summary := m.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					h.appendSample(name, name, "gauge", withLabel(labels, "quantile", formatBound(quantile.GetQuantile())),
+						Point{t, quantile.GetValue()})
+				}
+				h.appendSample(name+"_sum", name, "counter", labels, Point{t, summary.GetSampleSum()})
+				h.appendSample(name+"_count", name, "counter", labels, Point{t, float64(summary.GetSampleCount())})
+			}
+		}
+		h.families[name] = family
+	}
+	h.prune(t - h.retention.Milliseconds())
+}
+
+// prune drops the series without points since cutoff, e.g. of deleted clusters or replaced
+// operator pods, and the families left without series
+func (h *History) prune(cutoff int64) {
+	live := make(map[string]bool)
+	for key, s := range h.series {
+		if s.count == 0 || s.at(s.count-1).T <= cutoff {
+			delete(h.series, key)
+			continue
+		}
+		live[s.family] = true
+	}
+	for name := range h.families {
+		if !live[name] {
+			delete(h.families, name)
+		}
+	}
+}
+
+func (h *History) appendSample(name, family, kind string, labels map[string]string, point Point) {
+	key := seriesKey(name, labels)
+	s, exists := h.series[key]
+	if !exists {
+		s = &series{name: name, family: family, kind: kind, labels: labels, capacity: h.capacity}
+		h.series[key] = s
+	}
+	s.append(point)
+}
+
+// Families lists the scraped metric families with their number of stored series
+func (h *History) Families() []Family {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	counts := make(map[string]int)
+	for _, s := range h.series {
+		// Histograms and summaries have one _count series per label set
+		if s.name == s.family || s.name == s.family+"_count" {
+			counts[s.family]++
+		}
+	}
+
+	families := make([]Family, 0, len(h.families))
+	for name, family := range h.families {
+		family.Series = counts[name]
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// Latest returns the last scrape with every family, filtered or not, so that other consumers of
+// operator metrics need not scrape again. It fails when the last scrape is older than two intervals.
+func (h *History) Latest() ([]*dto.MetricFamily, error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.latestAt.IsZero() {
+		return nil, errors.New("operator metrics not scraped yet")
+	}
+	if age := time.Since(h.latestAt); age > 2*h.interval {
+		return nil, fmt.Errorf("last operator metrics scrape is %s old", age.Round(time.Second))
+	}
+	return h.latest, nil
+}
+
+// Run scrapes every interval, keeping the series selected by filter, and when persistPath
+// is set, periodically saves the history to disk
+func (h *History) Run(ctx context.Context,
+	fetch func(ctx context.Context) ([]*dto.MetricFamily, error),
+	filter func(families []*dto.MetricFamily) []*dto.MetricFamily,
+	persistPath string) {
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	lastSaved := time.Now()
+
+	for {
+		families, err := fetch(ctx)
+		if err != nil {
+			logger.Log.Debug("Failed to scrape operator metrics for history", zap.Error(err))
+		} else {
+			now := time.Now()
+			h.mutex.Lock()
+			h.latest, h.latestAt = families, now
+			h.mutex.Unlock()
+			h.Append(filter(families), now)
+		}
+
+		if persistPath != "" && time.Since(lastSaved) >= 5*time.Minute {
+			h.save(persistPath)
+			lastSaved = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			if persistPath != "" {
+				h.save(persistPath)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// persistedSeries is the on-disk form of a series
+type persistedSeries struct {
+	Name   string
+	Family string
+	Kind   string
+	Labels map[string]string
+	Points []Point
+}
+
+// persistedHistory is the on-disk form of the history
+type persistedHistory struct {
+	Families map[string]Family
+	Series   []persistedSeries
+}
+
+func (h *History) save(path string) {
+	h.mutex.RLock()
+	snapshot := persistedHistory{Families: make(map[string]Family, len(h.families))}
+	for name, family := range h.families {
+		snapshot.Families[name] = family
+	}
+	for _, s := range h.series {
+		points := make([]Point, s.count)
+		for i := range points {
+			points[i] = s.at(i)
+		}
+		snapshot.Series = append(snapshot.Series, persistedSeries{Name: s.name, Family: s.family, Kind: s.kind, Labels: s.labels, Points: points})
+	}
+	h.mutex.RUnlock()
+
+	// Write to a temporary file first so a crash never leaves a truncated snapshot
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".metrics-history-*")
+	if err != nil {
+		logger.Log.Warn("Failed to save metrics history", zap.Error(err), zap.String("path", path))
+		return
+	}
+	if err := gob.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		logger.Log.Warn("Failed to encode metrics history", zap.Error(err), zap.String("path", path))
+		return
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		logger.Log.Warn("Failed to save metrics history", zap.Error(err), zap.String("path", path))
+		return
+	}
+	logger.Log.Debug("Saved metrics history", zap.String("path", path), zap.Int("series", len(snapshot.Series)))
+}
+
+// Load restores a history saved by a previous run, dropping points older than the retention
+func (h *History) Load(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Log.Warn("Failed to open metrics history", zap.Error(err), zap.String("path", path))
+		}
+		return
+	}
+	defer file.Close()
+
+	var snapshot persistedHistory
+	if err := gob.NewDecoder(file).Decode(&snapshot); err != nil {
+		logger.Log.Warn("Failed to decode metrics history, starting empty", zap.Error(err), zap.String("path", path))
+		return
+	}
+
+	cutoff := time.Now().Add(-h.retention).UnixMilli()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for name, family := range snapshot.Families {
+		h.families[name] = family
+	}
+	for _, persisted := range snapshot.Series {
+		for _, point := range persisted.Points {
+			if point.T > cutoff {
+				h.appendSample(persisted.Name, persisted.Family, persisted.Kind, persisted.Labels, point)
+			}
+		}
+	}
+	logger.Log.Info("Restored metrics history", zap.String("path", path), zap.Int("series", len(snapshot.Series)))
+}
+
+func labelMap(m *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(m.GetLabel()))
+	for _, label := range m.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	return labels
+}
+
+func withLabel(labels map[string]string, name, value string) map[string]string {
+	extended := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		extended[k] = v
+	}
+	extended[name] = value
+	return extended
+}
+
+func seriesKey(name string, labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	builder.WriteString(name)
+	for _, label := range names {
+		builder.WriteByte('|')
+		builder.WriteString(label)
+		builder.WriteByte('=')
+		builder.WriteString(labels[label])
+	}
+	return builder.String()
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// OperatorMetricsURL is the operator's Prometheus endpoint when running as a sidecar in the operator pod
+const OperatorMetricsURL = "http://localhost:8383/metrics"
+
+// ErrNotFound is returned when the endpoint does not serve metrics at the requested path
+var ErrNotFound = errors.New("metrics endpoint not found")
+
+// Fetch retrieves and parses the Prometheus metric families exposed at url
+func Fetch(ctx context.Context, url string) ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return FetchRequest(http.DefaultClient, req)
+}
+
+// acceptHeader prefers the protobuf exposition, which unlike the text format carries exemplars
+const acceptHeader = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3`
+
+// FetchRequest is Fetch for a prepared request, e.g. one carrying credentials
+func FetchRequest(client *http.Client, req *http.Request) ([]*dto.MetricFamily, error) {
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", acceptHeader)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, req.URL.Redacted())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status %s from %s", resp.Status, req.URL.Redacted())
+	}
+
+	var families []*dto.MetricFamily
+	decoder := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+	for {
+		mf := &dto.MetricFamily{}
+		if err := decoder.Decode(mf); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse metrics from %s: %w", req.URL.Redacted(), err)
+		}
+		families = append(families, mf)
+	}
+	return families, nil
+}
+
+// ClusterValues sums the samples of a counter or gauge family per cluster.
+// The operator labels cluster-scoped series with "namespace/name" or just the name.
+func ClusterValues(families []*dto.MetricFamily, name string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			clusterName := ClusterLabel(m)
+			if clusterName == "" {
+				continue
+			}
+			values[clusterName] += sampleValue(m)
+		}
+	}
+	return values
+}
+
+// ClusterLabel returns the cluster a series belongs to, without any namespace prefix
+func ClusterLabel(m *dto.Metric) string {
+	for _, label := range m.GetLabel() {
+		if label.GetName() == "cluster" || label.GetName() == "couchbase_cluster" {
+			value := label.GetValue()
+			if i := strings.LastIndex(value, "/"); i >= 0 {
+				value = value[i+1:]
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+func sampleValue(m *dto.Metric) float64 {
+	switch {
+	case m.GetCounter() != nil:
+		return m.GetCounter().GetValue()
+	case m.GetGauge() != nil:
+		return m.GetGauge().GetValue()
+	case m.GetUntyped() != nil:
+		return m.GetUntyped().GetValue()
+	}
+	return 0
+}
@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Range query functions
+const (
+	FuncRaw      = "raw"
+	FuncRate     = "rate"     // Per-second rate of a counter over the window
+	FuncIncrease = "increase" // Increase of a counter over the window
+	FuncQuantile = "quantile" // Histogram quantile over the window
+)
+
+// maxPointsPerSeries bounds the size of a range query response
+const maxPointsPerSeries = 11000
+
+// RangeQuery selects the series of one metric over a time range
+type RangeQuery struct {
+	Metric   string
+	Func     string
+	Matchers map[string]string // Exact label matches
+	Start    time.Time
+	End      time.Time
+	Step     time.Duration
+	Window   time.Duration // Lookback for rate, increase and quantile; defaults to 4 scrape intervals
+	Quantile float64       // For quantile, e.g. 0.99
+}
+
+// RangeSeries is the result of a range query for one label set
+type RangeSeries struct {
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels"`
+	Points []Point           `json:"points"`
+}
+
+// QueryRange evaluates a range query at every step between start and end
+func (h *History) QueryRange(query RangeQuery) ([]RangeSeries, error) {
+	if query.Step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	if !query.End.After(query.Start) {
+		return nil, fmt.Errorf("end must be after start")
+	}
+	if steps := query.End.Sub(query.Start) / query.Step; steps > maxPointsPerSeries {
+		return nil, fmt.Errorf("range of %d steps exceeds the limit of %d, increase the step", steps, maxPointsPerSeries)
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	window := query.Window
+	if window <= 0 {
+		window = 4 * h.interval
+	}
+	// Raw values go stale after a couple of missed scrapes
+	lookback := 2 * h.interval
+	if query.Step > lookback {
+		lookback = query.Step
+	}
+
+	if query.Func == FuncQuantile {
+		return h.queryQuantile(query, window)
+	}
+
+	var results []RangeSeries
+	for _, s := range h.series {
+		if s.name != query.Metric || !matchLabels(s.labels, query.Matchers) {
+			continue
+		}
+
+		switch query.Func {
+		case FuncRaw, "":
+		case FuncRate, FuncIncrease:
+			if s.kind != "counter" {
+				return nil, fmt.Errorf("%s only applies to counters, %s is a %s", query.Func, query.Metric, s.kind)
+			}
+		default:
+			return nil, fmt.Errorf("unknown function %q", query.Func)
+		}
+
+		result := RangeSeries{Metric: s.name, Labels: s.labels, Points: []Point{}}
+		for t := query.Start; !t.After(query.End); t = t.Add(query.Step) {
+			end := t.UnixMilli()
+
+			switch query.Func {
+			case FuncRaw, "":
+				points := s.between(end-lookback.Milliseconds(), end)
+				if len(points) > 0 {
+					result.Points = append(result.Points, Point{end, points[len(points)-1].V})
+				}
+			default:
+				points := s.between(end-window.Milliseconds(), end)
+				if len(points) < 2 {
+					continue
+				}
+				increase := counterIncrease(points)
+				if query.Func == FuncRate {
+					elapsed := float64(points[len(points)-1].T-points[0].T) / 1000
+					increase /= elapsed
+				}
+				result.Points = append(result.Points, Point{end, increase})
+			}
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return seriesKey(results[i].Metric, results[i].Labels) < seriesKey(results[j].Metric, results[j].Labels)
+	})
+	return results, nil
+}
+
+// queryQuantile estimates a histogram quantile at every step from the bucket increases over the window
+func (h *History) queryQuantile(query RangeQuery, window time.Duration) ([]RangeSeries, error) {
+	if query.Quantile < 0 || query.Quantile > 1 {
+		return nil, fmt.Errorf("quantile must be between 0 and 1")
+	}
+	family, exists := h.families[query.Metric]
+	if !exists {
+		return []RangeSeries{}, nil
+	}
+	if family.Type != "histogram" {
+		return nil, fmt.Errorf("quantile only applies to histograms, %s is a %s", query.Metric, family.Type)
+	}
+
+	// Group the bucket series of each label set
+	groups := make(map[string]map[string]string)
+	for _, s := range h.series {
+		if s.name != query.Metric+"_bucket" || !matchLabels(s.labels, query.Matchers) {
+			continue
+		}
+		labels := make(map[string]string, len(s.labels))
+		for name, value := range s.labels {
+			if name != "le" {
+				labels[name] = value
+			}
+		}
+		groups[seriesKey(query.Metric, labels)] = labels
+	}
+
+	quantileLabel := formatBound(query.Quantile)
+	var results []RangeSeries
+	for _, labels := range groups {
+		result := RangeSeries{Metric: query.Metric, Labels: withLabel(labels, "quantile", quantileLabel), Points: []Point{}}
+		for t := query.Start; !t.After(query.End); t = t.Add(query.Step) {
+			end := t.UnixMilli()
+			value := histogramQuantile(query.Quantile, h.bucketIncreases(query.Metric, labels, end-window.Milliseconds(), end))
+			if !math.IsNaN(value) {
+				result.Points = append(result.Points, Point{end, value})
+			}
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return seriesKey(results[i].Metric, results[i].Labels) < seriesKey(results[j].Metric, results[j].Labels)
+	})
+	return results, nil
+}
+
+// counterIncrease sums the increases between consecutive samples, treating a drop as a counter reset
+func counterIncrease(points []Point) float64 {
+	var increase float64
+	for i := 1; i < len(points); i++ {
+		if delta := points[i].V - points[i-1].V; delta >= 0 {
+			increase += delta
+		} else {
+			increase += points[i].V
+		}
+	}
+	return increase
+}
+
+func matchLabels(labels, matchers map[string]string) bool {
+	for name, value := range matchers {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func formatBound(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
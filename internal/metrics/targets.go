@@ -0,0 +1,382 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/logger"
+	"cod/internal/utils"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultOperatorMetricsPort is the operator's metrics port when neither annotations nor ports name it
+const defaultOperatorMetricsPort = 8383
+
+// metricsPortNames are the container and Service port names recognised as metrics ports
+var metricsPortNames = []string{"prometheus", "http-prometheus", "metrics", "http-metrics", "https-metrics"}
+
+// TargetsConfig configures how the operator's metrics endpoints are found and scraped
+type TargetsConfig struct {
+	URLs               []string // Static endpoints; discovery is skipped when set
+	Service            string   // Operator Service whose selector and metrics port are used
+	Selector           string   // Operator pod label selector when the Service is not found
+	Scheme             string   // http or https, unless a pod annotation says otherwise
+	BearerTokenFile    string   // e.g. the service account token for an RBAC-protected metrics port
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string // Expected certificate name, as pods are scraped by IP
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+	RefreshInterval    time.Duration // How long discovered endpoints are reused
+}
+
+// TargetsConfigFromEnv reads the operator metrics settings from COD_OPERATOR_METRICS_* variables
+func TargetsConfigFromEnv() TargetsConfig {
+	config := TargetsConfig{
+		Service:            os.Getenv("COD_OPERATOR_SERVICE"),
+		Selector:           os.Getenv("COD_OPERATOR_SELECTOR"),
+		Scheme:             os.Getenv("COD_OPERATOR_METRICS_SCHEME"),
+		BearerTokenFile:    os.Getenv("COD_OPERATOR_METRICS_BEARER_TOKEN_FILE"),
+		CAFile:             os.Getenv("COD_OPERATOR_METRICS_CA_FILE"),
+		CertFile:           os.Getenv("COD_OPERATOR_METRICS_CERT_FILE"),
+		KeyFile:            os.Getenv("COD_OPERATOR_METRICS_KEY_FILE"),
+		ServerName:         os.Getenv("COD_OPERATOR_METRICS_SERVER_NAME"),
+		InsecureSkipVerify: utils.GetEnvBool("COD_OPERATOR_METRICS_INSECURE_SKIP_VERIFY", false),
+		Timeout:            utils.GetEnvDuration("COD_OPERATOR_METRICS_TIMEOUT", 10*time.Second),
+		RefreshInterval:    utils.GetEnvDuration("COD_OPERATOR_METRICS_REFRESH_INTERVAL", 30*time.Second),
+	}
+	for _, url := range strings.Split(os.Getenv("COD_OPERATOR_METRICS_URL"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			config.URLs = append(config.URLs, url)
+		}
+	}
+	if config.Service == "" {
+		config.Service = "couchbase-operator"
+	}
+	if config.Selector == "" {
+		config.Selector = "app=couchbase-operator"
+	}
+	if config.Scheme == "" {
+		config.Scheme = "http"
+	}
+	return config
+}
+
+// Target is an operator metrics endpoint and the outcome of its last scrape
+type Target struct {
+	Pod        string    `json:"pod,omitempty"`
+	URL        string    `json:"url"`
+	Healthy    bool      `json:"healthy"`
+	LastScrape time.Time `json:"lastScrape,omitempty"`
+	LastError  string    `json:"lastError,omitempty"`
+}
+
+// OperatorScraper scrapes every operator replica, discovering them through the Kubernetes API
+type OperatorScraper struct {
+	clientset    kubernetes.Interface
+	namespace    string
+	config       TargetsConfig
+	client       *http.Client
+	targets      []Target
+	discoveredAt time.Time
+	mutex        sync.Mutex
+}
+
+func NewOperatorScraper(clientset kubernetes.Interface, namespace string, config TargetsConfig) (*OperatorScraper, error) {
+	if _, err := labels.Parse(config.Selector); err != nil {
+		return nil, fmt.Errorf("invalid operator selector %q: %w", config.Selector, err)
+	}
+
+	tlsConfig, err := utils.TLSConfig(config.CAFile, config.CertFile, config.KeyFile, config.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("invalid operator metrics TLS settings: %w", err)
+	}
+	tlsConfig.ServerName = config.ServerName
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	scraper := &OperatorScraper{
+		clientset: clientset,
+		namespace: namespace,
+		config:    config,
+		client:    &http.Client{Transport: transport, Timeout: config.Timeout},
+	}
+	for _, url := range config.URLs {
+		scraper.targets = append(scraper.targets, Target{URL: url})
+	}
+	return scraper, nil
+}
+
+// Targets returns the current endpoints and their scrape health
+func (o *OperatorScraper) Targets() []Target {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return append([]Target(nil), o.targets...)
+}
+
+// Fetch scrapes all operator endpoints concurrently and merges their families. When more than
+// one endpoint is scraped each series is labelled with its operator_pod (or instance). It only
+// fails when no endpoint could be scraped.
+func (o *OperatorScraper) Fetch(ctx context.Context) ([]*dto.MetricFamily, error) {
+	targets, err := o.currentTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]*dto.MetricFamily, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = o.scrape(ctx, targets[i].URL)
+		}(i)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	var failures []string
+	for i := range targets {
+		targets[i].LastScrape = now
+		targets[i].Healthy = errs[i] == nil
+		targets[i].LastError = ""
+		if errs[i] != nil {
+			targets[i].LastError = errs[i].Error()
+			failures = append(failures, errs[i].Error())
+		}
+	}
+	o.mutex.Lock()
+	o.targets = targets
+	if len(failures) == len(targets) {
+		o.discoveredAt = time.Time{} // Endpoints may have moved, rediscover on the next fetch
+	}
+	o.mutex.Unlock()
+
+	if len(failures) == len(targets) {
+		return nil, fmt.Errorf("failed to scrape operator metrics: %s", strings.Join(failures, "; "))
+	}
+
+	// Merge the replicas' families, keeping the first replica's metadata
+	merged := make(map[string]*dto.MetricFamily)
+	var order []string
+	for i, families := range results {
+		for _, mf := range families {
+			if len(targets) > 1 {
+				labelName, labelValue := "operator_pod", targets[i].Pod
+				if labelValue == "" {
+					labelName, labelValue = "instance", instanceOf(targets[i].URL)
+				}
+				for _, m := range mf.GetMetric() {
+					m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(labelName), Value: proto.String(labelValue)})
+					sort.Slice(m.Label, func(i, j int) bool { return m.Label[i].GetName() < m.Label[j].GetName() })
+				}
+			}
+			existing, exists := merged[mf.GetName()]
+			if !exists {
+				merged[mf.GetName()] = mf
+				order = append(order, mf.GetName())
+				continue
+			}
+			existing.Metric = append(existing.Metric, mf.GetMetric()...)
+		}
+	}
+
+	families := make([]*dto.MetricFamily, 0, len(order))
+	for _, name := range order {
+		families = append(families, merged[name])
+	}
+	return families, nil
+}
+
+func (o *OperatorScraper) scrape(ctx context.Context, url string) ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if o.config.BearerTokenFile != "" {
+		// Re-read every scrape so projected service account tokens are picked up when rotated
+		token, err := os.ReadFile(o.config.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	return FetchRequest(o.client, req)
+}
+
+// currentTargets returns the static endpoints, or rediscovers the operator pods when the
+// discovered endpoints are older than the refresh interval
+func (o *OperatorScraper) currentTargets(ctx context.Context) ([]Target, error) {
+	o.mutex.Lock()
+	static := len(o.config.URLs) > 0
+	fresh := time.Since(o.discoveredAt) < o.config.RefreshInterval
+	targets := append([]Target(nil), o.targets...)
+	o.mutex.Unlock()
+
+	if static || fresh {
+		return targets, nil
+	}
+
+	discovered, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the health of endpoints that were already known
+	previous := make(map[string]Target, len(targets))
+	for _, target := range targets {
+		previous[target.URL] = target
+	}
+	for i, target := range discovered {
+		if known, exists := previous[target.URL]; exists {
+			discovered[i] = known
+			discovered[i].Pod = target.Pod
+		}
+	}
+
+	o.mutex.Lock()
+	o.targets = discovered
+	o.discoveredAt = time.Now()
+	o.mutex.Unlock()
+	return discovered, nil
+}
+
+// discover finds the running operator pods through the operator Service's selector, falling
+// back to the configured label selector
+func (o *OperatorScraper) discover(ctx context.Context) ([]Target, error) {
+	selector := o.config.Selector
+	var servicePort *intstr.IntOrString
+
+	service, err := o.clientset.CoreV1().Services(o.namespace).Get(ctx, o.config.Service, metav1.GetOptions{})
+	switch {
+	case err == nil && len(service.Spec.Selector) > 0:
+		selector = labels.SelectorFromSet(service.Spec.Selector).String()
+		for _, port := range service.Spec.Ports {
+			if isMetricsPortName(port.Name) {
+				targetPort := port.TargetPort
+				if targetPort.Type == intstr.Int && targetPort.IntVal == 0 {
+					targetPort = intstr.FromInt32(port.Port)
+				}
+				servicePort = &targetPort
+				break
+			}
+		}
+	case err != nil && !apierrors.IsNotFound(err):
+		logger.Log.Debug("Failed to get operator service, using the pod selector",
+			zap.Error(err),
+			zap.String("service", o.config.Service))
+	}
+
+	pods, err := o.clientset.CoreV1().Pods(o.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if apierrors.IsForbidden(err) {
+		return []Target{{URL: OperatorMetricsURL}}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list operator pods: %w", err)
+	}
+
+	var targets []Target
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != v1.PodRunning || pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		port, portName := metricsPort(pod, servicePort)
+
+		scheme := o.config.Scheme
+		if strings.HasPrefix(portName, "https") {
+			scheme = "https"
+		}
+		if annotated := pod.Annotations["prometheus.io/scheme"]; annotated != "" {
+			scheme = annotated
+		}
+		path := "/metrics"
+		if annotated := pod.Annotations["prometheus.io/path"]; annotated != "" {
+			path = annotated
+		}
+
+		targets = append(targets, Target{
+			Pod: pod.Name,
+			URL: scheme + "://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port)) + path,
+		})
+	}
+	if len(targets) == 0 {
+		// Running as a sidecar without access to the pods, or the operator is not labelled as expected
+		return []Target{{URL: OperatorMetricsURL}}, nil
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Pod < targets[j].Pod })
+	return targets, nil
+}
+
+// metricsPort resolves a pod's metrics port from the prometheus.io/port annotation, the Service's
+// target port or a container port with a metrics name, in that order
+func metricsPort(pod *v1.Pod, servicePort *intstr.IntOrString) (int, string) {
+	if annotated, err := strconv.Atoi(pod.Annotations["prometheus.io/port"]); err == nil && annotated > 0 {
+		return annotated, containerPortName(pod, annotated)
+	}
+	if servicePort != nil {
+		if servicePort.Type == intstr.Int {
+			return servicePort.IntValue(), containerPortName(pod, servicePort.IntValue())
+		}
+		for _, container := range pod.Spec.Containers {
+			for _, port := range container.Ports {
+				if port.Name == servicePort.StrVal {
+					return int(port.ContainerPort), port.Name
+				}
+			}
+		}
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if isMetricsPortName(port.Name) {
+				return int(port.ContainerPort), port.Name
+			}
+		}
+	}
+	return defaultOperatorMetricsPort, ""
+}
+
+func containerPortName(pod *v1.Pod, number int) string {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if int(port.ContainerPort) == number {
+				return port.Name
+			}
+		}
+	}
+	return ""
+}
+
+func isMetricsPortName(name string) bool {
+	for _, candidate := range metricsPortNames {
+		if name == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+func instanceOf(rawURL string) string {
+	if _, rest, found := strings.Cut(rawURL, "://"); found {
+		host, _, _ := strings.Cut(rest, "/")
+		return host
+	}
+	return rawURL
+}
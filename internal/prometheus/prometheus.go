@@ -0,0 +1,352 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/metrics"
+	"cod/internal/utils"
+)
+
+// maxPoints mirrors the per-series point limit of the Prometheus query API
+const maxPoints = 11000
+
+// Config describes how to reach the Prometheus HTTP API
+type Config struct {
+	URL                string // Base URL, e.g. https://prometheus.monitoring:9090
+	BearerToken        string
+	BearerTokenFile    string // Re-read on every request so rotated tokens are picked up
+	CAFile             string
+	CertFile           string // Client certificate for mutual TLS
+	KeyFile            string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+}
+
+// ConfigFromEnv reads the Prometheus integration settings from COD_PROMETHEUS_* variables.
+// An empty URL means the integration is disabled.
+func ConfigFromEnv() Config {
+	return Config{
+		URL:                os.Getenv("COD_PROMETHEUS_URL"),
+		BearerToken:        os.Getenv("COD_PROMETHEUS_BEARER_TOKEN"),
+		BearerTokenFile:    os.Getenv("COD_PROMETHEUS_BEARER_TOKEN_FILE"),
+		CAFile:             os.Getenv("COD_PROMETHEUS_CA_FILE"),
+		CertFile:           os.Getenv("COD_PROMETHEUS_CERT_FILE"),
+		KeyFile:            os.Getenv("COD_PROMETHEUS_KEY_FILE"),
+		InsecureSkipVerify: utils.GetEnvBool("COD_PROMETHEUS_INSECURE_SKIP_VERIFY", false),
+		Timeout:            utils.GetEnvDuration("COD_PROMETHEUS_TIMEOUT", 30*time.Second),
+	}
+}
+
+// recordingRulesTTL is how long the names of the recording rules are reused between queries
+const recordingRulesTTL = time.Minute
+
+// Client queries the Prometheus HTTP API
+type Client struct {
+	baseURL   *url.URL
+	config    Config
+	client    *http.Client
+	templates *Templates
+
+	ruleNames        map[string]bool // Recording rules, the only metrics templates may name
+	ruleNamesFetched time.Time
+	ruleNamesMutex   sync.Mutex
+}
+
+// NewClient validates the config and builds its TLS settings
+func NewClient(config Config, templates *Templates) (*Client, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(config.URL, "/"))
+	if err != nil || baseURL.Scheme == "" || baseURL.Host == "" {
+		return nil, fmt.Errorf("invalid Prometheus URL %q", config.URL)
+	}
+
+	tlsConfig, err := utils.TLSConfig(config.CAFile, config.CertFile, config.KeyFile, config.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Prometheus TLS settings: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &Client{
+		baseURL:   baseURL,
+		config:    config,
+		client:    &http.Client{Transport: transport, Timeout: config.Timeout},
+		templates: templates,
+	}, nil
+}
+
+// URL returns the base URL without credentials
+func (c *Client) URL() string {
+	return c.baseURL.Redacted()
+}
+
+// Templates returns the allowlisted query templates
+func (c *Client) Templates() *Templates {
+	return c.templates
+}
+
+// Render expands an allowlisted query template. Metric parameters must name one of the recording
+// rules Prometheus evaluates, so that templates cannot read arbitrary series.
+func (c *Client) Render(ctx context.Context, name string, values map[string]string) (string, error) {
+	return c.templates.Render(name, values, func(metric string) error {
+		names, err := c.recordingRuleNames(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list recording rules: %w", err)
+		}
+		if !names[metric] {
+			return fmt.Errorf("%q is not a recording rule", metric)
+		}
+		return nil
+	})
+}
+
+func (c *Client) recordingRuleNames(ctx context.Context) (map[string]bool, error) {
+	c.ruleNamesMutex.Lock()
+	defer c.ruleNamesMutex.Unlock()
+	if c.ruleNames != nil && time.Since(c.ruleNamesFetched) < recordingRulesTTL {
+		return c.ruleNames, nil
+	}
+
+	rules, err := c.RecordingRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.ruleNames = make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		c.ruleNames[rule.Name] = true
+	}
+	c.ruleNamesFetched = time.Now()
+	return c.ruleNames, nil
+}
+
+// apiResponse is the envelope of every Prometheus API response
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+}
+
+// APIError is an error reported by Prometheus, e.g. a bad query
+type APIError struct {
+	Type    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("prometheus %s error: %s", e.Type, e.Message)
+}
+
+func (c *Client) get(ctx context.Context, path string, params url.Values, data interface{}) error {
+	endpoint := *c.baseURL
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + path
+	endpoint.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	token := c.config.BearerToken
+	if c.config.BearerTokenFile != "" {
+		tokenData, err := os.ReadFile(c.config.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read Prometheus bearer token: %w", err)
+		}
+		token = strings.TrimSpace(string(tokenData))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return err
+	}
+
+	// Query errors come back as 400/422 with an error envelope
+	var envelope apiResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("received status %s from %s", resp.Status, c.URL())
+	}
+	if envelope.Status != "success" {
+		return &APIError{Type: envelope.ErrorType, Message: envelope.Error}
+	}
+	return json.Unmarshal(envelope.Data, data)
+}
+
+// QueryRange evaluates a PromQL expression over a time range
+func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]metrics.RangeSeries, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	if steps := end.Sub(start) / step; steps > maxPoints {
+		return nil, fmt.Errorf("range of %d steps exceeds the limit of %d, increase the step", steps, maxPoints)
+	}
+
+	params := url.Values{
+		"query": {query},
+		"start": {formatTime(start)},
+		"end":   {formatTime(end)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+
+	var data struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][2]interface{}  `json:"values"`
+		} `json:"result"`
+	}
+	if err := c.get(ctx, "/api/v1/query_range", params, &data); err != nil {
+		return nil, err
+	}
+	if data.ResultType != "matrix" {
+		return nil, fmt.Errorf("unexpected result type %q", data.ResultType)
+	}
+
+	results := make([]metrics.RangeSeries, 0, len(data.Result))
+	for _, result := range data.Result {
+		series := metrics.RangeSeries{Metric: result.Metric["__name__"], Labels: make(map[string]string), Points: []metrics.Point{}}
+		for name, value := range result.Metric {
+			if name != "__name__" {
+				series.Labels[name] = value
+			}
+		}
+		for _, pair := range result.Values {
+			point, ok := parsePoint(pair)
+			if ok {
+				series.Points = append(series.Points, point)
+			}
+		}
+		results = append(results, series)
+	}
+	return results, nil
+}
+
+// RecordingRule is a recording rule loaded in Prometheus
+type RecordingRule struct {
+	Group     string `json:"group"`
+	Name      string `json:"name"`
+	Query     string `json:"query"`
+	Health    string `json:"health"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// RecordingRules lists the recording rules Prometheus evaluates, which can be queried by name
+func (c *Client) RecordingRules(ctx context.Context) ([]RecordingRule, error) {
+	var data struct {
+		Groups []struct {
+			Name  string          `json:"name"`
+			Rules []RecordingRule `json:"rules"`
+		} `json:"groups"`
+	}
+	if err := c.get(ctx, "/api/v1/rules", url.Values{"type": {"record"}}, &data); err != nil {
+		return nil, err
+	}
+
+	var rules []RecordingRule
+	for _, group := range data.Groups {
+		for _, rule := range group.Rules {
+			rule.Group = group.Name
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules, nil
+}
+
+// Selector builds a PromQL series selector matching labels exactly
+func Selector(metric string, matchers map[string]string) (string, error) {
+	if !metricNamePattern.MatchString(metric) {
+		return "", fmt.Errorf("invalid metric name %q", metric)
+	}
+
+	names := make([]string, 0, len(matchers))
+	for name := range matchers {
+		if !labelNamePattern.MatchString(name) {
+			return "", fmt.Errorf("invalid label name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+strconv.Quote(matchers[name]))
+	}
+	return metric + "{" + strings.Join(parts, ",") + "}", nil
+}
+
+// RangeExpression translates a metrics history range query into PromQL
+func RangeExpression(query metrics.RangeQuery) (string, error) {
+	selector, err := Selector(query.Metric, query.Matchers)
+	if err != nil {
+		return "", err
+	}
+
+	// A window shorter than the step would skip samples between steps
+	window := query.Window
+	if window < query.Step {
+		window = query.Step
+	}
+	if window <= 0 {
+		window = 2 * time.Minute
+	}
+
+	switch query.Func {
+	case metrics.FuncRaw, "":
+		return selector, nil
+	case metrics.FuncRate, metrics.FuncIncrease:
+		return fmt.Sprintf("%s(%s[%ds])", query.Func, selector, int64(window.Seconds())), nil
+	case metrics.FuncQuantile:
+		bucketSelector, err := Selector(query.Metric+"_bucket", query.Matchers)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("histogram_quantile(%s, rate(%s[%ds]))",
+			strconv.FormatFloat(query.Quantile, 'g', -1, 64), bucketSelector, int64(window.Seconds())), nil
+	default:
+		return "", fmt.Errorf("unknown function %q", query.Func)
+	}
+}
+
+func parsePoint(pair [2]interface{}) (metrics.Point, bool) {
+	timestamp, ok := pair[0].(float64)
+	if !ok {
+		return metrics.Point{}, false
+	}
+	text, ok := pair[1].(string)
+	if !ok {
+		return metrics.Point{}, false
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	// NaN and Inf cannot be encoded as JSON
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return metrics.Point{}, false
+	}
+	return metrics.Point{T: int64(timestamp * 1000), V: value}, true
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
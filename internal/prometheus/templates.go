@@ -0,0 +1,211 @@
+package prometheus
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Template parameter types, each validated before it is substituted into a query
+const (
+	ParamLabel    = "label"    // Label value, substituted inside a quoted string
+	ParamDuration = "duration" // PromQL duration, e.g. 5m or 1h30m
+	ParamMetric   = "metric"   // Name of a recording rule Prometheus evaluates
+)
+
+var (
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	durationPattern   = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|y))+$`)
+)
+
+// Param is a named placeholder of a template, referenced in the query as {{.name}}
+type Param struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default string `json:"default,omitempty"`
+}
+
+// Template is an allowlisted PromQL query
+type Template struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Query       string  `json:"query"`
+	Params      []Param `json:"params,omitempty"`
+
+	compiled *template.Template
+}
+
+// clusterMatcher matches the operator's cluster label, which may carry a namespace prefix
+const clusterMatcher = `cluster=~"(.*/)?{{.cluster}}"`
+
+// DefaultTemplates are used when no templates file is configured
+func DefaultTemplates() []Template {
+	clusterParams := []Param{{Name: "cluster", Type: ParamLabel, Default: ".*"}, {Name: "window", Type: ParamDuration, Default: "5m"}}
+	return []Template{
+		{
+			Name:        "reconcile_failures",
+			Description: "Reconcile failures per cluster over the window",
+			Query:       `sum by (cluster) (increase(couchbase_operator_reconcile_failures{` + clusterMatcher + `}[{{.window}}]))`,
+			Params:      clusterParams,
+		},
+		{
+			Name:        "pod_recovery_failures",
+			Description: "Failed pod recoveries per cluster over the window",
+			Query:       `sum by (cluster) (increase(couchbase_operator_pod_recovery_failures_total{` + clusterMatcher + `}[{{.window}}]))`,
+			Params:      clusterParams,
+		},
+		{
+			Name:        "memory_under_management",
+			Description: "Memory allocated to Couchbase Server pods per cluster",
+			Query:       `sum by (cluster) (couchbase_operator_memory_under_management_bytes{` + clusterMatcher + `})`,
+			Params:      clusterParams[:1],
+		},
+		{
+			Name:        "volume_size_under_management",
+			Description: "Persistent volume capacity per cluster",
+			Query:       `sum by (cluster) (couchbase_operator_volume_size_under_management_bytes{` + clusterMatcher + `})`,
+			Params:      clusterParams[:1],
+		},
+		{
+			Name:        "recording_rule",
+			Description: "Any recording rule by name, optionally for one cluster",
+			Query:       `{{.metric}}{` + clusterMatcher + `}`,
+			Params:      []Param{{Name: "metric", Type: ParamMetric}, clusterParams[0]},
+		},
+	}
+}
+
+// Templates is the validated set of allowlisted queries
+type Templates struct {
+	byName map[string]*Template
+}
+
+// LoadTemplates reads templates from a YAML or JSON file, or uses the defaults when path is empty
+func LoadTemplates(path string) (*Templates, error) {
+	templates := DefaultTemplates()
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		var config struct {
+			Templates []Template `json:"templates"`
+		}
+		if err := yaml.NewYAMLOrJSONDecoder(file, 4096).Decode(&config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		templates = config.Templates
+	}
+
+	result := &Templates{byName: make(map[string]*Template, len(templates))}
+	for i := range templates {
+		entry := templates[i]
+		if err := entry.compile(); err != nil {
+			return nil, fmt.Errorf("template %q: %w", entry.Name, err)
+		}
+		if _, exists := result.byName[entry.Name]; exists {
+			return nil, fmt.Errorf("duplicate template %q", entry.Name)
+		}
+		result.byName[entry.Name] = &entry
+	}
+	return result, nil
+}
+
+func (t *Template) compile() error {
+	if t.Name == "" || t.Query == "" {
+		return fmt.Errorf("name and query are required")
+	}
+	for _, param := range t.Params {
+		if !labelNamePattern.MatchString(param.Name) {
+			return fmt.Errorf("invalid parameter name %q", param.Name)
+		}
+		switch param.Type {
+		case ParamLabel, ParamDuration, ParamMetric:
+		default:
+			return fmt.Errorf("parameter %s has unknown type %q", param.Name, param.Type)
+		}
+		if param.Default != "" {
+			if err := validateParam(param, param.Default); err != nil {
+				return fmt.Errorf("default of %w", err)
+			}
+		}
+	}
+
+	compiled, err := template.New(t.Name).Option("missingkey=error").Parse(t.Query)
+	if err != nil {
+		return err
+	}
+	t.compiled = compiled
+	return nil
+}
+
+// List returns the templates sorted by name
+func (t *Templates) List() []Template {
+	list := make([]Template, 0, len(t.byName))
+	for _, entry := range t.byName {
+		list = append(list, *entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Render expands a template with the given parameters. Only declared parameters
+// are substituted, and each must pass the validation of its type. Metric parameters
+// must also pass checkMetric.
+func (t *Templates) Render(name string, values map[string]string, checkMetric func(metric string) error) (string, error) {
+	entry, exists := t.byName[name]
+	if !exists {
+		return "", fmt.Errorf("unknown query template %q", name)
+	}
+
+	params := make(map[string]string, len(entry.Params))
+	for _, param := range entry.Params {
+		value, set := values[param.Name]
+		if !set || value == "" {
+			value = param.Default
+		}
+		if value == "" {
+			return "", fmt.Errorf("parameter %s is required", param.Name)
+		}
+		if err := validateParam(param, value); err != nil {
+			return "", err
+		}
+		if param.Type == ParamMetric {
+			if err := checkMetric(value); err != nil {
+				return "", fmt.Errorf("parameter %s: %w", param.Name, err)
+			}
+		}
+		params[param.Name] = value
+	}
+
+	var query strings.Builder
+	if err := entry.compiled.Execute(&query, params); err != nil {
+		return "", err
+	}
+	return query.String(), nil
+}
+
+func validateParam(param Param, value string) error {
+	var valid bool
+	switch param.Type {
+	case ParamLabel:
+		// Substituted inside a quoted string, so quotes and escapes could break out of it
+		valid = len(value) <= 256 && !strings.ContainsAny(value, "\"'`\\\n")
+	case ParamDuration:
+		valid = durationPattern.MatchString(value)
+	case ParamMetric:
+		valid = metricNamePattern.MatchString(value)
+	}
+	if !valid {
+		return fmt.Errorf("parameter %s: invalid %s %q", param.Name, param.Type, value)
+	}
+	return nil
+}
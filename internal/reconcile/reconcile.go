@@ -0,0 +1,356 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/logger"
+	"cod/internal/metrics"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Reconcile states, from healthy to unhealthy
+const (
+	StateReconciled  = "Reconciled"
+	StateReconciling = "Reconciling"
+	StateFailing     = "Failing"
+	StateStuck       = "Stuck"
+)
+
+// Status is the reconcile state of a single cluster
+type Status struct {
+	Cluster            string     `json:"cluster"`
+	State              string     `json:"state"`
+	Reason             string     `json:"reason,omitempty"`
+	Generation         int64      `json:"generation"`
+	ObservedGeneration int64      `json:"observedGeneration"`
+	ObservedBy         string     `json:"observedBy,omitempty"` // status.observedGeneration, statusUpdate or log
+	PendingSince       *time.Time `json:"pendingSince,omitempty"`
+	LagSeconds         float64    `json:"lagSeconds"`
+	ReconcileFailures  float64    `json:"reconcileFailures"`
+	FailingSince       *time.Time `json:"failingSince,omitempty"`
+	LastFailureAt      *time.Time `json:"lastFailureAt,omitempty"`
+	LastActivityAt     *time.Time `json:"lastActivityAt,omitempty"`
+	LastError          string     `json:"lastError,omitempty"`
+}
+
+// clusterState is the raw tracking data behind a Status
+type clusterState struct {
+	generation         int64
+	observedGeneration int64
+	observedBy         string
+	hasObservedField   bool // The operator publishes status.observedGeneration itself
+	status             map[string]interface{}
+	pendingSince       time.Time
+	failures           float64
+	failuresSeen       bool
+	failingSince       time.Time
+	lastFailureAt      time.Time
+	lastActivityAt     time.Time
+	lastError          string
+	reported           Status // Last status handed to onChange
+}
+
+// Messages the operator logs per cluster around each reconcile loop
+const (
+	logReconcileStarting  = "Reconcile starting"
+	logReconcileCompleted = "Reconcile completed"
+)
+
+// operatorLogEntry holds the fields of an operator log line used to detect reconcile activity
+type operatorLogEntry struct {
+	Level   string `json:"level"`
+	Msg     string `json:"msg"`
+	Cluster string `json:"cluster"`
+	Error   string `json:"error"`
+}
+
+// Tracker compares each cluster's metadata.generation with what the operator has acted on
+type Tracker struct {
+	clusters  map[string]*clusterState
+	threshold time.Duration // How long a cluster may stay unreconciled or failing before it is stuck
+	mutex     sync.Mutex
+}
+
+func NewTracker(threshold time.Duration) *Tracker {
+	return &Tracker{
+		clusters:  make(map[string]*clusterState),
+		threshold: threshold,
+	}
+}
+
+// ObserveCluster updates the tracked generation and status of a cluster from an informer object
+func (t *Tracker) ObserveCluster(obj *unstructured.Unstructured) {
+	now := time.Now()
+	name := obj.GetName()
+	generation := obj.GetGeneration()
+	status, _, _ := unstructured.NestedMap(obj.Object, "status")
+	observedGeneration, hasObservedField, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state, exists := t.clusters[name]
+	if !exists {
+		// First sighting: nothing to compare against, so trust the operator unless it says otherwise
+		state = &clusterState{generation: generation, observedGeneration: generation, status: status}
+		t.clusters[name] = state
+	}
+
+	if hasObservedField {
+		state.hasObservedField = true
+		state.observedGeneration = observedGeneration
+		state.observedBy = "status.observedGeneration"
+	}
+
+	if generation > state.generation {
+		state.generation = generation
+	}
+
+	statusChanged := exists && !reflect.DeepEqual(state.status, status)
+	state.status = status
+
+	if state.observedGeneration >= state.generation {
+		state.pendingSince = time.Time{}
+		return
+	}
+
+	if state.pendingSince.IsZero() {
+		state.pendingSince = now
+		return
+	}
+
+	// Without observedGeneration, a status write after the spec change shows the operator acted on it
+	if !state.hasObservedField && statusChanged {
+		state.observedGeneration = state.generation
+		state.observedBy = "statusUpdate"
+		state.pendingSince = time.Time{}
+		state.lastActivityAt = now
+	}
+}
+
+// Remove stops tracking a deleted cluster
+func (t *Tracker) Remove(clusterName string) {
+	t.mutex.Lock()
+	delete(t.clusters, clusterName)
+	t.mutex.Unlock()
+}
+
+// ObserveLogLine records reconcile activity and errors from an operator log line
+func (t *Tracker) ObserveLogLine(line string) {
+	var entry operatorLogEntry
+	if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Cluster == "" {
+		return
+	}
+
+	clusterName := entry.Cluster
+	if i := strings.LastIndex(clusterName, "/"); i >= 0 {
+		clusterName = clusterName[i+1:]
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state, exists := t.clusters[clusterName]
+	if !exists {
+		return
+	}
+
+	now := time.Now()
+	state.lastActivityAt = now
+
+	if entry.Level == "error" {
+		state.lastError = entry.Msg
+		if entry.Error != "" {
+			state.lastError += ": " + entry.Error
+		}
+		return
+	}
+
+	starting := strings.EqualFold(entry.Msg, logReconcileStarting)
+	completed := strings.EqualFold(entry.Msg, logReconcileCompleted)
+	if !starting && !completed {
+		return
+	}
+	// A completed reconcile supersedes earlier errors
+	if completed {
+		state.lastError = ""
+	}
+	// A reconcile after the spec change shows the operator picked it up
+	if !state.hasObservedField && !state.pendingSince.IsZero() {
+		state.observedGeneration = state.generation
+		state.observedBy = "log"
+		state.pendingSince = time.Time{}
+	}
+}
+
+// ObserveFailures records the couchbase_operator_reconcile_failures counter per cluster
+func (t *Tracker) ObserveFailures(failures map[string]float64) {
+	now := time.Now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for clusterName, value := range failures {
+		state, exists := t.clusters[clusterName]
+		if !exists {
+			continue
+		}
+
+		// The first sample and counter resets only establish a baseline
+		if state.failuresSeen && value > state.failures {
+			state.lastFailureAt = now
+			if state.failingSince.IsZero() {
+				state.failingSince = now
+			}
+		}
+		state.failures = value
+		state.failuresSeen = true
+	}
+}
+
+// Evaluate recomputes every cluster's status and returns those whose state or error changed since last reported
+func (t *Tracker) Evaluate() []Status {
+	now := time.Now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var changed []Status
+	for name, state := range t.clusters {
+		// Failures that stopped for a whole threshold window have recovered, and their error with them
+		if !state.failingSince.IsZero() && now.Sub(state.lastFailureAt) > t.threshold {
+			state.failingSince = time.Time{}
+			state.lastError = ""
+		}
+
+		status := t.buildStatus(name, state, now)
+		if status.State != state.reported.State || status.Reason != state.reported.Reason {
+			if status.State == StateStuck {
+				logger.Log.Warn("Cluster reconcile stuck",
+					zap.String("cluster", name),
+					zap.String("reason", status.Reason),
+					zap.Int64("generation", status.Generation),
+					zap.Int64("observedGeneration", status.ObservedGeneration))
+			} else {
+				logger.Log.Info("Cluster reconcile state changed",
+					zap.String("cluster", name),
+					zap.String("previousState", state.reported.State),
+					zap.String("state", status.State))
+			}
+			changed = append(changed, status)
+		} else if status.LastError != state.reported.LastError {
+			changed = append(changed, status) // A new or cleared error
+		}
+		state.reported = status
+	}
+	return changed
+}
+
+// Status returns the current status of a cluster
+func (t *Tracker) Status(clusterName string) (Status, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state, exists := t.clusters[clusterName]
+	if !exists {
+		return Status{}, false
+	}
+	return t.buildStatus(clusterName, state, time.Now()), true
+}
+
+// All returns the current status of every tracked cluster
+func (t *Tracker) All() []Status {
+	now := time.Now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	statuses := make([]Status, 0, len(t.clusters))
+	for name, state := range t.clusters {
+		statuses = append(statuses, t.buildStatus(name, state, now))
+	}
+	return statuses
+}
+
+func (t *Tracker) buildStatus(name string, state *clusterState, now time.Time) Status {
+	status := Status{
+		Cluster:            name,
+		Generation:         state.generation,
+		ObservedGeneration: state.observedGeneration,
+		ObservedBy:         state.observedBy,
+		ReconcileFailures:  state.failures,
+		LastError:          state.lastError,
+		PendingSince:       optionalTime(state.pendingSince),
+		FailingSince:       optionalTime(state.failingSince),
+		LastFailureAt:      optionalTime(state.lastFailureAt),
+		LastActivityAt:     optionalTime(state.lastActivityAt),
+	}
+
+	pending := !state.pendingSince.IsZero()
+	if pending {
+		status.LagSeconds = now.Sub(state.pendingSince).Seconds()
+	}
+	failing := !state.failingSince.IsZero()
+
+	switch {
+	case pending && now.Sub(state.pendingSince) > t.threshold:
+		status.State = StateStuck
+		status.Reason = "generation not reconciled within " + t.threshold.String()
+	case failing && now.Sub(state.failingSince) > t.threshold:
+		status.State = StateStuck
+		status.Reason = "reconcile failures increasing for over " + t.threshold.String()
+	case failing:
+		status.State = StateFailing
+		status.Reason = "reconcile failures increasing"
+	case pending:
+		status.State = StateReconciling
+		status.Reason = "waiting for the operator to act on the latest generation"
+	default:
+		status.State = StateReconciled
+	}
+	return status
+}
+
+// Run periodically samples the reconcile failure metric from the metrics history's latest scrape and
+// reports status changes through onChange
+func (t *Tracker) Run(ctx context.Context, interval time.Duration,
+	latestMetrics func() ([]*dto.MetricFamily, error),
+	onChange func(status Status)) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		families, err := latestMetrics()
+		if err != nil {
+			logger.Log.Debug("No operator metrics for reconcile tracking", zap.Error(err))
+		} else {
+			t.ObserveFailures(metrics.ClusterValues(families, "couchbase_operator_reconcile_failures"))
+		}
+
+		for _, status := range t.Evaluate() {
+			onChange(status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
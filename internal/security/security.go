@@ -0,0 +1,233 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cod/internal/logger"
+	"cod/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// TokenCookie holds the CSRF token, readable by the dashboard's scripts
+	TokenCookie = "cod_csrf"
+	// TokenHeader carries the CSRF token on requests that change state
+	TokenHeader = "X-COD-CSRF-Token"
+)
+
+// defaultContentSecurityPolicy fits the dashboard pages: own scripts only, inline styles, and the
+// WebSocket back to the dashboard
+const defaultContentSecurityPolicy = "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; " +
+	"connect-src 'self' ws: wss:; frame-ancestors 'self'; base-uri 'self'; form-action 'self'"
+
+// Config sets the security headers and CSRF checks
+type Config struct {
+	Headers               bool          // Send the headers below
+	ContentSecurityPolicy string        // For dashboard pages; the Couchbase console keeps its own
+	FrameOptions          string        // X-Frame-Options of dashboard pages
+	HSTSMaxAge            time.Duration // Strict-Transport-Security over HTTPS; 0 disables it
+	AllowedOrigins        []string      // Origins besides the dashboard's own that may change state
+	RequireToken          bool          // Reject requests that change state without the CSRF token; off only for scripted clients
+}
+
+// ConfigFromEnv reads the security settings from COD_SECURITY_*, COD_CSP, COD_FRAME_OPTIONS,
+// COD_HSTS_MAX_AGE, COD_ALLOWED_ORIGINS and COD_CSRF_REQUIRE_TOKEN
+func ConfigFromEnv() Config {
+	config := Config{
+		Headers:               utils.GetEnvBool("COD_SECURITY_HEADERS", true),
+		ContentSecurityPolicy: defaultContentSecurityPolicy,
+		FrameOptions:          "SAMEORIGIN",
+		HSTSMaxAge:            utils.GetEnvDuration("COD_HSTS_MAX_AGE", 0),
+		RequireToken:          utils.GetEnvBool("COD_CSRF_REQUIRE_TOKEN", true),
+	}
+	if value, set := os.LookupEnv("COD_CSP"); set {
+		config.ContentSecurityPolicy = value
+	}
+	if value, set := os.LookupEnv("COD_FRAME_OPTIONS"); set {
+		config.FrameOptions = value
+	}
+	for _, origin := range strings.Split(os.Getenv("COD_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.AllowedOrigins = append(config.AllowedOrigins, normalizeOrigin(origin))
+		}
+	}
+	return config
+}
+
+// Middleware applies security headers and rejects cross-site requests that change state
+type Middleware struct {
+	config  Config
+	proxied func(*http.Request) bool
+}
+
+// NewMiddleware creates the middleware. proxied tells requests for the Couchbase console apart
+// from dashboard requests, as the console sets its own page headers.
+func NewMiddleware(config Config, proxied func(*http.Request) bool) *Middleware {
+	return &Middleware{config: config, proxied: proxied}
+}
+
+// Chain wraps a handler in middlewares, the first being the outermost
+func Chain(handler http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Headers sets the security headers and hands out the CSRF token cookie
+func (m *Middleware) Headers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		if m.config.Headers {
+			if m.config.HSTSMaxAge > 0 && secure(r) {
+				header.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d", int(m.config.HSTSMaxAge.Seconds())))
+			}
+			if !m.proxied(r) {
+				if m.config.ContentSecurityPolicy != "" {
+					header.Set("Content-Security-Policy", m.config.ContentSecurityPolicy)
+				}
+				if m.config.FrameOptions != "" {
+					header.Set("X-Frame-Options", m.config.FrameOptions)
+				}
+				header.Set("X-Content-Type-Options", "nosniff")
+				header.Set("Referrer-Policy", "same-origin")
+			}
+		}
+
+		if r.Method == http.MethodGet {
+			if _, err := r.Cookie(TokenCookie); err != nil {
+				http.SetCookie(w, &http.Cookie{
+					Name:     TokenCookie,
+					Value:    newToken(),
+					Path:     "/",
+					Secure:   secure(r),
+					SameSite: http.SameSiteStrictMode,
+				})
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSRF rejects requests that change state, and WebSocket upgrades, coming from another origin.
+// Requests that change state must carry the CSRF token of their cookie. Only when the token is not
+// required, requests without one are judged by their Origin or Referer alone.
+func (m *Middleware) CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrade := strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+		if !upgrade && !ChangesState(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		origin := requestOrigin(r)
+		if origin != "" && !m.allowedOrigin(origin, r) {
+			m.reject(w, r, "cross-origin request from "+origin)
+			return
+		}
+		if upgrade {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get(TokenHeader)
+		switch {
+		case token != "":
+			cookie, err := r.Cookie(TokenCookie)
+			if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+				m.reject(w, r, "invalid CSRF token")
+				return
+			}
+		case m.config.RequireToken:
+			m.reject(w, r, "missing CSRF token")
+			return
+		}
+		r.Header.Del(TokenHeader) // Not for Couchbase Server
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CheckOrigin tells whether a WebSocket upgrade comes from an allowed origin
+func (m *Middleware) CheckOrigin(r *http.Request) bool {
+	origin := requestOrigin(r)
+	return origin == "" || m.allowedOrigin(origin, r)
+}
+
+func (m *Middleware) allowedOrigin(origin string, r *http.Request) bool {
+	if origin == "null" {
+		return false // Sandboxed frames and some redirects
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	// Behind a reverse proxy the dashboard is reached under the proxy's host. Browsers do not let
+	// pages set this header on cross-site requests.
+	if forwarded := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0]); forwarded != "" && strings.EqualFold(parsed.Host, forwarded) {
+		return true
+	}
+	normalized := normalizeOrigin(origin)
+	for _, allowed := range m.config.AllowedOrigins {
+		if allowed == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Middleware) reject(w http.ResponseWriter, r *http.Request, reason string) {
+	logger.Log.Warn("Request rejected by CSRF protection",
+		zap.String("reason", reason),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("remoteAddr", r.RemoteAddr))
+	http.Error(w, "Forbidden: "+reason, http.StatusForbidden)
+}
+
+// requestOrigin returns the origin of a request from its Origin header, else its Referer
+func requestOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin
+	}
+	if referer, err := url.Parse(r.Header.Get("Referer")); err == nil && referer.Host != "" {
+		return referer.Scheme + "://" + referer.Host
+	}
+	return ""
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(origin, "/"))
+}
+
+// ChangesState tells whether a request method may change state: any method but the safe ones,
+// so that extension methods count as changes too
+func ChangesState(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+// secure tells whether the browser reached the dashboard over HTTPS
+func secure(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+func newToken() string {
+	token := make([]byte, 32)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
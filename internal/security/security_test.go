@@ -0,0 +1,103 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"cod/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+func TestCSRF(t *testing.T) {
+	tests := []struct {
+		name         string
+		requireToken bool
+		method       string
+		headers      map[string]string
+		cookie       string
+		want         int
+	}{
+		{"reads pass", true, "GET", nil, "", http.StatusOK},
+		{"TRACE is safe", true, "TRACE", nil, "", http.StatusOK},
+		{"matching token", true, "POST", map[string]string{TokenHeader: "abc"}, "abc", http.StatusOK},
+		{"matching token and own origin", true, "POST", map[string]string{TokenHeader: "abc", "Origin": "http://dashboard:3000"}, "abc", http.StatusOK},
+		{"token without cookie", true, "POST", map[string]string{TokenHeader: "abc"}, "", http.StatusForbidden},
+		{"wrong token", true, "DELETE", map[string]string{TokenHeader: "abc"}, "xyz", http.StatusForbidden},
+		{"missing token", true, "POST", nil, "abc", http.StatusForbidden},
+		{"missing token from own origin", true, "POST", map[string]string{"Origin": "http://dashboard:3000"}, "", http.StatusForbidden},
+		{"extension method needs the token", true, "PROPPATCH", nil, "", http.StatusForbidden},
+		{"cross origin with token", true, "POST", map[string]string{TokenHeader: "abc", "Origin": "http://evil.example"}, "abc", http.StatusForbidden},
+		{"cross origin by referer", false, "POST", map[string]string{"Referer": "http://evil.example/page"}, "", http.StatusForbidden},
+		{"null origin", false, "POST", map[string]string{"Origin": "null"}, "", http.StatusForbidden},
+		{"allowed origin", false, "POST", map[string]string{"Origin": "https://ops.example/"}, "", http.StatusOK},
+		{"forwarded host", false, "POST", map[string]string{"Origin": "https://cod.example", "X-Forwarded-Host": "cod.example"}, "", http.StatusOK},
+		{"scripted client when not required", false, "POST", nil, "", http.StatusOK},
+		{"cross origin upgrade", true, "GET", map[string]string{"Upgrade": "websocket", "Origin": "http://evil.example"}, "", http.StatusForbidden},
+		{"upgrade needs no token", true, "GET", map[string]string{"Upgrade": "websocket", "Origin": "http://dashboard:3000"}, "", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			middleware := NewMiddleware(Config{RequireToken: test.requireToken, AllowedOrigins: []string{"https://ops.example"}},
+				func(*http.Request) bool { return false })
+			var forwarded *http.Request
+			handler := middleware.CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { forwarded = r }))
+
+			r := httptest.NewRequest(test.method, "http://dashboard:3000/cui/dev/settings/ldap", nil)
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+			if test.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: TokenCookie, Value: test.cookie})
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.want, w.Body.String())
+			}
+			if forwarded != nil && ChangesState(test.method) && forwarded.Header.Get(TokenHeader) != "" {
+				t.Error("CSRF token forwarded to the handler")
+			}
+		})
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	middleware := NewMiddleware(Config{AllowedOrigins: []string{"https://ops.example"}}, func(*http.Request) bool { return false })
+	tests := map[string]bool{
+		"":                      true, // Non-browser clients
+		"http://dashboard:3000": true,
+		"HTTP://DASHBOARD:3000": true,
+		"https://ops.example":   true,
+		"http://evil.example":   false,
+		"null":                  false,
+	}
+	for origin, want := range tests {
+		r := httptest.NewRequest("GET", "http://dashboard:3000/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if got := middleware.CheckOrigin(r); got != want {
+			t.Errorf("CheckOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestConfigFromEnvRequiresToken(t *testing.T) {
+	t.Setenv("COD_CSRF_REQUIRE_TOKEN", "")
+	if !ConfigFromEnv().RequireToken {
+		t.Error("the CSRF token must be required by default")
+	}
+	t.Setenv("COD_CSRF_REQUIRE_TOKEN", "false")
+	if ConfigFromEnv().RequireToken {
+		t.Error("COD_CSRF_REQUIRE_TOKEN=false must opt out")
+	}
+}
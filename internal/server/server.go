@@ -5,19 +5,39 @@ import (
 	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"cod/internal/alerts"
+	"cod/internal/audit"
 	"cod/internal/cluster"
+	"cod/internal/events"
+	"cod/internal/health"
+	"cod/internal/history"
+	"cod/internal/limits"
 	"cod/internal/logger"
+	"cod/internal/logs"
+	"cod/internal/metrics"
+	"cod/internal/prometheus"
+	"cod/internal/reconcile"
+	"cod/internal/security"
+	"cod/internal/serverstats"
+	"cod/internal/topology"
+	"cod/internal/uiproxy"
 	"cod/internal/utils"
+	"cod/internal/volumes"
 
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 )
 
 type Client struct {
+	id                   string // Server-assigned identifier used to route messages to this client only
+	identity             string // Who the client's connections and log sessions count against
 	conn                 *websocket.Conn
 	watchEventslist      map[string]bool
 	watchEventslistMutex sync.RWMutex // Mutex for watchEventslist
@@ -33,7 +53,10 @@ type Server struct {
 	clusters               map[string]struct{}                 // Set of active cluster names
 	clustersMutex          sync.RWMutex                        // Mutex for protecting clusters map
 	clusterConditions      map[string][]map[string]interface{} // Cache of K8s conditions per cluster
-	clusterConditionsMutex sync.RWMutex                        // Mutex for protecting clusterConditions map
+	clusterConditionsMutex sync.RWMutex                        // Mutex for protecting clusterConditions map and conditionsSeq
+	conditionsSeq          uint64                              // Sequence number of the last conditions delta
+	clusterInformer        cache.SharedIndexInformer           // CouchbaseCluster informer, source of conditions snapshots
+	clientSeq              atomic.Uint64                       // Counter for generating client IDs
 	upgrader               websocket.Upgrader
 	clients                map[*Client]bool              // Set of currently connected clients
 	clientsMapMutex        sync.RWMutex                  // Mutex for clients map
@@ -44,10 +67,26 @@ type Server struct {
 	eventCacheMutex        sync.RWMutex                  // Mutex for eventCache map
 	clientset              *kubernetes.Clientset
 	dynamicClient          dynamic.Interface
-	allowedMetrics         map[string]bool  // Set of Prometheus metrics allowed to be proxied
-	pendingClients         map[*Client]bool // Set of clients with queued events waiting to be sent
-	pendingClientsMutex    sync.Mutex       // Mutex for pendingClients map
-	namespace              string           // K8s namespace to watch for resources
+	metricsFilter          *metrics.Filter           // Selects the Prometheus metrics exposed by the dashboard
+	pendingClients         map[*Client]bool          // Set of clients with queued events waiting to be sent
+	pendingClientsMutex    sync.Mutex                // Mutex for pendingClients map
+	namespace              string                    // K8s namespace to watch for resources
+	specHistory            *history.Store            // Recent spec generations and diffs per cluster
+	reconcileTracker       *reconcile.Tracker        // Reconcile lag and stuck-reconcile detection per cluster
+	topologyWatcher        *topology.Watcher         // Pod and node informers for per-cluster placement
+	volumeCollector        *volumes.Collector        // PVC capacity and kubelet usage per cluster
+	alertEngine            *alerts.Engine            // Alert rule evaluation and notification delivery
+	metricsHistory         *metrics.History          // Scraped operator metrics retained for range queries
+	serverStats            *serverstats.Collector    // Couchbase Server bucket and node stats per cluster
+	prometheus             *prometheus.Client        // Optional external Prometheus for long-range queries; nil when disabled
+	operatorMetrics        *metrics.OperatorScraper  // Discovers and scrapes the operator replicas' metrics endpoints
+	healthScorer           *health.Scorer            // Per-cluster health scores ranked across the fleet
+	stormDetector          *events.StormDetector     // Collapses repeated and bursty events out of the event feed
+	uiProxies              *uiproxy.Registry         // Couchbase UI reverse proxy per cluster, sharing a tuned transport
+	proxyPolicy            *uiproxy.Policy           // Read-only mode and allow/deny rules for Couchbase UI requests
+	auditLog               *audit.Log                // Console changes and dashboard actions, searchable and on disk
+	consoleLogins          *uiproxy.CredentialsCache // Couchbase logins injected for single sign-on into the console
+	limiter                *limits.Limiter           // Caps on WebSockets, log streams and console request rates
 }
 
 func NewServer() *Server {
@@ -60,20 +99,19 @@ func NewServer() *Server {
 		eventCache:        make(map[string][]utils.Message),
 		pendingClients:    make(map[*Client]bool),
 		clusters:          make(map[string]struct{}),
-		allowedMetrics: map[string]bool{
-			"couchbase_operator_cpu_under_management":               true,
-			"couchbase_operator_in_place_upgrade_failures":          true,
-			"couchbase_operator_memory_under_management_bytes":      true,
-			"couchbase_operator_reconcile_failures":                 true,
-			"couchbase_operator_pod_replacements_failed":            true,
-			"couchbase_operator_pod_recovery_failures_total":        true,
-			"couchbase_operator_pod_recoveries_total":               true,
-			"couchbase_operator_swap_rebalance_failures":            true,
-			"couchbase_operator_swap_rebalances_total":              true,
-			"couchbase_operator_volume_size_under_management_bytes": true,
-			"couchbase_operator_pod_replacements_total":             true,
-			"couchbase_operator_in_place_upgrades_total":            true,
-		},
+		specHistory:       history.NewStore(utils.GetEnvInt("COD_SPEC_HISTORY_LIMIT", 50)),
+		reconcileTracker:  reconcile.NewTracker(utils.GetEnvDuration("COD_RECONCILE_STUCK_THRESHOLD", 10*time.Minute)),
+		metricsHistory: metrics.NewHistory(utils.GetEnvDuration("COD_METRICS_SCRAPE_INTERVAL", 15*time.Second),
+			utils.GetEnvDuration("COD_METRICS_RETENTION", 6*time.Hour)),
+		serverStats:  serverstats.NewCollector(),
+		limiter:      limits.NewLimiter(limits.ConfigFromEnv()),
+		healthScorer: health.NewScorer(utils.GetEnvDuration("COD_HEALTH_EVENT_WINDOW", 15*time.Minute)),
+		stormDetector: events.NewStormDetector(events.StormConfig{
+			Window:          utils.GetEnvDuration("COD_EVENT_STORM_WINDOW", 5*time.Minute),
+			RepeatThreshold: utils.GetEnvInt("COD_EVENT_STORM_REPEAT_THRESHOLD", 5),
+			RateThreshold:   utils.GetEnvInt("COD_EVENT_STORM_RATE_THRESHOLD", 30),
+			UpdateInterval:  10 * time.Second,
+		}),
 	}
 }
 
@@ -113,10 +151,132 @@ func (s *Server) Start() {
 		return
 	}
 
-	// Start the cluster watcher in the background
+	// Find the operator's metrics endpoints through its Service and pods, or use the configured URLs
+	s.operatorMetrics, err = metrics.NewOperatorScraper(s.clientset, s.namespace, metrics.TargetsConfigFromEnv())
+	if err != nil {
+		logger.Log.Fatal("Cannot start server - invalid operator metrics settings", zap.Error(err))
+		return
+	}
+
+	// Load alert rules and receivers
+	alertConfig, err := alerts.LoadConfig(os.Getenv("COD_ALERT_RULES_FILE"))
+	if err != nil {
+		logger.Log.Fatal("Cannot start server - invalid alert rules",
+			zap.Error(err),
+			zap.String("file", os.Getenv("COD_ALERT_RULES_FILE")))
+		return
+	}
+	alertReceivers, err := alerts.NewReceivers(alertConfig.Receivers)
+	if err != nil {
+		logger.Log.Fatal("Cannot start server - invalid alert receivers", zap.Error(err))
+		return
+	}
+	s.alertEngine = alerts.NewEngine(alertConfig, alertReceivers, utils.GetEnvDuration("COD_ALERT_REPEAT_INTERVAL", 4*time.Hour))
+	logger.Log.Info("Alerting configured",
+		zap.Int("rules", len(alertConfig.Rules)),
+		zap.Int("receivers", len(alertReceivers)))
+
+	// Create the cluster informer and the subsystems its handlers feed, then start the cluster watcher
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	go cluster.StartClusterWatcher(ctx, s.dynamicClient, s.addCluster, s.deleteCluster, s.updateConditions)
+	s.clusterInformer = cluster.NewClusterInformer(s.dynamicClient, s.namespace)
+	s.uiProxies, err = uiproxy.NewRegistry(config, s.clientset, s.namespace, uiproxy.ConfigFromEnv())
+	if err != nil {
+		logger.Log.Fatal("Cannot start server - invalid Couchbase UI proxy settings", zap.Error(err))
+		return
+	}
+	s.proxyPolicy, err = uiproxy.NewPolicy(os.Getenv("COD_PROXY_POLICY_FILE"))
+	if err != nil {
+		logger.Log.Fatal("Cannot start server - invalid Couchbase UI proxy policy",
+			zap.Error(err),
+			zap.String("file", os.Getenv("COD_PROXY_POLICY_FILE")))
+		return
+	}
+	go s.proxyPolicy.Watch(ctx.Done(), 30*time.Second)
+	s.consoleLogins = uiproxy.NewCredentialsCache(s.consoleCredentials)
+	auditConfig := audit.ConfigFromEnv()
+	var emitAuditEvent func(audit.Entry)
+	if auditConfig.Events {
+		emitAuditEvent = audit.EventEmitter(s.clientset, s.clusterObject)
+	}
+	s.auditLog, err = audit.NewLog(auditConfig, emitAuditEvent)
+	if err != nil {
+		logger.Log.Fatal("Cannot start server - failed to open the audit log",
+			zap.Error(err),
+			zap.String("file", auditConfig.File))
+		return
+	}
+	s.topologyWatcher = topology.NewWatcher(s.clientset, s.namespace, utils.GetEnvDuration("COD_POD_PENDING_TIMEOUT", 5*time.Minute))
+	s.volumeCollector = volumes.NewCollector(s.clientset, s.namespace, float64(utils.GetEnvInt("COD_VOLUME_FILL_THRESHOLD", 80)))
+	go cluster.StartClusterWatcher(ctx, s.clusterInformer, s.addCluster, s.deleteCluster, s.updateConditions, s.updateCluster)
+
+	// Watch Couchbase Server pods and publish their placement per cluster
+	go s.topologyWatcher.Start(ctx, s.publishTopology)
+
+	// Collect PVC capacity and usage per cluster
+	go s.volumeCollector.Run(ctx, utils.GetEnvDuration("COD_VOLUME_CHECK_INTERVAL", time.Minute),
+		s.clusterNames, s.topologyWatcher.Pods, s.broadcastVolumeWarning)
+
+	// Scrape Couchbase Server metrics from the cluster pods
+	go s.serverStats.Run(ctx, utils.GetEnvDuration("COD_SERVER_METRICS_INTERVAL", 30*time.Second),
+		s.clusterNames, s.clusterObject, s.topologyWatcher.Pods, s.adminCredentials, s.clusterTLS)
+
+	// Track reconcile progress from operator logs and the reconcile failures metric
+	go logs.FollowOperatorLogs(ctx, s.clientset, s.namespace, s.reconcileTracker.ObserveLogLine)
+	go s.reconcileTracker.Run(ctx, utils.GetEnvDuration("COD_RECONCILE_CHECK_INTERVAL", 30*time.Second),
+		s.metricsHistory.Latest, s.broadcastReconcileStatus)
+
+	// Pick up moved console Services and rotated TLS Secrets of the proxied clusters
+	go s.uiProxies.Run(ctx, utils.GetEnvDuration("COD_PROXY_REFRESH_INTERVAL", 5*time.Minute),
+		s.clusterNames, s.clusterObject)
+
+	// Publish updates of collapsed event storms and per-cluster event anomalies
+	go s.stormDetector.Run(ctx, 10*time.Second, s.publishStorm, s.broadcastEventAnomaly)
+
+	// Evaluate alert rules over conditions, Warning events and operator metrics
+	go events.WatchWarningEvents(ctx, s.clientset, s.namespace, s.observeWarningEvent)
+	go s.alertEngine.Run(ctx, utils.GetEnvDuration("COD_ALERT_EVAL_INTERVAL", 30*time.Second),
+		s.clusterNames, s.currentConditions, s.metricsHistory.Latest, s.broadcastAlert)
+
+	// Score cluster health from conditions, Warning events, pod readiness and reconcile state
+	go s.healthScorer.Run(ctx, utils.GetEnvDuration("COD_HEALTH_INTERVAL", 30*time.Second),
+		s.clusterNames, s.healthInputs, s.broadcastFleetHealth)
+
+	// Load the metrics filter and reload it when its file changes
+	s.metricsFilter, err = metrics.NewFilter(os.Getenv("COD_METRICS_FILTER_FILE"))
+	if err != nil {
+		logger.Log.Fatal("Cannot start server - invalid metrics filter",
+			zap.Error(err),
+			zap.String("file", os.Getenv("COD_METRICS_FILTER_FILE")))
+		return
+	}
+	go s.metricsFilter.Watch(ctx.Done(), 30*time.Second)
+
+	// Scrape operator metrics into the history, restoring a previous run's history if persisted
+	metricsHistoryFile := os.Getenv("COD_METRICS_HISTORY_FILE")
+	if metricsHistoryFile != "" {
+		s.metricsHistory.Load(metricsHistoryFile)
+	}
+	go s.metricsHistory.Run(ctx, s.fetchOperatorMetrics, s.metricsFilter.Apply, metricsHistoryFile)
+
+	// Connect to an external Prometheus for long-range history when configured
+	if prometheusConfig := prometheus.ConfigFromEnv(); prometheusConfig.URL != "" {
+		templates, err := prometheus.LoadTemplates(os.Getenv("COD_PROMETHEUS_TEMPLATES_FILE"))
+		if err != nil {
+			logger.Log.Fatal("Cannot start server - invalid Prometheus query templates",
+				zap.Error(err),
+				zap.String("file", os.Getenv("COD_PROMETHEUS_TEMPLATES_FILE")))
+			return
+		}
+		s.prometheus, err = prometheus.NewClient(prometheusConfig, templates)
+		if err != nil {
+			logger.Log.Fatal("Cannot start server - invalid Prometheus configuration", zap.Error(err))
+			return
+		}
+		logger.Log.Info("Prometheus integration enabled",
+			zap.String("url", s.prometheus.URL()),
+			zap.Int("templates", len(templates.List())))
+	}
 
 	// Set up HTTP handlers
 	fs := http.FileServer(http.Dir("static"))
@@ -128,6 +288,23 @@ func (s *Server) Start() {
 	http.HandleFunc("/ws", s.handleConnections)
 	http.HandleFunc("/cui/", s.handleCouchbaseUIProxy)
 	http.HandleFunc("/metrics", s.handleMetricsEndpoint)
+	http.HandleFunc("/api/clusters/", s.handleClusterAPI)
+	http.HandleFunc("/api/reconcile", s.handleReconcileAPI)
+	http.HandleFunc("/api/health", s.handleHealthAPI)
+	http.HandleFunc("/api/proxy", s.handleProxyAPI)
+	http.HandleFunc("/api/events/", s.handleEventsAPI)
+	http.HandleFunc("/api/alerts", s.auditDashboard(s.handleAlertsAPI))
+	http.HandleFunc("/api/alerts/", s.auditDashboard(s.handleAlertsAPI))
+	http.HandleFunc("/api/prometheus", s.handlePrometheusAPI)
+	http.HandleFunc("/api/prometheus/", s.handlePrometheusAPI)
+	http.HandleFunc("/api/metrics/", s.auditDashboard(s.handleMetricsAPI))
+	http.HandleFunc("/api/audit", s.handleAuditAPI)
+	http.HandleFunc("/api/limits", s.handleLimitsAPI)
+
+	// Apply security headers and CSRF checks in front of every route, the WebSocket included
+	protection := security.NewMiddleware(security.ConfigFromEnv(), s.proxiedRequest)
+	s.upgrader.CheckOrigin = protection.CheckOrigin
+	handler := security.Chain(http.DefaultServeMux, protection.Headers, protection.CSRF)
 
 	// Start the central message distribution goroutine
 	go s.handleMessages()
@@ -137,7 +314,7 @@ func (s *Server) Start() {
 		zap.String("port", ":3000"),
 		zap.String("namespace", s.namespace))
 
-	if err := http.ListenAndServe(":3000", nil); err != nil {
+	if err := http.ListenAndServe(":3000", handler); err != nil {
 		logger.Log.Fatal("Server failed",
 			zap.Error(err),
 			zap.String("port", ":3000"))
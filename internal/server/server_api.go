@@ -0,0 +1,602 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cod/internal/audit"
+	"cod/internal/logger"
+	"cod/internal/metrics"
+	"cod/internal/prometheus"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// handleClusterAPI serves the per-cluster JSON API at `/api/clusters/<clustername>/<resource>`.
+func (s *Server) handleClusterAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/clusters/"), "/", 2)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		logger.Log.Warn("Invalid cluster API path", zap.String("path", r.URL.Path))
+		http.NotFound(w, r)
+		return
+	}
+	clusterName, resource := parts[0], strings.TrimSuffix(parts[1], "/")
+
+	// Validate cluster exists
+	s.clustersMutex.RLock()
+	_, clusterExists := s.clusters[clusterName]
+	s.clustersMutex.RUnlock()
+
+	if !clusterExists {
+		logger.Log.Warn("Requested cluster not found", zap.String("cluster", clusterName))
+		http.NotFound(w, r)
+		return
+	}
+
+	switch resource {
+	case "history":
+		writeJSON(w, s.specHistory.History(clusterName))
+	case "topology":
+		clusterObj, exists := s.clusterObject(clusterName)
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, s.topologyWatcher.Build(clusterObj))
+	case "volumes":
+		report, exists := s.volumeCollector.Report(clusterName)
+		if !exists {
+			http.Error(w, "Volume report not collected yet", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, report)
+	case "serverstats":
+		stats, exists := s.serverStats.Stats(clusterName)
+		if !exists {
+			http.Error(w, "Server metrics not collected yet", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, stats)
+	case "reconcile":
+		status, _ := s.reconcileTracker.Status(clusterName)
+		writeJSON(w, status)
+	case "alerts":
+		writeJSON(w, s.alertEngine.Alerts(clusterName))
+	case "proxy":
+		proxy, exists := s.uiProxies.Get(clusterName)
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, proxy.Stats())
+	case "storms":
+		writeJSON(w, s.stormDetector.Storms(clusterName))
+	case "health":
+		summary, exists := s.healthScorer.Summary(clusterName)
+		if !exists {
+			http.Error(w, "Health not evaluated yet", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, summary)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleReconcileAPI serves the reconcile status of every cluster at `/api/reconcile`.
+func (s *Server) handleReconcileAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.reconcileTracker.All())
+}
+
+// handleHealthAPI serves the fleet health at `/api/health`, least healthy cluster first.
+func (s *Server) handleHealthAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.healthScorer.Fleet())
+}
+
+// handleProxyAPI serves the Couchbase UI proxy stats of every cluster at `/api/proxy`.
+func (s *Server) handleProxyAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.uiProxies.Stats())
+}
+
+// handleLimitsAPI serves the connection, log session and request rate limits with their current
+// use per client and rejection counts at `/api/limits`.
+func (s *Server) handleLimitsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.limiter.Stats())
+}
+
+// handleEventsAPI serves the event anomaly state of every cluster at `/api/events/anomalies`.
+func (s *Server) handleEventsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/events"), "/") {
+	case "anomalies":
+		writeJSON(w, s.stormDetector.Anomalies())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleAlertsAPI serves the alerting API:
+//   - GET /api/alerts lists pending and firing alerts, silences, rules and receivers
+//   - POST /api/alerts/silences creates a silence
+//   - DELETE /api/alerts/silences/<id> removes a silence
+//   - POST /api/alerts/test sends a test notification to every receiver
+func (s *Server) handleAlertsAPI(w http.ResponseWriter, r *http.Request) {
+	resource := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/alerts"), "/")
+
+	switch {
+	case resource == "" && r.Method == http.MethodGet:
+		writeJSON(w, map[string]interface{}{
+			"alerts":    s.alertEngine.Alerts(r.URL.Query().Get("cluster")),
+			"silences":  s.alertEngine.Silences(),
+			"rules":     s.alertEngine.Rules(),
+			"receivers": s.alertEngine.Receivers(),
+		})
+
+	case resource == "silences" && r.Method == http.MethodGet:
+		writeJSON(w, s.alertEngine.Silences())
+
+	case resource == "silences" && r.Method == http.MethodPost:
+		var request struct {
+			Rule     string `json:"rule"`
+			Cluster  string `json:"cluster"`
+			Duration string `json:"duration"`
+			Comment  string `json:"comment"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&request); err != nil {
+			http.Error(w, "Invalid silence request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil {
+			http.Error(w, "Invalid silence duration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		silence, err := s.alertEngine.AddSilence(request.Rule, request.Cluster, duration, request.Comment, s.proxyPolicy.User(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSONStatus(w, http.StatusCreated, silence)
+
+	case strings.HasPrefix(resource, "silences/") && r.Method == http.MethodDelete:
+		if !s.alertEngine.RemoveSilence(strings.TrimPrefix(resource, "silences/")) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case resource == "test" && r.Method == http.MethodPost:
+		results := s.alertEngine.Test(r.Context())
+		logger.Log.Info("Sent test alert notification", zap.Int("receivers", len(results)))
+		writeJSON(w, results)
+
+	case resource == "" || resource == "silences" || resource == "test" || strings.HasPrefix(resource, "silences/"):
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// auditDashboard audits the requests to a dashboard API handler that change its state, e.g.
+// creating silences or reloading the metrics filter.
+func (s *Server) auditDashboard(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			handler(w, r)
+			return
+		}
+
+		entry := audit.Entry{
+			Source:     audit.SourceDashboard,
+			User:       s.proxyPolicy.User(r),
+			RemoteAddr: r.RemoteAddr,
+			Cluster:    r.URL.Query().Get("cluster"),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Body:       audit.CaptureBody(r),
+		}
+		start := time.Now()
+		statusWriter := audit.NewStatusWriter(w)
+		handler(statusWriter, r)
+
+		entry.Time = start
+		entry.Status = statusWriter.Status()
+		entry.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		s.auditLog.Record(entry)
+	}
+}
+
+// handleAuditAPI searches the recent audit entries at
+// `/api/audit?cluster=<name>&user=<user>&source=proxy|dashboard&q=<text>&since=1h&limit=200`, newest
+// first. since is a duration back from now, Unix seconds or RFC3339.
+func (s *Server) handleAuditAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	query := audit.Query{
+		Cluster: values.Get("cluster"),
+		User:    values.Get("user"),
+		Source:  values.Get("source"),
+		Text:    values.Get("q"),
+		Limit:   200,
+	}
+	if value := values.Get("since"); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			query.Since = time.Now().Add(-duration)
+		} else if query.Since, err = parseTime(value); err != nil {
+			http.Error(w, "Invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		query.Limit = limit
+	}
+	writeJSON(w, s.auditLog.Search(query))
+}
+
+// handleMetricsAPI serves the scraped metrics history and the metrics filter:
+//   - GET /api/metrics/families lists the stored metric families
+//   - GET /api/metrics/range?metric=<name>&fn=raw|rate|increase&range=1h&step=30s&window=2m&match=<label>=<value>
+//     evaluates a range query; start and end (Unix seconds or RFC3339) may replace range.
+//     fn=quantile&q=0.99 estimates a histogram quantile.
+//     source=local|prometheus picks the backend; Prometheus is the default when configured.
+//   - GET /api/metrics/distributions?metric=<name>&window=5m&q=0.5&q=0.99 computes counts, averages
+//     and quantiles of histogram and summary families, since start and over the window
+//   - GET /api/metrics/targets lists the operator metrics endpoints and the health of their last scrape
+//   - GET /api/metrics/filter shows the metrics filter in effect
+//   - POST /api/metrics/filter/reload re-reads the metrics filter file
+func (s *Server) handleMetricsAPI(w http.ResponseWriter, r *http.Request) {
+	resource := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/metrics"), "/")
+
+	if resource == "filter/reload" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := s.metricsFilter.Reload(); err != nil {
+			logger.Log.Error("Failed to reload metrics filter", zap.Error(err))
+			http.Error(w, "Failed to reload metrics filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		config, loadedAt := s.metricsFilter.Config()
+		writeJSON(w, map[string]interface{}{"config": config, "loadedAt": loadedAt})
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch resource {
+	case "filter":
+		config, loadedAt := s.metricsFilter.Config()
+		writeJSON(w, map[string]interface{}{"config": config, "loadedAt": loadedAt})
+	case "families":
+		writeJSON(w, s.metricsHistory.Families())
+	case "targets":
+		writeJSON(w, s.operatorMetrics.Targets())
+	case "distributions":
+		s.handleDistributions(w, r)
+	case "range":
+		query, err := parseRangeQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, "Invalid range query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		source := r.URL.Query().Get("source")
+		if source == "" && s.prometheus != nil {
+			source = "prometheus"
+		}
+
+		var result []metrics.RangeSeries
+		switch source {
+		case "prometheus":
+			if s.prometheus == nil {
+				http.Error(w, "Prometheus integration is not configured", http.StatusServiceUnavailable)
+				return
+			}
+			// Prometheus holds more than the operator's metrics, so only what the metrics filter exposes is queried
+			if !s.metricsFilter.Selects(query.Metric, nil) {
+				http.Error(w, "Metric "+query.Metric+" is not exposed by the metrics filter", http.StatusForbidden)
+				return
+			}
+			expression, err := prometheus.RangeExpression(query)
+			if err != nil {
+				http.Error(w, "Invalid range query: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			series, err := s.prometheus.QueryRange(r.Context(), expression, query.Start, query.End, query.Step)
+			if err != nil {
+				writePrometheusError(w, err)
+				return
+			}
+			for _, entry := range series {
+				if s.metricsFilter.Selects(query.Metric, entry.Labels) {
+					result = append(result, entry)
+				}
+			}
+		case "", "local":
+			if result, err = s.metricsHistory.QueryRange(query); err != nil {
+				http.Error(w, "Invalid range query: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Invalid range query: unknown source "+source, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, result)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleDistributions serves the stats of the histogram and summary families of the current scrape,
+// each with the same stats over a window of the metrics history
+func (s *Server) handleDistributions(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	window := 5 * time.Minute
+	if value := values.Get("window"); value != "" {
+		var err error
+		if window, err = time.ParseDuration(value); err != nil || window <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+	}
+	quantiles := metrics.DefaultQuantiles
+	if len(values["q"]) > 0 {
+		quantiles = nil
+		for _, value := range values["q"] {
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil || q < 0 || q > 1 {
+				http.Error(w, "Invalid quantile "+value, http.StatusBadRequest)
+				return
+			}
+			quantiles = append(quantiles, q)
+		}
+	}
+
+	families, err := s.metricsHistory.Latest()
+	if err != nil {
+		logger.Log.Warn("Operator metrics not available", zap.Error(err))
+		http.Error(w, "Metrics not available: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if metric := values.Get("metric"); metric != "" {
+		var selected []*dto.MetricFamily
+		for _, mf := range families {
+			if mf.GetName() == metric {
+				selected = append(selected, mf)
+			}
+		}
+		families = selected
+	}
+
+	now := time.Now()
+	distributions := metrics.Distributions(s.metricsFilter.Apply(families), quantiles)
+	for _, distribution := range distributions {
+		for i := range distribution.Series {
+			distribution.Series[i].Window = s.metricsHistory.Window(distribution, distribution.Series[i].Labels, window, now, quantiles)
+		}
+	}
+	if distributions == nil {
+		distributions = []metrics.Distribution{}
+	}
+	writeJSON(w, map[string]interface{}{"window": window.String(), "distributions": distributions})
+}
+
+// handlePrometheusAPI serves the external Prometheus integration:
+//   - GET /api/prometheus shows whether it is enabled and lists the query templates
+//   - GET /api/prometheus/query?template=<name>&<param>=<value>&range=24h&step=5m runs an allowlisted
+//     template over a time range (start and end may replace range, as for /api/metrics/range)
+//   - GET /api/prometheus/rules lists the recording rules evaluated by Prometheus
+func (s *Server) handlePrometheusAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resource := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/prometheus"), "/")
+
+	if resource == "" {
+		if s.prometheus == nil {
+			writeJSON(w, map[string]interface{}{"enabled": false})
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"enabled":   true,
+			"url":       s.prometheus.URL(),
+			"templates": s.prometheus.Templates().List(),
+		})
+		return
+	}
+	if s.prometheus == nil {
+		http.Error(w, "Prometheus integration is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch resource {
+	case "query":
+		values := r.URL.Query()
+		params := make(map[string]string, len(values))
+		for name := range values {
+			params[name] = values.Get(name)
+		}
+		expression, err := s.prometheus.Render(r.Context(), values.Get("template"), params)
+		if err != nil {
+			http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		start, end, step, err := parseTimeRange(values)
+		if err != nil {
+			http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := s.prometheus.QueryRange(r.Context(), expression, start, end, step)
+		if err != nil {
+			writePrometheusError(w, err)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"query": expression, "series": result})
+	case "rules":
+		rules, err := s.prometheus.RecordingRules(r.Context())
+		if err != nil {
+			writePrometheusError(w, err)
+			return
+		}
+		writeJSON(w, rules)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writePrometheusError reports query errors as bad requests and anything else as a bad gateway
+func writePrometheusError(w http.ResponseWriter, err error) {
+	var apiErr *prometheus.APIError
+	if errors.As(err, &apiErr) && (apiErr.Type == "bad_data" || apiErr.Type == "execution") {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Log.Warn("Prometheus query failed", zap.Error(err))
+	http.Error(w, "Prometheus query failed: "+err.Error(), http.StatusBadGateway)
+}
+
+// parseRangeQuery builds a range query from URL parameters.
+func parseRangeQuery(values url.Values) (metrics.RangeQuery, error) {
+	query := metrics.RangeQuery{
+		Metric:   values.Get("metric"),
+		Func:     values.Get("fn"),
+		Matchers: make(map[string]string),
+	}
+	if query.Metric == "" {
+		return query, fmt.Errorf("metric is required")
+	}
+
+	var err error
+	if query.Start, query.End, query.Step, err = parseTimeRange(values); err != nil {
+		return query, err
+	}
+	if value := values.Get("window"); value != "" {
+		if query.Window, err = time.ParseDuration(value); err != nil {
+			return query, fmt.Errorf("invalid window: %w", err)
+		}
+	}
+	if query.Func == metrics.FuncQuantile {
+		if query.Quantile, err = strconv.ParseFloat(values.Get("q"), 64); err != nil {
+			return query, fmt.Errorf("invalid quantile: %w", err)
+		}
+	}
+
+	for _, matcher := range values["match"] {
+		name, value, found := strings.Cut(matcher, "=")
+		if !found || name == "" {
+			return query, fmt.Errorf("invalid matcher %q, expected label=value", matcher)
+		}
+		query.Matchers[name] = value
+	}
+	return query, nil
+}
+
+// parseTimeRange reads start and end, or a range ending now, and the step, which
+// defaults to about 240 points over the range.
+func parseTimeRange(values url.Values) (start, end time.Time, step time.Duration, err error) {
+	end = time.Now()
+	if value := values.Get("end"); value != "" {
+		if end, err = parseTime(value); err != nil {
+			return start, end, step, fmt.Errorf("invalid end: %w", err)
+		}
+	}
+	if value := values.Get("start"); value != "" {
+		if start, err = parseTime(value); err != nil {
+			return start, end, step, fmt.Errorf("invalid start: %w", err)
+		}
+	} else {
+		queryRange := time.Hour
+		if value := values.Get("range"); value != "" {
+			if queryRange, err = time.ParseDuration(value); err != nil {
+				return start, end, step, fmt.Errorf("invalid range: %w", err)
+			}
+		}
+		start = end.Add(-queryRange)
+	}
+
+	if value := values.Get("step"); value != "" {
+		if step, err = time.ParseDuration(value); err != nil {
+			return start, end, step, fmt.Errorf("invalid step: %w", err)
+		}
+	} else {
+		step = (end.Sub(start) / 240).Round(time.Second)
+		if step < time.Second {
+			step = time.Second
+		}
+	}
+	return start, end, step, nil
+}
+
+// parseTime accepts Unix seconds (with optional fraction) or RFC3339
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.UnixMilli(int64(seconds * 1000)), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// writeJSON marshals a payload and writes it as the JSON response body.
+func writeJSON(w http.ResponseWriter, payload interface{}) {
+	writeJSONStatus(w, http.StatusOK, payload)
+}
+
+// writeJSONStatus marshals a payload and writes it as the JSON response body with the given status.
+func writeJSONStatus(w http.ResponseWriter, status int, payload interface{}) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		logger.Log.Error("Failed to marshal API response to JSON", zap.Error(err))
+		http.Error(w, "Failed to convert response to JSON: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
@@ -1,82 +1,60 @@
 package server
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"fmt"
 	"html/template"
-	"io"
 	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"cod/internal/alerts"
 	"cod/internal/cluster"
 	"cod/internal/events"
+	"cod/internal/health"
+	"cod/internal/limits"
 	"cod/internal/logger"
 	"cod/internal/logs"
+	"cod/internal/metrics"
+	"cod/internal/reconcile"
+	"cod/internal/uiproxy"
 	"cod/internal/utils"
+	"cod/internal/volumes"
 
+	"github.com/gorilla/websocket"
 	dto "github.com/prometheus/client_model/go"
-	"github.com/prometheus/prom2json"
 	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/tools/cache"
 )
 
-// isAPIRequest attempts to heuristically determine if an HTTP request is intended for the
-// backend Couchbase API rather than a UI navigation request.
-func (s *Server) isAPIRequest(r *http.Request) bool {
-	// Check for common XHR header
-	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
-		return true
-	}
-
-	// Check Accept header: Requests accepting JSON/XML but *not* explicitly HTML are likely API calls.
-	accept := r.Header.Get("Accept")
-	if strings.Contains(accept, "application/json") ||
-		strings.Contains(accept, "application/xml") ||
-		strings.Contains(accept, "*/*") {
-		// Exclude requests that explicitly want HTML (likely browser navigation)
-		if !strings.Contains(accept, "text/html") {
-			return true
-		}
-	}
-
-	// Check for JSON content type header
-	if r.Header.Get("Content-Type") == "application/json" {
-		return true
-	}
-
-	// Explicit browser navigation headers usually indicate it's *not* an API request.
-	if strings.Contains(accept, "text/html") &&
-		r.Method == "GET" &&
-		r.Header.Get("Sec-Fetch-Mode") == "navigate" {
-		return false
-	}
-
-	// Fallback: Check for common Couchbase API path prefixes.
-	apiPrefixes := []string{
-		"/pools",
-		"/settings",
-		"/controller",
-		"/nodes",
-		"/indexes",
-		"/query",
-	}
-
-	for _, prefix := range apiPrefixes {
-		if strings.HasPrefix(r.URL.Path, prefix) {
-			return true
-		}
-	}
-
-	return false
-}
-
 // handleConnections upgrades HTTP requests to WebSocket connections and manages the client lifecycle.
 func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
 	remoteAddr := r.RemoteAddr
 	userAgent := r.UserAgent()
 
+	// Refuse connections beyond the limits before upgrading, so a looping client gets a 429
+	identity := limits.Client(s.proxyPolicy.Client(r))
+	release, limit := s.limiter.AcquireConnection(identity)
+	if limit != "" {
+		logger.Log.Warn("WebSocket connection rejected by limit",
+			zap.String("limit", limit),
+			zap.String("client", identity),
+			zap.String("remoteAddr", remoteAddr))
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "Too many connections ("+limit+")", http.StatusTooManyRequests)
+		return
+	}
+	defer release()
+
 	ws, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.Log.Error("Failed to upgrade to websocket",
@@ -89,6 +67,8 @@ func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
 
 	// Initialize client state
 	client := &Client{
+		id:              fmt.Sprintf("client-%d", s.clientSeq.Add(1)),
+		identity:        identity,
 		conn:            ws,
 		watchEventslist: make(map[string]bool),
 		logWatcher:      nil,
@@ -109,16 +89,9 @@ func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
 		zap.String("userAgent", userAgent),
 		zap.Int("activeClients", clientCount))
 
-	// Immediately load and broadcast initial cluster conditions for the new client.
+	// Send a conditions snapshot to the new client only; everyone else keeps receiving deltas.
 	// Done in a goroutine to avoid blocking the connection setup.
-	go func() {
-		err := cluster.LoadClusterConditions(s.dynamicClient, s.updateConditions)
-		if err != nil {
-			logger.Log.Error("Failed to load cluster conditions for new client",
-				zap.Error(err),
-				zap.String("remoteAddr", remoteAddr))
-		}
-	}()
+	go s.requestConditionsSnapshot(client)
 
 	// --- Client Disconnect Cleanup ---
 	// This defer runs when the main loop exits (connection closes or error).
@@ -157,6 +130,7 @@ func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	// --- Main Client Message Loop ---
+	messageBudget := s.limiter.NewMessageBudget()
 	for {
 		// Read incoming messages from the client WebSocket
 		_, message, err := ws.ReadMessage()
@@ -170,6 +144,18 @@ func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
 			break // Exit loop on error or close
 		}
 
+		// Every message may start watchers or streams, so a flooding client is disconnected
+		if messageBudget != nil && !messageBudget.Allow() {
+			s.limiter.Rejected(limits.LimitClientMessages)
+			logger.Log.Warn("Closing WebSocket of client sending too many messages",
+				zap.String("client", identity),
+				zap.String("remoteAddr", remoteAddr))
+			ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "message rate limit exceeded"),
+				time.Now().Add(time.Second))
+			break
+		}
+
 		// Decode the JSON message
 		var request struct {
 			Type       string          `json:"type"`
@@ -189,6 +175,13 @@ func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
 		}
 
 		switch request.Type {
+		case "conditionsSnapshot":
+			// Client detected a gap in the delta sequence and wants to resync
+			logger.Log.Debug("Client requested conditions snapshot",
+				zap.String("clientId", client.id),
+				zap.String("remoteAddr", remoteAddr))
+			go s.requestConditionsSnapshot(client)
+
 		case "clustersevents":
 			// Handle Request for Cluster Events
 
@@ -293,8 +286,23 @@ func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
-			// Start the log watching goroutine
-			s.startLogWatcher(client, startTime, endTime, request.Follow, request.ClusterMap, request.SessionID)
+			// Start the log watching goroutine, unless the client or the dashboard streams too many logs
+			release, limit := s.limiter.AcquireLogSession(identity)
+			if limit != "" {
+				logger.Log.Warn("Log session rejected by limit",
+					zap.String("limit", limit),
+					zap.String("client", identity),
+					zap.String("sessionId", request.SessionID))
+				go func(sessionID string) {
+					s.broadcast <- utils.Message{
+						Type:      "log",
+						SessionID: sessionID,
+						Message:   "Too many log sessions (" + limit + "), close other log views and try again\n",
+					}
+				}(request.SessionID)
+				continue
+			}
+			s.startLogWatcher(client, startTime, endTime, request.Follow, request.ClusterMap, request.SessionID, release)
 		}
 	}
 }
@@ -386,8 +394,8 @@ func (s *Server) cleanupEventWatchers(activeClusters map[string]bool) {
 	}
 }
 
-// startLogWatcher starts a log streaming session for a client.
-func (s *Server) startLogWatcher(client *Client, startTime, endTime *time.Time, follow bool, clusterNames map[string]bool, logSessionId string) {
+// startLogWatcher starts a log streaming session for a client. release is called when the session ends.
+func (s *Server) startLogWatcher(client *Client, startTime, endTime *time.Time, follow bool, clusterNames map[string]bool, logSessionId string, release func()) {
 	logContext := []zap.Field{
 		zap.String("sessionId", logSessionId),
 		zap.Any("clusterNames", clusterNames),
@@ -404,11 +412,19 @@ func (s *Server) startLogWatcher(client *Client, startTime, endTime *time.Time,
 
 	logger.Log.Info("Starting log watcher for client", logContext...)
 
+	// Stopping the watcher returns its session right away, so that a view switched to next can
+	// take it without waiting for the stream to wind down
 	ctx, cancel := context.WithCancel(context.Background())
 	client.stateMutex.Lock()
-	client.logWatcher = cancel
+	client.logWatcher = func() {
+		cancel()
+		release()
+	}
 	client.stateMutex.Unlock()
-	go logs.StartLogWatcher(ctx, s.clientset, s.broadcast, startTime, endTime, follow, clusterNames, logSessionId)
+	go func() {
+		defer release()
+		logs.StartLogWatcher(ctx, s.clientset, s.broadcast, startTime, endTime, follow, clusterNames, logSessionId)
+	}()
 }
 
 // processPendingClient attempts to send queued events (from client.eventQueue)
@@ -500,27 +516,102 @@ func (s *Server) handleMessages() {
 			broadcastPayload := map[string]interface{}{"type": "clusters", "clusters": msg.Clusters}
 			s.broadcastToAllClients(broadcastPayload)
 
-		case "conditionsUpdate":
-			// Broadcast latest cluster conditions
-			logger.Log.Debug("Broadcasting conditionsUpdate")
-			broadcastPayload := map[string]interface{}{"type": "clusterConditions", "conditions": msg.Conditions}
+		case "conditionsDelta":
+			// Broadcast the changed conditions of a single cluster
+			logger.Log.Debug("Broadcasting conditionsDelta",
+				zap.String("cluster", msg.ClusterName),
+				zap.Uint64("seq", msg.Seq),
+				zap.Bool("deleted", msg.Deleted))
+			broadcastPayload := map[string]interface{}{
+				"type":       "clusterConditionsDelta",
+				"seq":        msg.Seq,
+				"cluster":    msg.ClusterName,
+				"conditions": msg.Conditions[msg.ClusterName],
+				"deleted":    msg.Deleted,
+			}
 			s.broadcastToAllClients(broadcastPayload)
 
+		case "conditionsSnapshot":
+			// Send the full conditions map to the requesting client only.
+			// Handled here so the snapshot is ordered with respect to deltas.
+			client := s.findClient(msg.ClientID)
+			if client == nil {
+				logger.Log.Debug("Client disconnected before conditions snapshot could be sent",
+					zap.String("clientId", msg.ClientID))
+				continue
+			}
+			conditions, seq := s.snapshotConditions()
+			logger.Log.Debug("Sending conditions snapshot",
+				zap.String("clientId", msg.ClientID),
+				zap.Uint64("seq", seq),
+				zap.Int("clusterCount", len(conditions)))
+			s.sendToClient(client, map[string]interface{}{"type": "clusterConditions", "seq": seq, "conditions": conditions})
+
+		case "reconcileStatus":
+			// Broadcast a cluster's changed reconcile state
+			logger.Log.Debug("Broadcasting reconcileStatus", zap.String("cluster", msg.ClusterName))
+			s.broadcastToAllClients(map[string]interface{}{"type": "reconcileStatus", "cluster": msg.ClusterName, "status": msg.Data})
+
+		case "topology":
+			// Broadcast a cluster's changed pod topology
+			logger.Log.Debug("Broadcasting topology", zap.String("cluster", msg.ClusterName))
+			s.broadcastToAllClients(map[string]interface{}{"type": "topology", "cluster": msg.ClusterName, "topology": msg.Data})
+
+		case "volumeWarning":
+			// Broadcast a volume crossing the fill threshold
+			logger.Log.Debug("Broadcasting volumeWarning", zap.String("cluster", msg.ClusterName))
+			s.broadcastToAllClients(map[string]interface{}{"type": "volumeWarning", "cluster": msg.ClusterName, "warning": msg.Data})
+
+		case "alert":
+			// Broadcast an alert that started firing, resolved or changed silencing
+			logger.Log.Debug("Broadcasting alert", zap.String("cluster", msg.ClusterName))
+			s.broadcastToAllClients(map[string]interface{}{"type": "alert", "cluster": msg.ClusterName, "alert": msg.Data})
+
+		case "eventAnomaly":
+			// Broadcast a cluster's event anomaly state change
+			logger.Log.Debug("Broadcasting eventAnomaly", zap.String("cluster", msg.ClusterName))
+			s.broadcastToAllClients(map[string]interface{}{"type": "eventAnomaly", "cluster": msg.ClusterName, "anomaly": msg.Data})
+
+		case "fleetHealth":
+			// Broadcast the ranked fleet health after any cluster's score changed
+			logger.Log.Debug("Broadcasting fleetHealth")
+			s.broadcastToAllClients(map[string]interface{}{"type": "fleetHealth", "fleet": msg.Data})
+
 		case "event", "log", "cachedevent": // Route based on message type and client state
 			clusterName := msg.ClusterName
 			messageType := msg.Type
 			logger.Log.Debug("Processing message for specific clients", zap.String("type", messageType), zap.String("cluster", clusterName))
 
-			// Cache new K8s events
+			// Collapse event storms into a single summary entry, then cache new K8s events
 			if messageType == "event" {
+				var deliver bool
+				msg, deliver = s.stormDetector.Observe(msg, time.Now())
+				if !deliver {
+					continue
+				}
+
 				s.eventCacheMutex.Lock()
 				clusterEvents := s.eventCache[msg.ClusterName]
-				if len(clusterEvents) >= 1000 { // Limit cache size
-					clusterEvents = clusterEvents[1:]
-				}
 				cachedMsg := msg
 				cachedMsg.Type = "cachedevent" // Store with type "cachedevent"
-				s.eventCache[msg.ClusterName] = append(clusterEvents, cachedMsg)
+				replaced := false
+				if msg.Kind == events.StormKind {
+					// Keep a single, up to date entry per storm
+					for i := range clusterEvents {
+						if clusterEvents[i].Kind == events.StormKind && clusterEvents[i].Name == msg.Name {
+							clusterEvents[i] = cachedMsg
+							replaced = true
+							break
+						}
+					}
+				}
+				if !replaced {
+					if len(clusterEvents) >= 1000 { // Limit cache size
+						clusterEvents = clusterEvents[1:]
+					}
+					clusterEvents = append(clusterEvents, cachedMsg)
+				}
+				s.eventCache[msg.ClusterName] = clusterEvents
 				s.eventCacheMutex.Unlock()
 			}
 
@@ -668,6 +759,19 @@ func (s *Server) sendToClient(client *Client, payload interface{}) bool {
 	return true // Success
 }
 
+// findClient returns the connected client with the given ID, or nil if it has gone away.
+func (s *Server) findClient(clientID string) *Client {
+	s.clientsMapMutex.RLock()
+	defer s.clientsMapMutex.RUnlock()
+
+	for client := range s.clients {
+		if client.id == clientID {
+			return client
+		}
+	}
+	return nil
+}
+
 // broadcastToAllClients sends a payload to all currently connected clients.
 // Creates a snapshot of the client list to avoid holding lock during sends.
 // Failed sends result in client disconnection and removal.
@@ -737,6 +841,9 @@ func (s *Server) addCluster(obj interface{}) {
 		return
 	}
 
+	s.specHistory.Seed(unstructuredObj)
+	s.reconcileTracker.ObserveCluster(unstructuredObj)
+
 	s.clustersMutex.Lock()
 	_, exists := s.clusters[clusterName]
 
@@ -744,7 +851,9 @@ func (s *Server) addCluster(obj interface{}) {
 		s.clusters[clusterName] = struct{}{}
 		logger.Log.Info("Added new cluster to map", zap.String("cluster", clusterName))
 		s.clustersMutex.Unlock() // Unlock before broadcasting
-		s.broadcastClusters()    // Notify clients
+		s.uiProxies.Enqueue(clusterName)
+		s.broadcastClusters() // Notify clients
+		s.publishTopology(clusterName)
 	} else {
 		logger.Log.Debug("Cluster already in map", zap.String("cluster", clusterName))
 		s.clustersMutex.Unlock()
@@ -788,6 +897,7 @@ func (s *Server) deleteCluster(obj interface{}) {
 	}
 
 	var deleted bool
+	var seq uint64
 	s.clustersMutex.Lock() // Lock 1
 	_, exists := s.clusters[clusterName]
 	if exists {
@@ -801,13 +911,25 @@ func (s *Server) deleteCluster(obj interface{}) {
 			delete(s.clusterConditions, clusterName)
 			logger.Log.Info("Removed cluster conditions for", zap.String("cluster", clusterName))
 		}
+		s.conditionsSeq++
+		seq = s.conditionsSeq
 		s.clusterConditionsMutex.Unlock() // Unlock 2
 	}
 	s.clustersMutex.Unlock() // Unlock 1
 
 	if deleted { // Broadcast only if deleted
+		s.specHistory.Delete(clusterName)
+		s.reconcileTracker.Remove(clusterName)
+		s.topologyWatcher.Forget(clusterName)
+		s.volumeCollector.Forget(clusterName)
+		s.serverStats.Forget(clusterName)
+		s.healthScorer.Forget(clusterName)
+		s.stormDetector.Forget(clusterName)
+		s.uiProxies.Remove(clusterName)
+		s.consoleLogins.Remove(clusterName)
+		s.limiter.Forget(clusterName)
 		s.broadcastClusters()
-		s.broadcastConditions()
+		s.broadcastConditionsDelta(clusterName, nil, seq, true)
 	}
 }
 
@@ -856,64 +978,273 @@ func (s *Server) updateConditions(obj interface{}) {
 	}
 
 	// Extract conditions from status
-	status, found, err := unstructured.NestedMap(unstructuredObj.Object, "status")
+	conditionsList, found, err := cluster.ExtractConditions(unstructuredObj)
 	if err != nil {
-		logger.Log.Error("Error getting status field", zap.Error(err), zap.String("cluster", clusterName))
+		logger.Log.Error("Error getting conditions field", zap.Error(err), zap.String("cluster", clusterName))
 		return
 	}
 	if !found {
 		logger.Log.Debug("No status field found in object", zap.String("cluster", clusterName))
 		return
 	}
-
-	conditionsRaw, found, err := unstructured.NestedSlice(status, "conditions")
-	if err != nil {
-		logger.Log.Error("Error getting conditions field", zap.Error(err), zap.String("cluster", clusterName))
-		return
-	}
-	if !found || len(conditionsRaw) == 0 {
+	if len(conditionsList) == 0 {
 		logger.Log.Debug("No conditions found in status", zap.String("cluster", clusterName))
 		// Still update cache with empty slice below
 	}
 
-	// Convert []interface{} to []map[string]interface{}
-	conditionsList := make([]map[string]interface{}, 0, len(conditionsRaw))
-	for _, condition := range conditionsRaw {
-		if condMap, ok := condition.(map[string]interface{}); ok {
-			conditionsList = append(conditionsList, condMap)
-		} else {
-			logger.Log.Warn("Condition item is not a map[string]interface{}", zap.Any("condition", condition))
-		}
-	}
-
-	// Update cache
+	// Update cache, skipping the broadcast if nothing changed (e.g. spec-only or resync updates)
 	s.clusterConditionsMutex.Lock()
+	cached, cachedExists := s.clusterConditions[clusterName]
+	if cachedExists && reflect.DeepEqual(cached, conditionsList) {
+		s.clusterConditionsMutex.Unlock()
+		logger.Log.Debug("Conditions unchanged, skipping broadcast", zap.String("cluster", clusterName))
+		return
+	}
 	s.clusterConditions[clusterName] = conditionsList
+	s.conditionsSeq++
+	seq := s.conditionsSeq
 	s.clusterConditionsMutex.Unlock()
-	logger.Log.Debug("Updated conditions cache for cluster", zap.String("cluster", clusterName))
+	logger.Log.Debug("Updated conditions cache for cluster", zap.String("cluster", clusterName), zap.Uint64("seq", seq))
 
-	// Broadcast updated conditions
-	s.broadcastConditions()
+	// Broadcast the change for this cluster only
+	s.broadcastConditionsDelta(clusterName, conditionsList, seq, false)
 }
 
-// broadcastConditions sends the complete conditions cache via the broadcast channel.
-func (s *Server) broadcastConditions() {
-	// Create deep copy under read lock
-	s.clusterConditionsMutex.RLock()
-	conditionsToSend := make(map[string][]map[string]interface{}) // Outer map copy
-	for k, v := range s.clusterConditions {
-		// Copy inner slice
-		innerCopy := make([]map[string]interface{}, len(v))
-		copy(innerCopy, v) // Note: map references inside slice elements are shared
-		conditionsToSend[k] = innerCopy
+// updateCluster handles update events from the cluster informer,
+// recording spec changes between generations and tracking reconcile progress.
+func (s *Server) updateCluster(oldObj, newObj interface{}) {
+	oldUnstructured, ok := oldObj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	newUnstructured, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	s.specHistory.Record(oldUnstructured, newUnstructured)
+	s.reconcileTracker.ObserveCluster(newUnstructured)
+	oldNetworking, _, _ := unstructured.NestedFieldNoCopy(oldUnstructured.Object, "spec", "networking")
+	newNetworking, _, _ := unstructured.NestedFieldNoCopy(newUnstructured.Object, "spec", "networking")
+	if !reflect.DeepEqual(oldNetworking, newNetworking) ||
+		!reflect.DeepEqual(oldUnstructured.GetAnnotations(), newUnstructured.GetAnnotations()) {
+		s.uiProxies.Enqueue(newUnstructured.GetName()) // The console may have been exposed, moved or switched to TLS
+	}
+	s.publishTopology(newUnstructured.GetName()) // spec.servers may have changed
+}
+
+// clusterObject returns the CouchbaseCluster object from the informer cache.
+func (s *Server) clusterObject(clusterName string) (*unstructured.Unstructured, bool) {
+	obj, exists, err := s.clusterInformer.GetStore().GetByKey(s.namespace + "/" + clusterName)
+	if err != nil || !exists {
+		return nil, false
+	}
+	unstructuredObj, ok := obj.(*unstructured.Unstructured)
+	return unstructuredObj, ok
+}
+
+// adminCredentials returns the Couchbase administrator credentials of a cluster.
+func (s *Server) adminCredentials(ctx context.Context, clusterObj *unstructured.Unstructured) (string, string, error) {
+	return cluster.AdminCredentials(ctx, s.clientset, clusterObj)
+}
+
+// clusterTLS returns the spec.networking.tls material of a cluster, nil when it does not use TLS.
+func (s *Server) clusterTLS(ctx context.Context, clusterObj *unstructured.Unstructured) (*cluster.TLS, error) {
+	return cluster.TLSSettings(ctx, s.clientset, clusterObj)
+}
+
+// consoleCredentials returns the login of a CouchbaseUser of a cluster, or of its administrator
+// when couchbaseUser is empty, for single sign-on into the console.
+func (s *Server) consoleCredentials(ctx context.Context, clusterObj *unstructured.Unstructured, couchbaseUser string) (uiproxy.Credentials, error) {
+	var username, password string
+	var err error
+	if couchbaseUser == "" {
+		username, password, err = cluster.AdminCredentials(ctx, s.clientset, clusterObj)
+	} else {
+		username, password, err = cluster.UserCredentials(ctx, s.clientset, s.dynamicClient, clusterObj.GetNamespace(), couchbaseUser)
+	}
+	return uiproxy.Credentials{Username: username, Password: password}, err
+}
+
+// publishTopology rebuilds a cluster's pod topology and broadcasts it if it changed.
+func (s *Server) publishTopology(clusterName string) {
+	clusterObj, exists := s.clusterObject(clusterName)
+	if !exists {
+		return
+	}
+
+	clusterTopology := s.topologyWatcher.Build(clusterObj)
+	if !s.topologyWatcher.Changed(clusterTopology) {
+		return
 	}
+
+	s.broadcast <- utils.Message{
+		Type:        "topology",
+		ClusterName: clusterName,
+		Data:        clusterTopology,
+	}
+	logger.Log.Debug("Sent topology to broadcast channel",
+		zap.String("cluster", clusterName),
+		zap.Int("violations", len(clusterTopology.Violations)))
+}
+
+// broadcastVolumeWarning sends a volume fill threshold warning via the broadcast channel.
+func (s *Server) broadcastVolumeWarning(warning volumes.Warning) {
+	s.broadcast <- utils.Message{
+		Type:        "volumeWarning",
+		ClusterName: warning.Cluster,
+		Data:        warning,
+	}
+}
+
+// clusterNames returns a snapshot of the tracked cluster names.
+func (s *Server) clusterNames() []string {
+	s.clustersMutex.RLock()
+	defer s.clustersMutex.RUnlock()
+
+	names := make([]string, 0, len(s.clusters))
+	for clusterName := range s.clusters {
+		names = append(names, clusterName)
+	}
+	return names
+}
+
+// broadcastReconcileStatus sends a cluster's changed reconcile status via the broadcast channel.
+func (s *Server) broadcastReconcileStatus(status reconcile.Status) {
+	s.broadcast <- utils.Message{
+		Type:        "reconcileStatus",
+		ClusterName: status.Cluster,
+		Data:        status,
+	}
+}
+
+// publishStorm sends a storm summary entry through the event pipeline.
+func (s *Server) publishStorm(msg utils.Message) {
+	s.broadcast <- msg
+}
+
+// broadcastEventAnomaly sends a cluster's changed event anomaly state via the broadcast channel.
+func (s *Server) broadcastEventAnomaly(anomaly events.Anomaly) {
+	s.broadcast <- utils.Message{
+		Type:        "eventAnomaly",
+		ClusterName: anomaly.Cluster,
+		Data:        anomaly,
+	}
+}
+
+// broadcastFleetHealth sends the ranked fleet health via the broadcast channel.
+func (s *Server) broadcastFleetHealth(fleet []health.Summary) {
+	s.broadcast <- utils.Message{
+		Type: "fleetHealth",
+		Data: fleet,
+	}
+}
+
+// healthInputs gathers the signals a cluster's health score is computed from.
+func (s *Server) healthInputs(clusterName string) health.Inputs {
+	s.clusterConditionsMutex.RLock()
+	conditions := s.clusterConditions[clusterName]
 	s.clusterConditionsMutex.RUnlock()
 
+	inputs := health.Inputs{Conditions: conditions}
+	if pods, err := s.topologyWatcher.Pods(clusterName); err == nil {
+		inputs.Pods = pods
+	}
+	if status, exists := s.reconcileTracker.Status(clusterName); exists {
+		inputs.Reconcile = &status
+	}
+	return inputs
+}
+
+// broadcastAlert sends an alert state change via the broadcast channel.
+func (s *Server) broadcastAlert(alert alerts.Alert) {
 	s.broadcast <- utils.Message{
-		Type:       "conditionsUpdate",
-		Conditions: conditionsToSend,
+		Type:        "alert",
+		ClusterName: alert.Cluster,
+		Data:        alert,
 	}
-	logger.Log.Debug("Sent conditionsUpdate to broadcast channel", zap.Int("clusterCount", len(conditionsToSend)))
+}
+
+// observeWarningEvent attributes a Warning event to its cluster and feeds it to the alert engine and health scorer.
+func (s *Server) observeWarningEvent(event *v1.Event) {
+	var clusterName string
+	switch event.InvolvedObject.Kind {
+	case "CouchbaseCluster":
+		clusterName = event.InvolvedObject.Name
+	case "Pod":
+		clusterName = s.topologyWatcher.PodCluster(event.InvolvedObject.Namespace, event.InvolvedObject.Name)
+	}
+	if clusterName == "" {
+		return
+	}
+
+	s.healthScorer.ObserveEvent(clusterName, events.LastSeen(event))
+	s.alertEngine.ObserveEvent(alerts.Event{
+		Cluster: clusterName,
+		Kind:    event.InvolvedObject.Kind,
+		Name:    event.InvolvedObject.Name,
+		Reason:  event.Reason,
+		Message: event.Message,
+		Time:    events.LastSeen(event),
+	})
+}
+
+// currentConditions returns the conditions of every cluster for alert evaluation.
+func (s *Server) currentConditions() map[string][]map[string]interface{} {
+	conditions, _ := s.snapshotConditions()
+	return conditions
+}
+
+// broadcastConditionsDelta sends the conditions of a single cluster via the broadcast channel.
+// A deleted delta tells clients to drop the cluster.
+func (s *Server) broadcastConditionsDelta(clusterName string, conditions []map[string]interface{}, seq uint64, deleted bool) {
+	s.broadcast <- utils.Message{
+		Type:        "conditionsDelta",
+		ClusterName: clusterName,
+		Conditions:  map[string][]map[string]interface{}{clusterName: conditions},
+		Seq:         seq,
+		Deleted:     deleted,
+	}
+	logger.Log.Debug("Sent conditionsDelta to broadcast channel",
+		zap.String("cluster", clusterName),
+		zap.Uint64("seq", seq),
+		zap.Bool("deleted", deleted))
+}
+
+// requestConditionsSnapshot queues a full conditions snapshot for a single client.
+func (s *Server) requestConditionsSnapshot(client *Client) {
+	s.broadcast <- utils.Message{
+		Type:     "conditionsSnapshot",
+		ClientID: client.id,
+	}
+}
+
+// snapshotConditions builds the full conditions map from the cluster informer cache,
+// together with the delta sequence number the snapshot is current with.
+func (s *Server) snapshotConditions() (map[string][]map[string]interface{}, uint64) {
+	s.clusterConditionsMutex.RLock()
+	seq := s.conditionsSeq
+	s.clusterConditionsMutex.RUnlock()
+
+	conditions := make(map[string][]map[string]interface{})
+	for _, obj := range s.clusterInformer.GetStore().List() {
+		unstructuredObj, ok := obj.(*unstructured.Unstructured)
+		if !ok || unstructuredObj.GetDeletionTimestamp() != nil {
+			continue
+		}
+
+		clusterConditions, found, err := cluster.ExtractConditions(unstructuredObj)
+		if err != nil {
+			logger.Log.Error("Error getting conditions field", zap.Error(err), zap.String("cluster", unstructuredObj.GetName()))
+			continue
+		}
+		if !found {
+			continue
+		}
+		conditions[unstructuredObj.GetName()] = clusterConditions
+	}
+
+	return conditions, seq
 }
 
 // sendCachedEvents retrieves cached K8s events for a cluster and sends them
@@ -967,8 +1298,8 @@ func (s *Server) sendCachedEvents(client *Client, clusterName string) {
 
 // handleRootRoute serves the main dashboard page at `/`.
 func (s *Server) handleRootRoute(w http.ResponseWriter, r *http.Request) {
-	// Proxy API requests instead of serving HTML
-	if s.isAPIRequest(r) {
+	// Couchbase console requests that escaped the /cui/<cluster>/ prefix are routed by its cookie
+	if r.URL.Path != "/" && uiproxy.ClusterFromCookie(r) != "" {
 		s.handleCouchbaseAPIProxy(w, r)
 		return
 	}
@@ -1027,68 +1358,74 @@ func (s *Server) handleClusterRoute(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleMetricsEndpoint proxies requests to the operator's Prometheus metrics endpoint (:8383/metrics).
-// Filters metrics and returns JSON or text format.
+// handleMetricsEndpoint serves the operator's Prometheus metrics from the latest background scrape.
+// Applies the metrics filter; the format is negotiated from the Accept header or ?format= (Prometheus text, OpenMetrics, protobuf, JSON or
+// CSV), ?cluster= restricts series to clusters, and responses are gzipped when the client accepts it.
 func (s *Server) handleMetricsEndpoint(w http.ResponseWriter, r *http.Request) {
-	// Fetch metrics from operator endpoint
-	resp, err := http.Get("http://localhost:8383/metrics")
+	format, err := metrics.Negotiate(r)
 	if err != nil {
-		logger.Log.Error("Failed to get metrics from local endpoint", zap.Error(err))
-		http.Error(w, "Failed to fetch metrics: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body) // Read body for logging
-		logger.Log.Error("Received non-OK status code from metrics endpoint",
-			zap.Int("statusCode", resp.StatusCode),
-			zap.String("status", resp.Status),
-			zap.ByteString("body", bodyBytes))
-		http.Error(w, "Failed to fetch metrics: received status "+resp.Status, resp.StatusCode)
+	// Serve the background scrape, so polling browsers never reach the operator themselves
+	families, err := s.metricsHistory.Latest()
+	if err != nil {
+		logger.Log.Warn("Operator metrics not available", zap.Error(err))
+		http.Error(w, "Metrics not available: "+err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	// Handle JSON requests: parse, filter, convert
-	if strings.Contains(r.Header.Get("Accept"), "application/json") {
-		w.Header().Set("Content-Type", "application/json")
-
-		mfChan := make(chan *dto.MetricFamily, 1024)
-
-		err := prom2json.ParseReader(resp.Body, mfChan)
-		if err != nil {
-			logger.Log.Error("Failed to parse Prometheus metrics format", zap.Error(err))
-			http.Error(w, "Failed to parse metrics: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+	filtered := s.metricsFilter.Apply(append(slices.Clip(families), s.limiter.MetricFamilies()...))
+	if clusters := r.URL.Query()["cluster"]; len(clusters) > 0 {
+		filtered = metrics.FilterClusters(filtered, clusters)
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].GetName() < filtered[j].GetName() })
 
-		// Filter and convert
-		var result []*prom2json.Family
-		for mf := range mfChan {
-			if s.allowedMetrics[mf.GetName()] {
-				result = append(result, prom2json.NewFamily(mf))
-			}
-		}
+	// Encode into a buffer first so encoding errors can still be reported with a status code
+	var body bytes.Buffer
+	if err := metrics.Encode(&body, format, r.Header, filtered); err != nil {
+		logger.Log.Error("Failed to encode metrics", zap.Error(err), zap.String("format", format))
+		http.Error(w, "Failed to encode metrics: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		// Marshal to JSON
-		jsonData, err := json.Marshal(result)
-		if err != nil {
-			logger.Log.Error("Failed to marshal filtered metrics to JSON", zap.Error(err))
-			http.Error(w, "Failed to convert metrics to JSON: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+	w.Header().Set("Content-Type", metrics.ContentType(format, r.Header))
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Encoding")
+	if format == metrics.FormatCSV {
+		w.Header().Set("Content-Disposition", `attachment; filename="metrics.csv"`)
+	}
 
-		w.Write(jsonData)
+	if !acceptsGzip(r) {
+		w.Write(body.Bytes())
 		return
 	}
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	defer gz.Close()
+	gz.Write(body.Bytes())
+}
 
-	// Handle non-JSON requests (return raw Prometheus format)
-	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Log.Error("Failed to read metrics response body", zap.Error(err))
-		http.Error(w, "Failed to read metrics: "+err.Error(), http.StatusInternalServerError)
-		return
+// acceptsGzip reports whether the Accept-Encoding header allows a gzip response
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		// gzip;q=0 explicitly refuses the encoding
+		if q, found := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); found {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				return false
+			}
+		}
+		return true
 	}
-	w.Write(body)
+	return false
+}
+
+// fetchOperatorMetrics retrieves the metric families of all operator replicas.
+func (s *Server) fetchOperatorMetrics(ctx context.Context) ([]*dto.MetricFamily, error) {
+	return s.operatorMetrics.Fetch(ctx)
 }
@@ -1,113 +1,63 @@
 package server
 
 import (
-	"fmt"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"strings"
+	"time"
 
+	"cod/internal/audit"
 	"cod/internal/logger"
+	"cod/internal/security"
+	"cod/internal/uiproxy"
 
 	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// handleCouchbaseAPIProxy proxies direct API requests (e.g., XHR from UI) to the appropriate cluster.
-// It determines the target cluster based on the Referer header.
+// handleCouchbaseAPIProxy proxies console requests made outside /cui/<clustername>/ (e.g. links the
+// routing script cannot rewrite) to the cluster named by the routing cookie. The console's XHR and
+// fetch calls stay under /cui/<clustername>/ and go through handleCouchbaseUIProxy instead.
+// The cookie names whichever console was opened last, possibly in another tab, so requests that
+// may change a cluster are not routed by it.
 func (s *Server) handleCouchbaseAPIProxy(w http.ResponseWriter, r *http.Request) {
-	// Determine cluster from referer header
-	referer := r.Header.Get("Referer")
-	if referer == "" {
-		logger.Log.Warn("API request rejected - missing referer header",
-			zap.String("remoteAddr", r.RemoteAddr),
-			zap.String("path", r.URL.Path))
-		http.Error(w, "API requests require a Referer header to determine target cluster", http.StatusBadRequest)
-		return
-	}
-
-	// Extract cluster name from referer path (/cui/<clustername>/...)
-	refererURL, err := url.Parse(referer)
-	if err != nil {
-		logger.Log.Warn("API request rejected - invalid referer format",
-			zap.Error(err),
-			zap.String("referer", referer),
+	clusterName := uiproxy.ClusterFromCookie(r)
+	proxy, exists := s.uiProxies.Get(clusterName)
+	if !exists {
+		logger.Log.Warn("API request rejected - routing cookie names an unknown cluster",
+			zap.String("cluster", clusterName),
 			zap.String("remoteAddr", r.RemoteAddr))
-		http.Error(w, "Invalid referer URL", http.StatusBadRequest)
+		http.NotFound(w, r)
 		return
 	}
-
-	refPath := refererURL.Path
-	if !strings.HasPrefix(refPath, "/cui/") {
-		logger.Log.Warn("API request rejected - referer path not starting with /cui/",
-			zap.String("refererPath", refPath),
+	if security.ChangesState(r.Method) {
+		logger.Log.Warn("API request rejected - changes are not routed by the routing cookie",
+			zap.String("cluster", clusterName),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
 			zap.String("remoteAddr", r.RemoteAddr))
-		http.Error(w, "Referer path must start with /cui/", http.StatusBadRequest)
+		http.Error(w, "Requests that change a cluster must go through /cui/<cluster>/", http.StatusForbidden)
 		return
 	}
-
-	parts := strings.SplitN(strings.TrimPrefix(refPath, "/cui/"), "/", 2)
-	if len(parts) == 0 || parts[0] == "" {
-		logger.Log.Warn("API request rejected - could not extract cluster name",
-			zap.String("refererPath", refPath),
-			zap.String("remoteAddr", r.RemoteAddr))
-		http.Error(w, "Could not determine cluster name from referer", http.StatusBadRequest)
+	if !s.allowProxyRate(w, r, clusterName) || !s.allowProxyRequest(w, r, clusterName, "", r.URL.Path) {
 		return
 	}
 
-	clusterName := parts[0]
-
-	// Namespace is checked in server.Start()
-
-	// Use the cluster name directly as the service name instead of appending "-ui"
-	svcName := clusterName + "-ui"
-
-	// Construct the target URL (e.g., http://mycluster-ui.mynamespace.svc.cluster.local:8091)
-	targetURL := &url.URL{
-		Scheme: "http",
-		Host:   fmt.Sprintf("%s.%s.svc.cluster.local:8091", svcName, s.namespace),
-	}
-
 	// Verbose logging for non-GET or settings-related API requests
 	if r.Method != "GET" || strings.Contains(r.URL.Path, "/settings") {
 		logger.Log.Info("Proxying API request",
 			zap.String("cluster", clusterName),
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
-			zap.String("targetURL", targetURL.String()))
+			zap.String("targetURL", proxy.Target()))
 	}
 
-	proxy := httputil.NewSingleHostReverseProxy(targetURL)
-
-	// Custom error handler for proxy failures
-	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		logger.Log.Error("API proxy error",
-			zap.Error(err),
-			zap.String("cluster", clusterName),
-			zap.String("namespace", s.namespace),
-			zap.String("path", r.URL.Path),
-			zap.String("method", r.Method),
-			zap.String("remoteAddr", r.RemoteAddr))
-		http.Error(w, fmt.Sprintf("API Proxy error: %v", err), http.StatusBadGateway)
-	}
-
-	// Update the Host header and target
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		// Set up the request
-		originalDirector(req)
-		req.Host = targetURL.Host
-		req.URL.Scheme = targetURL.Scheme
-		req.URL.Host = targetURL.Host
-		// Keep the original path
-	}
-
-	// Forward the request through the proxy
-	proxy.ServeHTTP(w, r)
+	s.serveAudited(w, s.withConsoleLogin(r, clusterName), clusterName, "", r.URL.Path, proxy.ServeAPI)
 }
 
 // handleCouchbaseUIProxy handles reverse proxy requests for the Couchbase UI itself.
-// It proxies requests like /cui/<clustername>/... to the cluster's UI service,
-// rewriting paths and handling redirects.
+// It proxies requests like /cui/<clustername>/... through the cluster's proxy in the registry,
+// which rewrites paths and redirects, and /cui/<clustername>/node/<pod>/... to a single node.
 func (s *Server) handleCouchbaseUIProxy(w http.ResponseWriter, r *http.Request) {
 	// Extract cluster name from URL path: /cui/<clustername>/...
 	path := r.URL.Path
@@ -122,16 +72,53 @@ func (s *Server) handleCouchbaseUIProxy(w http.ResponseWriter, r *http.Request)
 	}
 
 	clusterName := parts[0]
+	proxy, exists := s.uiProxies.Get(clusterName)
+	if !exists {
+		logger.Log.Warn("UI proxy request rejected - unknown cluster",
+			zap.String("cluster", clusterName),
+			zap.String("remoteAddr", r.RemoteAddr))
+		http.NotFound(w, r)
+		return
+	}
 
-	// Namespace is checked in server.Start()
+	if !s.allowProxyRate(w, r, clusterName) {
+		return
+	}
 
-	// Use the cluster name directly as the service name instead of appending "-ui"
-	svcName := clusterName + "-ui"
+	// The operator creates the console Service after the cluster, so look for it again on access
+	if proxy.Unavailable() != "" {
+		s.uiProxies.Retry(clusterName)
+	}
+
+	// /cui/<clustername>/node/<pod>/... reaches a single node. Other paths under node/ belong to
+	// the console itself, e.g. /node/controller/...
+	if len(parts) > 1 && strings.HasPrefix(parts[1], "node/") {
+		nodeParts := strings.SplitN(strings.TrimPrefix(parts[1], "node/"), "/", 2)
+		if pod := s.clusterPod(clusterName, nodeParts[0]); pod != nil {
+			nodePath := "/"
+			if len(nodeParts) > 1 {
+				nodePath += nodeParts[1]
+			}
+			if !s.allowProxyRequest(w, r, clusterName, pod.Name, nodePath) {
+				return
+			}
+			logger.Log.Debug("Proxying to Couchbase node",
+				zap.String("cluster", clusterName),
+				zap.String("pod", pod.Name),
+				zap.String("path", path))
+			s.serveAudited(w, s.withConsoleLogin(r, clusterName), clusterName, pod.Name, nodePath, func(w http.ResponseWriter, r *http.Request) {
+				proxy.ServeNode(w, r, pod)
+			})
+			return
+		}
+	}
 
-	// Construct the target URL (e.g., http://mycluster-ui.mynamespace.svc.cluster.local:8091)
-	targetURL := &url.URL{
-		Scheme: "http",
-		Host:   fmt.Sprintf("%s.%s.svc.cluster.local:8091", svcName, s.namespace),
+	consolePath := "/"
+	if len(parts) > 1 {
+		consolePath += parts[1]
+	}
+	if !s.allowProxyRequest(w, r, clusterName, "", consolePath) {
+		return
 	}
 
 	// For production logging, only log the initial access to a cluster UI
@@ -142,68 +129,153 @@ func (s *Server) handleCouchbaseUIProxy(w http.ResponseWriter, r *http.Request)
 			zap.String("remoteAddr", r.RemoteAddr))
 	}
 
-	// Create a reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	s.serveAudited(w, s.withConsoleLogin(r, clusterName), clusterName, "", consolePath, proxy.ServeUI)
+}
+
+// proxiedRequest tells whether a request goes to a Couchbase console rather than the dashboard,
+// matching the routing of handleRootRoute.
+func (s *Server) proxiedRequest(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/cui/") {
+		return true
+	}
+	_, pattern := http.DefaultServeMux.Handler(r)
+	return pattern == "/" && r.URL.Path != "/" && uiproxy.ClusterFromCookie(r) != ""
+}
+
+// clusterPod returns a Couchbase Server pod of a cluster, or nil if the cluster has no such pod.
+// Labels can be set by anyone who can create pods, so the pod must also be controlled by the
+// CouchbaseCluster itself.
+func (s *Server) clusterPod(clusterName, podName string) *v1.Pod {
+	clusterObj, exists := s.clusterObject(clusterName)
+	if !exists {
+		return nil
+	}
+	pods, err := s.topologyWatcher.Pods(clusterName)
+	if err != nil {
+		logger.Log.Warn("Failed to list cluster pods", zap.Error(err), zap.String("cluster", clusterName))
+		return nil
+	}
+	for _, pod := range pods {
+		if pod.Name != podName {
+			continue
+		}
+		if owner := metav1.GetControllerOf(pod); owner == nil || owner.UID != clusterObj.GetUID() {
+			logger.Log.Warn("Node request rejected - pod is not controlled by the cluster",
+				zap.String("cluster", clusterName),
+				zap.String("pod", podName))
+			return nil
+		}
+		return pod
+	}
+	return nil
+}
 
-	// Custom error handler for proxy failures
-	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		logger.Log.Error("UI proxy error",
+// allowProxyRate takes a console request from the cluster's request rate limit and answers 429
+// when the cluster has had too many, so a looping console tab cannot swamp Couchbase Server.
+func (s *Server) allowProxyRate(w http.ResponseWriter, r *http.Request, clusterName string) bool {
+	if s.limiter.AllowProxyRequest(clusterName) {
+		return true
+	}
+	logger.Log.Debug("Couchbase UI request rejected by rate limit",
+		zap.String("cluster", clusterName),
+		zap.String("path", r.URL.Path),
+		zap.String("remoteAddr", r.RemoteAddr))
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "Too many Couchbase UI requests for cluster "+clusterName, http.StatusTooManyRequests)
+	return false
+}
+
+// allowProxyRequest checks a Couchbase console request against the proxy policy and answers
+// 403 with the blocking rule when it is not allowed. path is the path on Couchbase Server and node
+// the pod for requests to a single node. Blocked requests are audited.
+func (s *Server) allowProxyRequest(w http.ResponseWriter, r *http.Request, clusterName, node, path string) bool {
+	request := uiproxy.ProxyRequest{
+		User:    s.proxyPolicy.User(r),
+		Cluster: clusterName,
+		Method:  r.Method,
+		Path:    path,
+	}
+	decision := s.proxyPolicy.Check(request)
+	if decision.Allowed {
+		return true
+	}
+
+	logger.Log.Warn("Couchbase UI request blocked by policy",
+		zap.String("cluster", clusterName),
+		zap.String("user", request.User),
+		zap.String("method", r.Method),
+		zap.String("path", path),
+		zap.String("rule", decision.Rule),
+		zap.String("remoteAddr", r.RemoteAddr))
+	s.auditLog.Record(audit.Entry{
+		Source:     audit.SourceProxy,
+		User:       request.User,
+		RemoteAddr: r.RemoteAddr,
+		Cluster:    clusterName,
+		Node:       node,
+		Method:     r.Method,
+		Path:       path,
+		Body:       audit.CaptureBody(r),
+		Status:     http.StatusForbidden,
+		Rule:       decision.Rule,
+	})
+	w.Header().Set("X-COD-Policy-Rule", decision.Rule)
+	http.Error(w, "Blocked by the dashboard's Couchbase UI policy: "+decision.Reason, http.StatusForbidden)
+	return false
+}
+
+// withConsoleLogin attaches the Couchbase login of the dashboard user when single sign-on is
+// enabled. Without one, e.g. when the user's CouchbaseUser cannot be read, the console asks the
+// user to log in.
+func (s *Server) withConsoleLogin(r *http.Request, clusterName string) *http.Request {
+	user := s.proxyPolicy.User(r)
+	couchbaseUser, ok := s.proxyPolicy.SSOLogin(user)
+	if !ok {
+		return r
+	}
+	clusterObj, exists := s.clusterObject(clusterName)
+	if !exists {
+		return r
+	}
+	credentials, err := s.consoleLogins.Get(r.Context(), clusterObj, couchbaseUser)
+	if err != nil {
+		logger.Log.Warn("Failed to read Couchbase login for single sign-on",
 			zap.Error(err),
 			zap.String("cluster", clusterName),
-			zap.String("namespace", s.namespace),
-			zap.String("path", r.URL.Path),
-			zap.String("remoteAddr", r.RemoteAddr))
-		http.Error(w, fmt.Sprintf("Proxy error: %v", err), http.StatusBadGateway)
-	}
-
-	// Modify the request before forwarding
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		// Let the default director set up basic proxy fields (e.g., X-Forwarded-For)
-		originalDirector(req)
-
-		// Set the Host header
-		req.Host = targetURL.Host
-
-		// Point request URL to the target
-		req.URL.Scheme = targetURL.Scheme
-		req.URL.Host = targetURL.Host
-
-		// Rewrite path: remove /cui/<clustername> prefix
-		cuiPrefix := fmt.Sprintf("/cui/%s", clusterName)
-		strippedPath := strings.TrimPrefix(req.URL.Path, cuiPrefix)
-		req.URL.Path = strippedPath
-	}
-
-	// Modify the response after it comes back from the target service
-	proxy.ModifyResponse = func(resp *http.Response) error {
-		// Rewrite redirect Location headers
-		if resp.StatusCode >= 300 && resp.StatusCode < 400 {
-			location := resp.Header.Get("Location")
-			if location != "" {
-				redirectURL, err := url.Parse(location)
-				if err != nil {
-					logger.Log.Error("Failed to parse redirect URL",
-						zap.Error(err),
-						zap.String("location", location),
-						zap.String("cluster", clusterName))
-				} else {
-					// Prepend /cui/<clustername> prefix to the path
-					path := redirectURL.Path
-					newLocation := fmt.Sprintf("/cui/%s%s", clusterName, path)
-					resp.Header.Set("Location", newLocation)
-
-					logger.Log.Debug("Rewrote redirect location",
-						zap.String("originalLocation", location),
-						zap.String("newLocation", newLocation),
-						zap.String("cluster", clusterName))
-				}
-			}
-		}
-		// Note: Could potentially modify HTML to inject <base href> if needed.
-		return nil
+			zap.String("user", user),
+			zap.String("couchbaseUser", couchbaseUser))
+		return r
 	}
+	return uiproxy.WithCredentials(r, credentials)
+}
 
-	// Forward the request through the proxy
-	proxy.ServeHTTP(w, r)
+// serveAudited serves a console request, without the dashboard's identity headers, and audits it
+// when it may change the cluster, with a sanitized summary of its body, the response status and
+// the time Couchbase Server took.
+func (s *Server) serveAudited(w http.ResponseWriter, r *http.Request, clusterName, node, path string, serve http.HandlerFunc) {
+	user := s.proxyPolicy.User(r)
+	s.proxyPolicy.StripIdentity(r)
+	if !security.ChangesState(r.Method) {
+		serve(w, r)
+		return
+	}
+
+	entry := audit.Entry{
+		Source:     audit.SourceProxy,
+		User:       user,
+		RemoteAddr: r.RemoteAddr,
+		Cluster:    clusterName,
+		Node:       node,
+		Method:     r.Method,
+		Path:       path,
+		Body:       audit.CaptureBody(r),
+	}
+	start := time.Now()
+	statusWriter := audit.NewStatusWriter(w)
+	serve(statusWriter, r)
+
+	entry.Time = start
+	entry.Status = statusWriter.Status()
+	entry.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	s.auditLog.Record(entry)
 }
@@ -0,0 +1,469 @@
+package serverstats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/cluster"
+	"cod/internal/logger"
+	"cod/internal/metrics"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Couchbase Server metrics endpoints on each pod
+const (
+	serverMetricsPort    = "8091"  // Native Prometheus endpoint of Couchbase Server 7.x
+	serverMetricsTLSPort = "18091" // Same over HTTPS, for clusters with spec.networking.tls
+	exporterMetricsPort  = "9091"  // couchbase-exporter sidecar on older deployments
+)
+
+// Metric sources, reported per node
+const (
+	SourceServer   = "server"
+	SourceExporter = "exporter"
+)
+
+// Source is one metric that provides a stat on a given endpoint
+type Source struct {
+	Metric   string            // Metric family name
+	Rate     bool              // Counter, reported as a per-second rate
+	Scale    float64           // Multiplier applied to the value, e.g. 100 for ratios shown as percent
+	Matchers map[string]string // Exact label matches
+}
+
+// Stat is a curated Couchbase Server statistic
+type Stat struct {
+	Name     string `json:"name"`
+	Title    string `json:"title"`
+	Unit     string `json:"unit"`
+	Average  bool   `json:"average"` // Averaged rather than summed across buckets and nodes
+	server   Source
+	exporter Source
+}
+
+// DefaultStats are the statistics collected per bucket and node
+var DefaultStats = []Stat{
+	{
+		Name: "ops", Title: "Ops/sec", Unit: "ops/s",
+		server:   Source{Metric: "kv_ops", Rate: true},
+		exporter: Source{Metric: "cbbucketstat_ops"},
+	},
+	{
+		Name: "residentRatio", Title: "Active Resident Ratio", Unit: "%", Average: true,
+		server:   Source{Metric: "kv_vb_perc_mem_resident_ratio", Scale: 100, Matchers: map[string]string{"state": "active"}},
+		exporter: Source{Metric: "cbbucketstat_vb_active_resident_items_ratio"},
+	},
+	{
+		Name: "diskQueue", Title: "Disk Write Queue", Unit: "items",
+		server:   Source{Metric: "kv_ep_diskqueue_items"},
+		exporter: Source{Metric: "cbbucketstat_disk_write_queue"},
+	},
+	{
+		Name: "memUsed", Title: "Memory Used", Unit: "bytes",
+		server:   Source{Metric: "kv_mem_used_bytes"},
+		exporter: Source{Metric: "cbbucketstat_mem_used"},
+	},
+}
+
+// NodeStats are the stats of one Couchbase Server pod
+type NodeStats struct {
+	Node   string             `json:"node"`
+	Source string             `json:"source,omitempty"`
+	Values map[string]float64 `json:"values"`
+	Error  string             `json:"error,omitempty"`
+}
+
+// BucketStats are the stats of one bucket aggregated across nodes
+type BucketStats struct {
+	Bucket string             `json:"bucket"`
+	Values map[string]float64 `json:"values"`
+}
+
+// ClusterStats is the latest collection of a cluster's Couchbase Server stats
+type ClusterStats struct {
+	Cluster     string             `json:"cluster"`
+	Stats       []Stat             `json:"stats"`
+	Totals      map[string]float64 `json:"totals"`
+	Buckets     []BucketStats      `json:"buckets"`
+	Nodes       []NodeStats        `json:"nodes"`
+	Error       string             `json:"error,omitempty"`
+	CollectedAt time.Time          `json:"collectedAt"`
+}
+
+// sample is a counter reading used to derive rates between collections
+type sample struct {
+	at    time.Time
+	value float64
+}
+
+// tlsClient scrapes a TLS cluster, verifying it against the cluster's CA
+type tlsClient struct {
+	tls    *cluster.TLS
+	client *http.Client
+}
+
+// Collector periodically scrapes the Couchbase Server metrics of every cluster
+type Collector struct {
+	client      *http.Client
+	tlsClients  map[string]*tlsClient // Per TLS cluster
+	stats       []Stat
+	results     map[string]ClusterStats
+	previous    map[string]sample // Counter readings by pod and series, for rates
+	resultMutex sync.RWMutex
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		tlsClients: make(map[string]*tlsClient),
+		stats:      DefaultStats,
+		results:    make(map[string]ClusterStats),
+		previous:   make(map[string]sample),
+	}
+}
+
+// Run collects every interval. credentials resolves a cluster's admin username and password, and
+// tlsSettings its spec.networking.tls material, so that TLS clusters are scraped over HTTPS.
+func (c *Collector) Run(ctx context.Context, interval time.Duration,
+	clusterNames func() []string,
+	clusterObject func(clusterName string) (*unstructured.Unstructured, bool),
+	pods func(clusterName string) ([]*v1.Pod, error),
+	credentials func(ctx context.Context, clusterObj *unstructured.Unstructured) (string, string, error),
+	tlsSettings func(ctx context.Context, clusterObj *unstructured.Unstructured) (*cluster.TLS, error)) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, clusterName := range clusterNames() {
+			result := ClusterStats{Cluster: clusterName, Stats: c.stats, CollectedAt: time.Now()}
+
+			clusterObj, exists := clusterObject(clusterName)
+			if !exists {
+				continue
+			}
+			username, password, err := credentials(ctx, clusterObj)
+			if err != nil {
+				result.Error = err.Error()
+			} else if client, scheme, err := c.clientFor(ctx, clusterObj, tlsSettings); err != nil {
+				// Never fall back to plain HTTP, which would expose the admin password
+				result.Error = err.Error()
+			} else if clusterPods, err := pods(clusterName); err != nil {
+				result.Error = err.Error()
+			} else {
+				c.collect(ctx, &result, clusterPods, client, scheme, username, password)
+			}
+
+			if result.Error != "" {
+				logger.Log.Debug("Failed to collect Couchbase Server metrics",
+					zap.String("cluster", clusterName),
+					zap.String("error", result.Error))
+			}
+
+			c.resultMutex.Lock()
+			c.results[clusterName] = result
+			c.resultMutex.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stats returns the latest stats of a cluster
+func (c *Collector) Stats(clusterName string) (ClusterStats, bool) {
+	c.resultMutex.RLock()
+	defer c.resultMutex.RUnlock()
+
+	result, exists := c.results[clusterName]
+	return result, exists
+}
+
+// clientFor returns the client and scheme a cluster's pods are scraped with: HTTPS verified
+// against the cluster's CA when it has spec.networking.tls, else plain HTTP
+func (c *Collector) clientFor(ctx context.Context, clusterObj *unstructured.Unstructured,
+	tlsSettings func(ctx context.Context, clusterObj *unstructured.Unstructured) (*cluster.TLS, error)) (*http.Client, string, error) {
+
+	clusterName := clusterObj.GetName()
+	clusterTLS, err := tlsSettings(ctx, clusterObj)
+	if err != nil {
+		return nil, "", err
+	}
+	if clusterTLS == nil {
+		return c.client, "http", nil
+	}
+
+	c.resultMutex.Lock()
+	defer c.resultMutex.Unlock()
+	if cached, exists := c.tlsClients[clusterName]; exists {
+		if cached.tls.Equal(clusterTLS) {
+			return cached.client, "https", nil
+		}
+		cached.client.CloseIdleConnections()
+	}
+	config, err := clusterTLS.ClientConfig(clusterName, clusterObj.GetNamespace())
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid TLS material of cluster %s: %w", clusterName, err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	client := &http.Client{Timeout: c.client.Timeout, Transport: transport}
+	c.tlsClients[clusterName] = &tlsClient{tls: clusterTLS, client: client}
+	return client, "https", nil
+}
+
+// Forget drops the stats of a deleted cluster
+func (c *Collector) Forget(clusterName string) {
+	c.resultMutex.Lock()
+	delete(c.results, clusterName)
+	if cached, exists := c.tlsClients[clusterName]; exists {
+		cached.client.CloseIdleConnections()
+		delete(c.tlsClients, clusterName)
+	}
+	for key := range c.previous {
+		if strings.HasPrefix(key, clusterName+"/") {
+			delete(c.previous, key)
+		}
+	}
+	c.resultMutex.Unlock()
+}
+
+// collect scrapes all pods of a cluster concurrently and aggregates per bucket
+func (c *Collector) collect(ctx context.Context, result *ClusterStats, pods []*v1.Pod, client *http.Client, scheme, username, password string) {
+	type podResult struct {
+		node     NodeStats
+		byBucket map[string]map[string]float64 // Stat values per bucket on this node
+	}
+
+	results := make([]podResult, len(pods))
+	var wg sync.WaitGroup
+	for i, pod := range pods {
+		wg.Add(1)
+		go func(i int, pod *v1.Pod) {
+			defer wg.Done()
+			node, byBucket := c.collectPod(ctx, result.Cluster, pod, client, scheme, username, password)
+			results[i] = podResult{node: node, byBucket: byBucket}
+		}(i, pod)
+	}
+	wg.Wait()
+
+	// Combine nodes into buckets and totals
+	bucketSums := make(map[string]map[string]float64)
+	bucketCounts := make(map[string]map[string]int)
+	result.Totals = make(map[string]float64)
+	totalCounts := make(map[string]int)
+	for _, podResult := range results {
+		result.Nodes = append(result.Nodes, podResult.node)
+		for bucket, values := range podResult.byBucket {
+			if bucketSums[bucket] == nil {
+				bucketSums[bucket] = make(map[string]float64)
+				bucketCounts[bucket] = make(map[string]int)
+			}
+			for stat, value := range values {
+				bucketSums[bucket][stat] += value
+				bucketCounts[bucket][stat]++
+			}
+		}
+	}
+
+	for bucket, sums := range bucketSums {
+		values := make(map[string]float64, len(sums))
+		for _, stat := range c.stats {
+			sum, exists := sums[stat.Name]
+			if !exists {
+				continue
+			}
+			if stat.Average {
+				values[stat.Name] = sum / float64(bucketCounts[bucket][stat.Name])
+			} else {
+				values[stat.Name] = sum
+			}
+			result.Totals[stat.Name] += values[stat.Name]
+			totalCounts[stat.Name]++
+		}
+		result.Buckets = append(result.Buckets, BucketStats{Bucket: bucket, Values: values})
+	}
+	for _, stat := range c.stats {
+		if stat.Average && totalCounts[stat.Name] > 0 {
+			result.Totals[stat.Name] /= float64(totalCounts[stat.Name])
+		}
+	}
+
+	sort.Slice(result.Buckets, func(i, j int) bool { return result.Buckets[i].Bucket < result.Buckets[j].Bucket })
+	sort.Slice(result.Nodes, func(i, j int) bool { return result.Nodes[i].Node < result.Nodes[j].Node })
+}
+
+// collectPod scrapes one pod, preferring the native endpoint and falling back to the exporter
+func (c *Collector) collectPod(ctx context.Context, clusterName string, pod *v1.Pod, client *http.Client, scheme, username, password string) (NodeStats, map[string]map[string]float64) {
+	node := NodeStats{Node: pod.Name, Values: make(map[string]float64)}
+	if pod.Status.PodIP == "" {
+		node.Error = "pod has no IP address"
+		return node, nil
+	}
+
+	port := serverMetricsPort
+	if scheme == "https" {
+		port = serverMetricsTLSPort
+	}
+	families, err := c.fetch(ctx, client, scheme+"://"+net.JoinHostPort(pod.Status.PodIP, port)+"/metrics", username, password)
+	node.Source = SourceServer
+	if errors.Is(err, metrics.ErrNotFound) {
+		// Couchbase Server before 7.0 has no native endpoint. The exporter gets no credentials.
+		families, err = c.fetch(ctx, c.client, "http://"+net.JoinHostPort(pod.Status.PodIP, exporterMetricsPort)+"/metrics", "", "")
+		node.Source = SourceExporter
+	}
+	if err != nil {
+		node.Error = err.Error()
+		return node, nil
+	}
+
+	now := time.Now()
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+	}
+
+	byBucket := make(map[string]map[string]float64)
+	nodeCounts := make(map[string]int)
+	for _, stat := range c.stats {
+		source := stat.server
+		if node.Source == SourceExporter {
+			source = stat.exporter
+		}
+		mf, exists := byName[source.Metric]
+		if !exists {
+			continue
+		}
+
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string, len(m.GetLabel()))
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if !matches(labels, source.Matchers) {
+				continue
+			}
+
+			value := sampleValue(m)
+			if source.Rate {
+				key := clusterName + "/" + pod.Name + "/" + source.Metric + "/" + labelString(labels)
+				var ok bool
+				if value, ok = c.rate(key, value, now); !ok {
+					continue
+				}
+			}
+			if source.Scale != 0 {
+				value *= source.Scale
+			}
+
+			bucket := labels["bucket"]
+			if bucket == "" {
+				continue
+			}
+			if byBucket[bucket] == nil {
+				byBucket[bucket] = make(map[string]float64)
+			}
+			// Series split by other labels (e.g. op) add up within a bucket
+			byBucket[bucket][stat.Name] += value
+		}
+	}
+
+	// Node values across its buckets
+	for _, values := range byBucket {
+		for stat, value := range values {
+			node.Values[stat] += value
+			nodeCounts[stat]++
+		}
+	}
+	for _, stat := range c.stats {
+		if stat.Average && nodeCounts[stat.Name] > 0 {
+			node.Values[stat.Name] /= float64(nodeCounts[stat.Name])
+		}
+	}
+	return node, byBucket
+}
+
+func (c *Collector) fetch(ctx context.Context, client *http.Client, url, username, password string) ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	return metrics.FetchRequest(client, req)
+}
+
+// rate derives a per-second rate from the previous reading of a counter
+func (c *Collector) rate(key string, value float64, now time.Time) (float64, bool) {
+	c.resultMutex.Lock()
+	defer c.resultMutex.Unlock()
+
+	previous, exists := c.previous[key]
+	c.previous[key] = sample{at: now, value: value}
+	if !exists {
+		return 0, false
+	}
+
+	elapsed := now.Sub(previous.at).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	increase := value - previous.value
+	if increase < 0 {
+		increase = value // Counter reset, e.g. after a node restart
+	}
+	return increase / elapsed, true
+}
+
+func matches(labels, matchers map[string]string) bool {
+	for name, value := range matchers {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func labelString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		builder.WriteString(name)
+		builder.WriteByte('=')
+		builder.WriteString(labels[name])
+		builder.WriteByte(',')
+	}
+	return builder.String()
+}
+
+func sampleValue(m *dto.Metric) float64 {
+	switch {
+	case m.GetCounter() != nil:
+		return m.GetCounter().GetValue()
+	case m.GetGauge() != nil:
+		return m.GetGauge().GetValue()
+	case m.GetUntyped() != nil:
+		return m.GetUntyped().GetValue()
+	}
+	return 0
+}
@@ -0,0 +1,358 @@
+package topology
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/logger"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Well-known labels joined into the topology model
+const (
+	clusterLabel     = "couchbase_cluster"
+	serverClassLabel = "couchbase_node_conf"
+	serviceLabelPfx  = "couchbase_service_"
+	zoneLabel        = "topology.kubernetes.io/zone"
+	regionLabel      = "topology.kubernetes.io/region"
+	legacyZoneLabel  = "failure-domain.beta.kubernetes.io/zone"
+)
+
+// Pod is a Couchbase Server pod and where it is placed
+type Pod struct {
+	Name        string   `json:"name"`
+	ServerClass string   `json:"serverClass,omitempty"`
+	Services    []string `json:"services,omitempty"`
+	Node        string   `json:"node,omitempty"`
+	Zone        string   `json:"zone,omitempty"`
+	Region      string   `json:"region,omitempty"`
+	ServerGroup string   `json:"serverGroup,omitempty"`
+	PVCs        []string `json:"pvcs,omitempty"`
+	Phase       string   `json:"phase"`
+	Ready       bool     `json:"ready"`
+	Restarts    int32    `json:"restarts"`
+	Problem     string   `json:"problem,omitempty"` // Pending or crash-looping pods
+}
+
+// ServerClass groups pods by their spec.servers entry
+type ServerClass struct {
+	Name     string   `json:"name"`
+	Size     int64    `json:"size"` // Desired size from spec.servers
+	Services []string `json:"services,omitempty"`
+	Pods     []Pod    `json:"pods"`
+}
+
+// Node is a Kubernetes node hosting pods of the cluster
+type Node struct {
+	Name   string   `json:"name"`
+	Zone   string   `json:"zone,omitempty"`
+	Region string   `json:"region,omitempty"`
+	Pods   []string `json:"pods"`
+}
+
+// Violation is a placement or health problem found in the topology
+type Violation struct {
+	Type    string `json:"type"` // antiAffinity, serverGroup, pending or crashLoop
+	Pod     string `json:"pod,omitempty"`
+	Node    string `json:"node,omitempty"`
+	Message string `json:"message"`
+}
+
+// Topology is the placement model of a single cluster
+type Topology struct {
+	Cluster       string        `json:"cluster"`
+	AntiAffinity  bool          `json:"antiAffinity"`
+	ServerGroups  []string      `json:"serverGroups,omitempty"`
+	ServerClasses []ServerClass `json:"serverClasses"`
+	Nodes         []Node        `json:"nodes"`
+	Violations    []Violation   `json:"violations,omitempty"`
+}
+
+// Watcher maintains pod and node informers and builds cluster topologies from them
+type Watcher struct {
+	podLister      listersv1.PodLister
+	nodeLister     listersv1.NodeLister
+	podInformer    cache.SharedIndexInformer
+	nodeInformer   cache.SharedIndexInformer
+	pendingTimeout time.Duration       // How long a pod may stay Pending before it is flagged
+	published      map[string]Topology // Last topology handed out per cluster, for change suppression
+	publishedMutex sync.Mutex
+}
+
+func NewWatcher(clientset *kubernetes.Clientset, namespace string, pendingTimeout time.Duration) *Watcher {
+	// Only Couchbase Server pods carry the couchbase_cluster label
+	podFactory := informers.NewSharedInformerFactoryWithOptions(clientset, 30*time.Second,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = clusterLabel
+		}))
+	// Nodes are cluster-scoped
+	nodeFactory := informers.NewSharedInformerFactory(clientset, 5*time.Minute)
+
+	return &Watcher{
+		podLister:      podFactory.Core().V1().Pods().Lister(),
+		nodeLister:     nodeFactory.Core().V1().Nodes().Lister(),
+		podInformer:    podFactory.Core().V1().Pods().Informer(),
+		nodeInformer:   nodeFactory.Core().V1().Nodes().Informer(),
+		pendingTimeout: pendingTimeout,
+		published:      make(map[string]Topology),
+	}
+}
+
+// Start runs the informers and calls onChange with the cluster name whenever one of its pods changes.
+// A periodic tick re-evaluates all clusters so time-based problems (stuck Pending) are noticed.
+func (w *Watcher) Start(ctx context.Context, onChange func(clusterName string)) {
+	notify := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if pod, ok := obj.(*v1.Pod); ok {
+			onChange(pod.Labels[clusterLabel])
+		}
+	}
+
+	w.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(_, newObj interface{}) { notify(newObj) },
+		DeleteFunc: notify,
+	})
+
+	go w.podInformer.Run(ctx.Done())
+	// Node labels are optional enrichment: don't block on them if nodes can't be listed
+	go w.nodeInformer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), w.podInformer.HasSynced) {
+		logger.Log.Error("Failed to sync pod informer cache", zap.String("resource", "pods"))
+		return
+	}
+	logger.Log.Info("Pod topology watcher started")
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.publishedMutex.Lock()
+			clusterNames := make([]string, 0, len(w.published))
+			for clusterName := range w.published {
+				clusterNames = append(clusterNames, clusterName)
+			}
+			w.publishedMutex.Unlock()
+
+			for _, clusterName := range clusterNames {
+				onChange(clusterName)
+			}
+		}
+	}
+}
+
+// Changed records a freshly built topology and reports whether it differs from the last one handed out
+func (w *Watcher) Changed(topology Topology) bool {
+	w.publishedMutex.Lock()
+	defer w.publishedMutex.Unlock()
+
+	previous, exists := w.published[topology.Cluster]
+	w.published[topology.Cluster] = topology
+	return !exists || !reflect.DeepEqual(previous, topology)
+}
+
+// Forget drops the published state of a deleted cluster
+func (w *Watcher) Forget(clusterName string) {
+	w.publishedMutex.Lock()
+	delete(w.published, clusterName)
+	w.publishedMutex.Unlock()
+}
+
+// Pods returns the Couchbase Server pods of a cluster from the informer cache
+func (w *Watcher) Pods(clusterName string) ([]*v1.Pod, error) {
+	return w.podLister.List(labels.SelectorFromSet(labels.Set{clusterLabel: clusterName}))
+}
+
+// PodCluster returns the cluster a Couchbase Server pod belongs to, or "" if it is not known
+func (w *Watcher) PodCluster(namespace, podName string) string {
+	pod, err := w.podLister.Pods(namespace).Get(podName)
+	if err != nil {
+		return ""
+	}
+	return pod.Labels[clusterLabel]
+}
+
+// Build joins a cluster's pods with node topology labels and its spec.servers
+func (w *Watcher) Build(clusterObj *unstructured.Unstructured) Topology {
+	clusterName := clusterObj.GetName()
+	topology := Topology{Cluster: clusterName}
+	topology.AntiAffinity, _, _ = unstructured.NestedBool(clusterObj.Object, "spec", "antiAffinity")
+	topology.ServerGroups, _, _ = unstructured.NestedStringSlice(clusterObj.Object, "spec", "serverGroups")
+
+	// Server classes in spec order
+	classIndex := make(map[string]int)
+	servers, _, _ := unstructured.NestedSlice(clusterObj.Object, "spec", "servers")
+	for _, server := range servers {
+		serverMap, ok := server.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		class := ServerClass{Pods: []Pod{}}
+		class.Name, _, _ = unstructured.NestedString(serverMap, "name")
+		class.Size, _, _ = unstructured.NestedInt64(serverMap, "size")
+		class.Services, _, _ = unstructured.NestedStringSlice(serverMap, "services")
+		classIndex[class.Name] = len(topology.ServerClasses)
+		topology.ServerClasses = append(topology.ServerClasses, class)
+	}
+
+	pods, err := w.Pods(clusterName)
+	if err != nil {
+		logger.Log.Error("Failed to list cluster pods", zap.Error(err), zap.String("cluster", clusterName))
+		return topology
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+
+	nodes := make(map[string]*Node)
+	for _, pod := range pods {
+		model := w.buildPod(pod, topology.ServerClasses, classIndex)
+
+		if model.Node != "" {
+			node, exists := nodes[model.Node]
+			if !exists {
+				node = &Node{Name: model.Node, Zone: model.Zone, Region: model.Region}
+				nodes[model.Node] = node
+			}
+			node.Pods = append(node.Pods, model.Name)
+		}
+
+		if model.Problem != "" {
+			violationType := "pending"
+			if model.Phase != string(v1.PodPending) {
+				violationType = "crashLoop"
+			}
+			topology.Violations = append(topology.Violations, Violation{
+				Type:    violationType,
+				Pod:     model.Name,
+				Node:    model.Node,
+				Message: model.Problem,
+			})
+		}
+
+		if model.ServerGroup != "" && model.Zone != "" && model.ServerGroup != model.Zone {
+			topology.Violations = append(topology.Violations, Violation{
+				Type:    "serverGroup",
+				Pod:     model.Name,
+				Node:    model.Node,
+				Message: fmt.Sprintf("pod is in server group %s but runs in zone %s", model.ServerGroup, model.Zone),
+			})
+		}
+
+		i, known := classIndex[model.ServerClass]
+		if !known {
+			// Pods of a class removed from the spec are still shown
+			i = len(topology.ServerClasses)
+			classIndex[model.ServerClass] = i
+			topology.ServerClasses = append(topology.ServerClasses, ServerClass{Name: model.ServerClass})
+		}
+		topology.ServerClasses[i].Pods = append(topology.ServerClasses[i].Pods, model)
+	}
+
+	topology.Nodes = make([]Node, 0, len(nodes))
+	for _, node := range nodes {
+		topology.Nodes = append(topology.Nodes, *node)
+	}
+	sort.Slice(topology.Nodes, func(i, j int) bool { return topology.Nodes[i].Name < topology.Nodes[j].Name })
+
+	// With anti-affinity enabled no two pods of the cluster may share a node
+	if topology.AntiAffinity {
+		for _, node := range topology.Nodes {
+			if len(node.Pods) > 1 {
+				topology.Violations = append(topology.Violations, Violation{
+					Type:    "antiAffinity",
+					Node:    node.Name,
+					Message: fmt.Sprintf("pods %s share node %s despite anti-affinity", strings.Join(node.Pods, ", "), node.Name),
+				})
+			}
+		}
+	}
+
+	return topology
+}
+
+func (w *Watcher) buildPod(pod *v1.Pod, classes []ServerClass, classIndex map[string]int) Pod {
+	model := Pod{
+		Name:        pod.Name,
+		ServerClass: pod.Labels[serverClassLabel],
+		Node:        pod.Spec.NodeName,
+		Phase:       string(pod.Status.Phase),
+	}
+
+	// Services come from the server class, falling back to the per-service pod labels
+	if i, ok := classIndex[model.ServerClass]; ok {
+		model.Services = classes[i].Services
+	} else {
+		for key, value := range pod.Labels {
+			if strings.HasPrefix(key, serviceLabelPfx) && value == "enabled" {
+				model.Services = append(model.Services, strings.TrimPrefix(key, serviceLabelPfx))
+			}
+		}
+		sort.Strings(model.Services)
+	}
+
+	// Server groups are pinned through a zone node selector
+	model.ServerGroup = pod.Spec.NodeSelector[zoneLabel]
+	if model.ServerGroup == "" {
+		model.ServerGroup = pod.Spec.NodeSelector[legacyZoneLabel]
+	}
+
+	if model.Node != "" {
+		if node, err := w.nodeLister.Get(model.Node); err == nil {
+			model.Zone = node.Labels[zoneLabel]
+			if model.Zone == "" {
+				model.Zone = node.Labels[legacyZoneLabel]
+			}
+			model.Region = node.Labels[regionLabel]
+		}
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			model.PVCs = append(model.PVCs, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			model.Ready = condition.Status == v1.ConditionTrue
+		}
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		model.Restarts += status.RestartCount
+		if status.State.Waiting != nil && status.State.Waiting.Reason == "CrashLoopBackOff" {
+			model.Problem = fmt.Sprintf("container %s is in CrashLoopBackOff (%d restarts)", status.Name, status.RestartCount)
+		}
+	}
+
+	if pod.Status.Phase == v1.PodPending && time.Since(pod.CreationTimestamp.Time) > w.pendingTimeout {
+		model.Problem = fmt.Sprintf("pod has been Pending for over %s", w.pendingTimeout)
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Message != "" {
+				model.Problem += ": " + condition.Message
+			}
+		}
+	}
+
+	return model
+}
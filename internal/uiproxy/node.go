@@ -0,0 +1,55 @@
+package uiproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// nodeRoute is where a /cui/<cluster>/node/<pod>/... request goes, carried in its context
+type nodeRoute struct {
+	prefix     string // /cui/<cluster>/node/<pod>
+	target     *url.URL
+	pathPrefix string // pods/proxy path when going through the API server
+}
+
+type nodeRouteKey struct{}
+
+// ServeNode proxies /cui/<cluster>/node/<pod>/... to a single Couchbase Server pod, bypassing the
+// load-balanced console Service. The pod must have been checked to belong to the cluster. Nodes are
+// reached the same way as the console: directly by pod IP, or through the API server.
+func (p *Proxy) ServeNode(w http.ResponseWriter, r *http.Request, pod *v1.Pod) {
+	prefix := p.prefix + "/node/" + pod.Name
+	if isRoutingScript(r, prefix) {
+		serveRoutingScript(w, prefix)
+		return
+	}
+	current := p.upstream.Load()
+	if current.unavailable != "" {
+		p.serveUnavailable(w, current.unavailable)
+		return
+	}
+
+	port, scheme := consolePort, "http"
+	if current.tls != nil {
+		port, scheme = secureConsolePort, "https"
+	}
+	route := &nodeRoute{prefix: prefix}
+	if current.pathPrefix != "" {
+		// /api/v1/namespaces/<ns>/pods/<scheme>:<name>:<port>/proxy
+		route.target = current.target
+		route.pathPrefix = fmt.Sprintf("/api/v1/namespaces/%s/pods/%s:%s:%d/proxy", pod.Namespace, scheme, pod.Name, port)
+	} else {
+		if pod.Status.PodIP == "" {
+			p.serveUnavailable(w, fmt.Sprintf("Pod %s has no IP address yet.", pod.Name))
+			return
+		}
+		route.target = &url.URL{Scheme: scheme, Host: net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port))}
+	}
+	p.serve(p.node, w, r.WithContext(context.WithValue(r.Context(), nodeRouteKey{}, route)), current)
+}
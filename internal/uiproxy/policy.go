@@ -0,0 +1,457 @@
+package uiproxy
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/logger"
+	"cod/internal/security"
+	"cod/internal/utils"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Rule actions
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// readOnlyExempt are console requests that use mutating methods without changing the cluster:
+// logging in and out, and the stats queries of Couchbase Server 7
+var readOnlyExempt = []*regexp.Regexp{
+	pathPattern("/uilogin"),
+	pathPattern("/uilogout"),
+	pathPattern("/pools/default/stats/range/**"),
+}
+
+// PolicyRule allows or denies console requests matching all of its fields. Empty fields match
+// everything.
+type PolicyRule struct {
+	Name     string   `json:"name"`
+	Action   string   `json:"action"`             // allow or deny
+	Methods  []string `json:"methods,omitempty"`  // e.g. POST, DELETE
+	Paths    []string `json:"paths,omitempty"`    // Couchbase REST paths; * matches one segment, ** the rest
+	Clusters []string `json:"clusters,omitempty"` // Cluster names
+	Users    []string `json:"users,omitempty"`    // Identities from UserHeader
+}
+
+// PolicyConfig decides which console requests the proxy forwards. Rules are checked in order and
+// the first match decides. Requests matching no rule are allowed, unless they may change state
+// (any method but GET, HEAD, OPTIONS and TRACE) and read-only mode applies to the user. Logging in and stats queries are never
+// read-only.
+type PolicyConfig struct {
+	ReadOnly          bool         `json:"readOnly"`                    // Read-only for every user but Writers
+	Writers           []string     `json:"writers,omitempty"`           // Exempt from ReadOnly
+	ReadOnlyUsers     []string     `json:"readOnlyUsers,omitempty"`     // Read-only even when ReadOnly is off
+	UserHeader        string       `json:"userHeader,omitempty"`        // Set by a trusted authenticating proxy, e.g. X-Forwarded-User
+	TrustedProxies    []string     `json:"trustedProxies,omitempty"`    // CIDRs UserHeader is accepted from, e.g. the ingress controller's pods
+	ProxySecretHeader string       `json:"proxySecretHeader,omitempty"` // Carries COD_PROXY_SECRET from the authenticating proxy, trusted from any address
+	Rules             []PolicyRule `json:"rules,omitempty"`
+	SSO               *SSOConfig   `json:"sso,omitempty"`
+}
+
+// SSOConfig logs dashboard users into the Couchbase console with credentials the proxy injects,
+// so they never need the password. Only users identified by UserHeader are logged in; others
+// get the console's login page.
+type SSOConfig struct {
+	Enabled  bool              `json:"enabled"`
+	Writer   string            `json:"writer,omitempty"`   // CouchbaseUser for users who may change clusters; empty uses spec.security.adminSecret
+	ReadOnly string            `json:"readOnly,omitempty"` // CouchbaseUser for read-only users, e.g. bound to ro_admin; empty leaves them to log in themselves
+	Users    map[string]string `json:"users,omitempty"`    // CouchbaseUser per dashboard user, overriding Writer and ReadOnly
+}
+
+// Decision is the outcome of a policy check
+type Decision struct {
+	Allowed bool
+	Rule    string // Name of the rule that decided, "read-only" for read-only mode
+	Reason  string
+}
+
+// ProxyRequest is a console request as the policy sees it
+type ProxyRequest struct {
+	User    string
+	Cluster string
+	Method  string
+	Path    string // Path on Couchbase Server, without the /cui/<cluster> prefix
+}
+
+type compiledRule struct {
+	PolicyRule
+	paths []*regexp.Regexp
+}
+
+type compiledPolicy struct {
+	config         PolicyConfig
+	rules          []compiledRule
+	trustedProxies []*net.IPNet
+	proxySecret    string
+}
+
+// verifiesProxy reports whether requests can be told to come through the authenticating proxy
+func (c compiledPolicy) verifiesProxy() bool {
+	return len(c.trustedProxies) > 0 || c.config.ProxySecretHeader != ""
+}
+
+// trusted reports whether a request came through the authenticating proxy. Without trustedProxies
+// and proxySecretHeader, no request is.
+func (c compiledPolicy) trusted(r *http.Request) bool {
+	if !c.verifiesProxy() {
+		return false
+	}
+	if c.config.ProxySecretHeader != "" {
+		secret := r.Header.Get(c.config.ProxySecretHeader)
+		if secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(c.proxySecret)) == 1 {
+			return true
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	for _, network := range c.trustedProxies {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy checks console requests against a policy file, reloaded when it changes
+type Policy struct {
+	path     string
+	current  compiledPolicy
+	modTime  time.Time
+	loadedAt time.Time
+	mutex    sync.RWMutex
+}
+
+// NewPolicy loads the policy file. An empty path allows every request.
+func NewPolicy(path string) (*Policy, error) {
+	policy := &Policy{path: path}
+	if err := policy.Reload(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Reload re-reads the policy file. On error the previous policy stays in effect.
+func (p *Policy) Reload() error {
+	config := PolicyConfig{}
+	var modTime time.Time
+	if p.path != "" {
+		info, err := os.Stat(p.path)
+		if err != nil {
+			return err
+		}
+		modTime = info.ModTime()
+
+		file, err := os.Open(p.path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if err := yaml.NewYAMLOrJSONDecoder(file, 4096).Decode(&config); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", p.path, err)
+		}
+	}
+	if utils.GetEnvBool("COD_PROXY_READ_ONLY", false) {
+		config.ReadOnly = true // Quick switch without editing the policy file
+	}
+
+	compiled, err := compilePolicy(config, os.Getenv("COD_PROXY_SECRET"))
+	if err != nil {
+		return err
+	}
+	if config.UserHeader != "" && !compiled.verifiesProxy() {
+		logger.Log.Warn("Proxy policy ignores userHeader without trustedProxies or proxySecretHeader",
+			zap.String("userHeader", config.UserHeader))
+	}
+
+	p.mutex.Lock()
+	p.current = compiled
+	p.modTime = modTime
+	p.loadedAt = time.Now()
+	p.mutex.Unlock()
+
+	logger.Log.Info("Loaded Couchbase UI proxy policy",
+		zap.String("file", p.path),
+		zap.Bool("readOnly", config.ReadOnly),
+		zap.Bool("sso", config.SSO != nil && config.SSO.Enabled),
+		zap.Int("rules", len(config.Rules)))
+	return nil
+}
+
+// Watch reloads the policy whenever its file changes, e.g. when a mounted ConfigMap is updated
+func (p *Policy) Watch(stop <-chan struct{}, interval time.Duration) {
+	if p.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(p.path)
+		if err != nil {
+			logger.Log.Warn("Failed to check proxy policy file", zap.Error(err), zap.String("file", p.path))
+			continue
+		}
+		p.mutex.RLock()
+		changed := !info.ModTime().Equal(p.modTime)
+		p.mutex.RUnlock()
+
+		if changed {
+			if err := p.Reload(); err != nil {
+				logger.Log.Error("Failed to reload proxy policy, keeping the previous one",
+					zap.Error(err),
+					zap.String("file", p.path))
+			}
+		}
+	}
+}
+
+// Config returns the policy in effect and when it was loaded
+func (p *Policy) Config() (PolicyConfig, time.Time) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.current.config, p.loadedAt
+}
+
+// User returns the identity a trusted proxy put in the configured header, if any. Requests that
+// did not come through the trusted proxy have no identity.
+func (p *Policy) User(r *http.Request) string {
+	p.mutex.RLock()
+	current := p.current
+	p.mutex.RUnlock()
+	if current.config.UserHeader == "" || !current.trusted(r) {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get(current.config.UserHeader))
+}
+
+// Client returns who a request counts against for limits: the user from UserHeader and the
+// client's address from X-Forwarded-For, as the trusted proxy reports them. Limits must not rest on
+// headers clients can rotate, so without trustedProxies or proxySecretHeader the user is ignored
+// and the address is the connection's.
+func (p *Policy) Client(r *http.Request) (user, address string) {
+	address, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		address = r.RemoteAddr
+	}
+
+	p.mutex.RLock()
+	current := p.current
+	p.mutex.RUnlock()
+	if !current.trusted(r) {
+		return "", address
+	}
+
+	// The trusted proxy appends the address it saw last
+	if hops := strings.Split(r.Header.Get("X-Forwarded-For"), ","); strings.TrimSpace(hops[len(hops)-1]) != "" {
+		address = strings.TrimSpace(hops[len(hops)-1])
+	}
+	if current.config.UserHeader != "" {
+		user = strings.TrimSpace(r.Header.Get(current.config.UserHeader))
+	}
+	return user, address
+}
+
+// StripIdentity removes the identity and proxy secret headers, which are not for Couchbase Server
+func (p *Policy) StripIdentity(r *http.Request) {
+	p.mutex.RLock()
+	config := p.current.config
+	p.mutex.RUnlock()
+	if config.UserHeader != "" {
+		r.Header.Del(config.UserHeader)
+	}
+	if config.ProxySecretHeader != "" {
+		r.Header.Del(config.ProxySecretHeader)
+	}
+}
+
+// Check decides whether a console request may be forwarded
+func (p *Policy) Check(request ProxyRequest) Decision {
+	p.mutex.RLock()
+	current := p.current
+	p.mutex.RUnlock()
+
+	for _, rule := range current.rules {
+		if !rule.matches(request) {
+			continue
+		}
+		if rule.Action == ActionAllow {
+			return Decision{Allowed: true, Rule: rule.Name}
+		}
+		return Decision{Rule: rule.Name,
+			Reason: fmt.Sprintf("rule %q denies %s %s", rule.Name, request.Method, request.Path)}
+	}
+
+	if security.ChangesState(request.Method) && !exempt(request.Path) && current.config.readOnlyFor(request.User) {
+		who := "the dashboard"
+		if request.User != "" {
+			who = "user " + request.User
+		}
+		return Decision{Rule: "read-only",
+			Reason: fmt.Sprintf("the Couchbase UI is read-only for %s; %s %s would change the cluster", who, request.Method, request.Path)}
+	}
+	return Decision{Allowed: true}
+}
+
+// SSOLogin returns the CouchbaseUser a dashboard user is logged into the console as, empty for
+// the cluster's administrator. ok is false when the user must log in themselves.
+func (p *Policy) SSOLogin(user string) (couchbaseUser string, ok bool) {
+	p.mutex.RLock()
+	config := p.current.config
+	p.mutex.RUnlock()
+
+	if config.SSO == nil || !config.SSO.Enabled || user == "" {
+		return "", false
+	}
+	if couchbaseUser, exists := config.SSO.Users[user]; exists {
+		return couchbaseUser, true
+	}
+	if config.readOnlyFor(user) {
+		return config.SSO.ReadOnly, config.SSO.ReadOnly != ""
+	}
+	return config.SSO.Writer, true
+}
+
+func (c PolicyConfig) readOnlyFor(user string) bool {
+	if slices.Contains(c.ReadOnlyUsers, user) {
+		return true
+	}
+	return c.ReadOnly && !slices.Contains(c.Writers, user)
+}
+
+func (r compiledRule) matches(request ProxyRequest) bool {
+	if len(r.Methods) > 0 && !containsFold(r.Methods, request.Method) {
+		return false
+	}
+	if len(r.Clusters) > 0 && !slices.Contains(r.Clusters, request.Cluster) {
+		return false
+	}
+	if len(r.Users) > 0 && !slices.Contains(r.Users, request.User) {
+		return false
+	}
+	if len(r.paths) == 0 {
+		return true
+	}
+	for _, path := range r.paths {
+		if path.MatchString(request.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePolicy(config PolicyConfig, proxySecret string) (compiledPolicy, error) {
+	compiled := compiledPolicy{config: config, proxySecret: proxySecret}
+	if config.SSO != nil && config.SSO.Enabled && config.UserHeader == "" {
+		return compiled, fmt.Errorf("sso needs userHeader to identify dashboard users")
+	}
+	for _, cidr := range config.TrustedProxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return compiled, fmt.Errorf("trustedProxies: invalid CIDR %q", cidr)
+		}
+		compiled.trustedProxies = append(compiled.trustedProxies, network)
+	}
+	if config.ProxySecretHeader != "" && proxySecret == "" {
+		return compiled, fmt.Errorf("proxySecretHeader needs the COD_PROXY_SECRET environment variable")
+	}
+	// Logging users in without a password, and exempting users from read-only mode or rules, must
+	// not rest on a header any client can send
+	if !compiled.verifiesProxy() {
+		switch {
+		case config.SSO != nil && config.SSO.Enabled:
+			return compiled, fmt.Errorf("sso needs trustedProxies or proxySecretHeader to trust userHeader")
+		case len(config.Writers) > 0 || len(config.ReadOnlyUsers) > 0:
+			return compiled, fmt.Errorf("writers and readOnlyUsers need trustedProxies or proxySecretHeader to trust userHeader")
+		}
+		for _, rule := range config.Rules {
+			if len(rule.Users) > 0 {
+				return compiled, fmt.Errorf("rule %q: users need trustedProxies or proxySecretHeader to trust userHeader", rule.Name)
+			}
+		}
+	}
+	names := make(map[string]bool, len(config.Rules))
+	for i, rule := range config.Rules {
+		if rule.Name == "" {
+			return compiled, fmt.Errorf("rule %d has no name", i)
+		}
+		if names[rule.Name] {
+			return compiled, fmt.Errorf("duplicate rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Action != ActionAllow && rule.Action != ActionDeny {
+			return compiled, fmt.Errorf("rule %q: action must be %s or %s", rule.Name, ActionAllow, ActionDeny)
+		}
+
+		compiledRule := compiledRule{PolicyRule: rule}
+		for _, path := range rule.Paths {
+			if !strings.HasPrefix(path, "/") {
+				return compiled, fmt.Errorf("rule %q: path %q must start with /", rule.Name, path)
+			}
+			compiledRule.paths = append(compiledRule.paths, pathPattern(path))
+		}
+		compiled.rules = append(compiled.rules, compiledRule)
+	}
+	return compiled, nil
+}
+
+// pathPattern compiles a path glob: * matches one path segment and a trailing ** any number
+// of segments
+func pathPattern(glob string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, segment := range strings.Split(strings.TrimPrefix(glob, "/"), "/") {
+		if segment == "**" {
+			pattern.WriteString("(/.*)?")
+			continue
+		}
+		pattern.WriteString("/")
+		for j, part := range strings.Split(segment, "*") {
+			if j > 0 {
+				pattern.WriteString("[^/]*")
+			}
+			pattern.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+	pattern.WriteString("/?$")
+	return regexp.MustCompile(pattern.String())
+}
+
+func exempt(path string) bool {
+	for _, pattern := range readOnlyExempt {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package uiproxy
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func testPolicy(t *testing.T, config PolicyConfig, proxySecret string) *Policy {
+	t.Helper()
+	compiled, err := compilePolicy(config, proxySecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Policy{current: compiled}
+}
+
+func TestCheck(t *testing.T) {
+	policy := testPolicy(t, PolicyConfig{
+		ReadOnly:       true,
+		Writers:        []string{"alice"},
+		ReadOnlyUsers:  []string{"intern"},
+		UserHeader:     "X-Forwarded-User",
+		TrustedProxies: []string{"10.0.0.0/8"},
+		Rules: []PolicyRule{
+			{Name: "no-rebalance", Action: ActionDeny, Methods: []string{"post"}, Paths: []string{"/controller/rebalance"}},
+			{Name: "no-bucket-delete", Action: ActionDeny, Methods: []string{"DELETE"}, Paths: []string{"/pools/default/buckets/*"}},
+			{Name: "dev-flush", Action: ActionAllow, Clusters: []string{"dev"}, Paths: []string{"/pools/default/buckets/*/controller/doFlush"}},
+			{Name: "bob-settings", Action: ActionAllow, Users: []string{"bob"}, Paths: []string{"/settings/**"}},
+		},
+	}, "")
+
+	tests := []struct {
+		name    string
+		request ProxyRequest
+		allowed bool
+		rule    string
+	}{
+		{"reads are allowed", ProxyRequest{Method: "GET", Path: "/pools/default"}, true, ""},
+		{"method list is case-insensitive", ProxyRequest{User: "alice", Method: "POST", Path: "/controller/rebalance"}, false, "no-rebalance"},
+		{"trailing slash matches", ProxyRequest{User: "alice", Method: "POST", Path: "/controller/rebalance/"}, false, "no-rebalance"},
+		{"other methods skip the rule", ProxyRequest{User: "alice", Method: "GET", Path: "/controller/rebalance"}, true, ""},
+		{"* matches one segment", ProxyRequest{User: "alice", Method: "DELETE", Path: "/pools/default/buckets/travel"}, false, "no-bucket-delete"},
+		{"* does not match deeper", ProxyRequest{User: "alice", Method: "DELETE", Path: "/pools/default/buckets/travel/scopes/x"}, true, ""},
+		{"cluster rule", ProxyRequest{Cluster: "dev", Method: "POST", Path: "/pools/default/buckets/b/controller/doFlush"}, true, "dev-flush"},
+		{"cluster rule elsewhere", ProxyRequest{Cluster: "prod", Method: "POST", Path: "/pools/default/buckets/b/controller/doFlush"}, false, "read-only"},
+		{"** matches the rest", ProxyRequest{User: "bob", Method: "POST", Path: "/settings/ldap/groups"}, true, "bob-settings"},
+		{"** matches the prefix itself", ProxyRequest{User: "bob", Method: "POST", Path: "/settings"}, true, "bob-settings"},
+		{"read-only without identity", ProxyRequest{Method: "POST", Path: "/settings/ldap"}, false, "read-only"},
+		{"read-only for other users", ProxyRequest{User: "carol", Method: "PUT", Path: "/settings/ldap"}, false, "read-only"},
+		{"writers are exempt", ProxyRequest{User: "alice", Method: "POST", Path: "/settings/ldap"}, true, ""},
+		{"extension methods change state", ProxyRequest{Method: "PROPPATCH", Path: "/settings/ldap"}, false, "read-only"},
+		{"TRACE is safe", ProxyRequest{Method: "TRACE", Path: "/settings/ldap"}, true, ""},
+		{"login is exempt", ProxyRequest{Method: "POST", Path: "/uilogin"}, true, ""},
+		{"logout is exempt", ProxyRequest{Method: "POST", Path: "/uilogout"}, true, ""},
+		{"stats queries are exempt", ProxyRequest{Method: "POST", Path: "/pools/default/stats/range/kv_ops"}, true, ""},
+		{"exemptions are exact", ProxyRequest{Method: "POST", Path: "/uilogin/extra"}, false, "read-only"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision := policy.Check(test.request)
+			if decision.Allowed != test.allowed || decision.Rule != test.rule {
+				t.Errorf("Check() = %+v, want allowed=%v rule=%q", decision, test.allowed, test.rule)
+			}
+		})
+	}
+
+	intern := policy.Check(ProxyRequest{User: "intern", Method: "POST", Path: "/settings/ldap"})
+	if intern.Allowed {
+		t.Error("readOnlyUsers must stay read-only")
+	}
+}
+
+func TestCheckReadOnlyUsersWithoutReadOnly(t *testing.T) {
+	policy := testPolicy(t, PolicyConfig{ReadOnlyUsers: []string{"intern"}, UserHeader: "X-Forwarded-User",
+		ProxySecretHeader: "X-Proxy-Secret"}, "s3cret")
+	if policy.Check(ProxyRequest{User: "intern", Method: "POST", Path: "/settings/ldap"}).Allowed {
+		t.Error("intern must be read-only")
+	}
+	if !policy.Check(ProxyRequest{User: "alice", Method: "POST", Path: "/settings/ldap"}).Allowed {
+		t.Error("alice must be allowed")
+	}
+}
+
+func TestUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     PolicyConfig
+		remoteAddr string
+		secret     string
+		want       string
+	}{
+		{"no header configured", PolicyConfig{}, "10.1.2.3:1234", "", ""},
+		{"untrusted without proxy checks", PolicyConfig{UserHeader: "X-Forwarded-User"}, "10.1.2.3:1234", "", ""},
+		{"trusted proxy address", PolicyConfig{UserHeader: "X-Forwarded-User", TrustedProxies: []string{"10.0.0.0/8"}}, "10.1.2.3:1234", "", "alice"},
+		{"other address", PolicyConfig{UserHeader: "X-Forwarded-User", TrustedProxies: []string{"10.0.0.0/8"}}, "192.168.1.2:1234", "", ""},
+		{"IPv6 proxy", PolicyConfig{UserHeader: "X-Forwarded-User", TrustedProxies: []string{"fd00::/8"}}, "[fd00::1]:1234", "", "alice"},
+		{"matching secret", PolicyConfig{UserHeader: "X-Forwarded-User", ProxySecretHeader: "X-Proxy-Secret"}, "192.168.1.2:1234", "s3cret", "alice"},
+		{"wrong secret", PolicyConfig{UserHeader: "X-Forwarded-User", ProxySecretHeader: "X-Proxy-Secret"}, "192.168.1.2:1234", "guess", ""},
+		{"missing secret", PolicyConfig{UserHeader: "X-Forwarded-User", ProxySecretHeader: "X-Proxy-Secret"}, "192.168.1.2:1234", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := testPolicy(t, test.config, "s3cret")
+			r := httptest.NewRequest("GET", "/cui/dev/", nil)
+			r.RemoteAddr = test.remoteAddr
+			r.Header.Set("X-Forwarded-User", " alice ")
+			if test.secret != "" {
+				r.Header.Set("X-Proxy-Secret", test.secret)
+			}
+			if got := policy.User(r); got != test.want {
+				t.Errorf("User() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompilePolicyRequiresTrust(t *testing.T) {
+	tests := map[string]PolicyConfig{
+		"sso":           {UserHeader: "X-Forwarded-User", SSO: &SSOConfig{Enabled: true}},
+		"writers":       {UserHeader: "X-Forwarded-User", ReadOnly: true, Writers: []string{"alice"}},
+		"readOnlyUsers": {UserHeader: "X-Forwarded-User", ReadOnlyUsers: []string{"intern"}},
+		"rule users":    {UserHeader: "X-Forwarded-User", Rules: []PolicyRule{{Name: "r", Action: ActionAllow, Users: []string{"bob"}}}},
+	}
+	for name, config := range tests {
+		if _, err := compilePolicy(config, ""); err == nil {
+			t.Errorf("%s without trustedProxies or proxySecretHeader was accepted", name)
+		}
+	}
+
+	if _, err := compilePolicy(PolicyConfig{UserHeader: "X-Forwarded-User", ProxySecretHeader: "X-Proxy-Secret"}, ""); err == nil {
+		t.Error("proxySecretHeader without COD_PROXY_SECRET was accepted")
+	}
+	if _, err := compilePolicy(PolicyConfig{TrustedProxies: []string{"10.0.0.1"}}, ""); err == nil {
+		t.Error("an address without a prefix length was accepted as a CIDR")
+	}
+}
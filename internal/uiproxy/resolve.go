@@ -0,0 +1,184 @@
+package uiproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"cod/internal/cluster"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Annotations on a CouchbaseCluster overriding the Service and port its admin console is proxied to
+const (
+	ServiceAnnotation = "cod.couchbase.com/console-service"
+	PortAnnotation    = "cod.couchbase.com/console-port"
+)
+
+// Ways of reaching a cluster's admin console Service, set by COD_PROXY_MODE
+const (
+	ModeAuto      = "auto"      // Directly when the Service's DNS name resolves, through the API server otherwise
+	ModeDirect    = "direct"    // Through in-cluster DNS
+	ModeAPIServer = "apiserver" // Through the API server's services/proxy subresource
+)
+
+// clusterLabel is set by the operator on the Services of a cluster
+const clusterLabel = "couchbase_cluster"
+
+// Admin console ports of Couchbase Server
+const (
+	consolePort       = 8091
+	secureConsolePort = 18091
+)
+
+// resolve finds where a cluster's admin console is served. Clusters whose console cannot be
+// reached get an upstream explaining why; err is only set when the API server could not be asked.
+func (r *Registry) resolve(ctx context.Context, clusterObj *unstructured.Unstructured, clusterTLS *cluster.TLS) (*upstream, error) {
+	clusterName := clusterObj.GetName()
+	annotations := clusterObj.GetAnnotations()
+	serviceName := annotations[ServiceAnnotation]
+
+	if serviceName == "" {
+		exposed, _, _ := unstructured.NestedBool(clusterObj.Object, "spec", "networking", "exposeAdminConsole")
+		if !exposed {
+			return &upstream{unavailable: fmt.Sprintf("The admin console of cluster %s is not exposed. "+
+				"Set spec.networking.exposeAdminConsole: true on the CouchbaseCluster, or name the Service to use "+
+				"with the %s annotation.", clusterName, ServiceAnnotation)}, nil
+		}
+	}
+
+	port, scheme := int32(consolePort), "http"
+	if clusterTLS != nil {
+		port, scheme = secureConsolePort, "https"
+	}
+
+	// The client certificate is the operator's own, which would log every dashboard visitor into
+	// Couchbase Server as the operator, whatever read-only mode or single sign-on allow
+	if clusterTLS != nil && clusterTLS.ClientCertificatePolicy == cluster.ClientCertificateMandatory && !r.config.OperatorIdentity {
+		return &upstream{unavailable: fmt.Sprintf("Cluster %s requires client certificates, and the only one available is "+
+			"the operator's, which would give every dashboard user the operator's privileges in Couchbase Server. "+
+			"Set COD_PROXY_OPERATOR_CLIENT_CERT=true to accept that.", clusterName)}, nil
+	}
+
+	service, err := r.consoleService(ctx, clusterObj, serviceName, port)
+	if err != nil {
+		return nil, err
+	}
+	if service == nil {
+		if serviceName != "" {
+			return &upstream{unavailable: fmt.Sprintf("Service %s named by the %s annotation of cluster %s does not exist.",
+				serviceName, ServiceAnnotation, clusterName)}, nil
+		}
+		return &upstream{unavailable: fmt.Sprintf("No admin console Service of cluster %s was found. "+
+			"The operator creates it once spec.networking.exposeAdminConsole is true.", clusterName)}, nil
+	}
+
+	// Credentials and client certificates go wherever the annotation points, so it may only pick
+	// among the cluster's own Services
+	if !ownedBy(service, clusterObj) {
+		return &upstream{unavailable: fmt.Sprintf("Service %s named by the %s annotation of cluster %s is neither owned by "+
+			"the cluster nor labelled %s=%s.", service.Name, ServiceAnnotation, clusterName, clusterLabel, clusterName)}, nil
+	}
+
+	port, err = servicePort(service, annotations[PortAnnotation], port)
+	if err != nil {
+		return &upstream{unavailable: fmt.Sprintf("Cluster %s: %v", clusterName, err)}, nil
+	}
+
+	next := &upstream{tls: clusterTLS}
+	host := fmt.Sprintf("%s.%s.svc.cluster.local", service.Name, service.Namespace)
+	if r.config.Mode == ModeAPIServer || (r.config.Mode == ModeAuto && !resolvable(ctx, host)) {
+		// /api/v1/namespaces/<ns>/services/<scheme>:<name>:<port>/proxy
+		next.target = r.apiServer
+		next.pathPrefix = fmt.Sprintf("/api/v1/namespaces/%s/services/%s:%s:%d/proxy",
+			service.Namespace, scheme, service.Name, port)
+	} else {
+		next.target = &url.URL{Scheme: scheme, Host: net.JoinHostPort(host, strconv.Itoa(int(port)))}
+	}
+	return next, nil
+}
+
+// consoleService returns the named Service, or else the cluster's Service serving the admin
+// console: owned by or labelled with the cluster, not headless and exposing the console port.
+// <cluster>-ui, the Service the operator creates, is preferred.
+func (r *Registry) consoleService(ctx context.Context, clusterObj *unstructured.Unstructured,
+	serviceName string, consolePort int32) (*v1.Service, error) {
+
+	services := r.clientset.CoreV1().Services(clusterObj.GetNamespace())
+	if serviceName != "" {
+		service, err := services.Get(ctx, serviceName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service %s: %w", serviceName, err)
+		}
+		return service, nil
+	}
+
+	list, err := services.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	var candidates []*v1.Service
+	for i := range list.Items {
+		service := &list.Items[i]
+		if !ownedBy(service, clusterObj) || service.Spec.ClusterIP == v1.ClusterIPNone {
+			continue
+		}
+		if _, err := servicePort(service, "", consolePort); err == nil {
+			candidates = append(candidates, service)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	preferred := clusterObj.GetName() + "-ui"
+	sort.Slice(candidates, func(i, j int) bool {
+		if (candidates[i].Name == preferred) != (candidates[j].Name == preferred) {
+			return candidates[i].Name == preferred
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates[0], nil
+}
+
+func ownedBy(service *v1.Service, clusterObj *unstructured.Unstructured) bool {
+	for _, owner := range service.OwnerReferences {
+		if owner.UID == clusterObj.GetUID() {
+			return true
+		}
+	}
+	return service.Labels[clusterLabel] == clusterObj.GetName()
+}
+
+// servicePort returns the Service port to use: the annotated port, else the port that is or
+// targets the console port
+func servicePort(service *v1.Service, annotated string, consolePort int32) (int32, error) {
+	if annotated != "" {
+		port, err := strconv.Atoi(annotated)
+		if err != nil || port <= 0 || port > 65535 {
+			return 0, fmt.Errorf("invalid %s annotation %q", PortAnnotation, annotated)
+		}
+		return int32(port), nil
+	}
+	for _, port := range service.Spec.Ports {
+		if port.Port == consolePort || port.TargetPort.IntValue() == int(consolePort) {
+			return port.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("service %s exposes no port for the admin console port %d", service.Name, consolePort)
+}
+
+// resolvable reports whether a Service's DNS name resolves from the dashboard's pod
+func resolvable(ctx context.Context, host string) bool {
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	return err == nil && len(addresses) > 0
+}
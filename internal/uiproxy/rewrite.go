@@ -0,0 +1,199 @@
+package uiproxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cod/internal/security"
+)
+
+// ClusterCookie names the cluster whose console was opened last. It routes the console's
+// requests that escape the /cui/<cluster>/ prefix, e.g. plain links to /pools.
+const ClusterCookie = "cod_cui_cluster"
+
+// routingScriptPath is served by the proxy itself under /cui/<cluster>/
+const routingScriptPath = "/__cod/routing.js"
+
+// maxRewriteSize bounds the HTML pages that are buffered for rewriting
+const maxRewriteSize = 8 << 20
+
+var (
+	headPattern = regexp.MustCompile(`(?i)<head[^>]*>`)
+	basePattern = regexp.MustCompile(`(?i)(<base\s[^>]*href=["'])/`)
+)
+
+// routingScript keeps the console's XHR and fetch calls to its own origin under the cluster's
+// prefix, so every tab talks to the cluster it was opened for. Calls that change state carry the
+// dashboard's CSRF token.
+const routingScript = `(function () {
+  var prefix = %s;
+  function route(url) {
+    try {
+      var parsed = new URL(url, window.location.href);
+      if (parsed.origin !== window.location.origin || parsed.pathname.indexOf(prefix + "/") === 0) {
+        return url;
+      }
+      return prefix + parsed.pathname + parsed.search + parsed.hash;
+    } catch (e) {
+      return url;
+    }
+  }
+  function csrfToken() {
+    var match = document.cookie.match(/(?:^|; )%s=([^;]*)/);
+    return match ? match[1] : "";
+  }
+  function changesState(method) {
+    return !/^(GET|HEAD|OPTIONS|TRACE)$/i.test(method || "GET");
+  }
+  var open = XMLHttpRequest.prototype.open;
+  var send = XMLHttpRequest.prototype.send;
+  XMLHttpRequest.prototype.open = function (method, url) {
+    var args = Array.prototype.slice.call(arguments);
+    args[1] = route(String(url));
+    this._codChangesState = changesState(method);
+    return open.apply(this, args);
+  };
+  XMLHttpRequest.prototype.send = function () {
+    if (this._codChangesState && csrfToken()) {
+      this.setRequestHeader(%s, csrfToken());
+    }
+    return send.apply(this, arguments);
+  };
+  if (window.fetch) {
+    var fetch = window.fetch;
+    window.fetch = function (input, init) {
+      if (typeof input === "string" || input instanceof URL) {
+        input = route(String(input));
+      } else if (input instanceof Request) {
+        input = new Request(route(input.url), input);
+      }
+      var method = (init && init.method) || (input instanceof Request ? input.method : "GET");
+      if (changesState(method) && csrfToken()) {
+        init = Object.assign({}, init);
+        var headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+        headers.set(%s, csrfToken());
+        init.headers = headers;
+      }
+      return fetch.call(this, input, init);
+    };
+  }
+})();
+`
+
+// ClusterFromCookie returns the cluster named by the routing cookie, if any
+func ClusterFromCookie(r *http.Request) string {
+	cookie, err := r.Cookie(ClusterCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// serveRoutingScript writes the routing script of a cluster or node prefix
+func serveRoutingScript(w http.ResponseWriter, prefix string) {
+	prefixJSON, _ := json.Marshal(prefix)
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	headerJSON, _ := json.Marshal(security.TokenHeader)
+	fmt.Fprintf(w, routingScript, prefixJSON, security.TokenCookie, headerJSON, headerJSON)
+}
+
+// rewriteHTML loads the routing script into a console page, moves its base URL under the
+// cluster's or node's prefix and sets the routing cookie. pathPrefix is the API server's proxy
+// path the page's links point at, if any.
+func (p *Proxy) rewriteHTML(resp *http.Response, prefix, pathPrefix string) error {
+	if resp.StatusCode != http.StatusOK || resp.Request.Method != http.MethodGet {
+		return nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return nil
+	}
+
+	cookie := &http.Cookie{
+		Name:     ClusterCookie,
+		Value:    p.cluster,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	resp.Header.Add("Set-Cookie", cookie.String())
+
+	encoding := resp.Header.Get("Content-Encoding")
+	if encoding != "" && encoding != "identity" && encoding != "gzip" {
+		return nil // Left as is; the routing cookie still applies
+	}
+	if resp.ContentLength > maxRewriteSize {
+		return nil
+	}
+
+	var reader io.Reader = resp.Body
+	if encoding == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	body, err := io.ReadAll(io.LimitReader(reader, maxRewriteSize+1))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if len(body) > maxRewriteSize {
+		return fmt.Errorf("page exceeds %d bytes", maxRewriteSize)
+	}
+
+	if pathPrefix != "" {
+		// The API server points links at its services/proxy path; point them at the root instead
+		body = bytes.ReplaceAll(body, []byte(pathPrefix+"/"), []byte("/"))
+	}
+	body = basePattern.ReplaceAll(body, []byte("${1}"+prefix+"/"))
+	tag := []byte(`<script src="` + prefix + routingScriptPath + `"></script>`)
+	if location := headPattern.FindIndex(body); location != nil {
+		body = append(body[:location[1]:location[1]], append(tag, body[location[1]:]...)...)
+	} else {
+		body = append(tag, body...)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("ETag")
+	return nil
+}
+
+// unavailablePage explains why a cluster's admin console cannot be proxied
+const unavailablePage = `<!DOCTYPE html>
+<html>
+<head><title>Couchbase UI unavailable</title></head>
+<body style="font-family: sans-serif; margin: 3em;">
+<h1>Couchbase UI of %s unavailable</h1>
+<p>%s</p>
+<p><a href="/">Back to the dashboard</a></p>
+</body>
+</html>
+`
+
+// serveUnavailable writes the page explaining why the console cannot be proxied
+func (p *Proxy) serveUnavailable(w http.ResponseWriter, reason string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, unavailablePage, html.EscapeString(p.cluster), html.EscapeString(reason))
+}
+
+// isRoutingScript reports whether a request under a cluster's or node's prefix is for the routing script
+func isRoutingScript(r *http.Request, prefix string) bool {
+	return strings.TrimPrefix(r.URL.Path, prefix) == routingScriptPath
+}
@@ -0,0 +1,105 @@
+package uiproxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Credentials are a Couchbase Server login injected into console requests
+type Credentials struct {
+	Username string
+	Password string
+}
+
+type credentialsKey struct{}
+
+// WithCredentials returns a request whose console requests are sent as the given login
+func WithCredentials(r *http.Request, credentials Credentials) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), credentialsKey{}, credentials))
+}
+
+// injectCredentials replaces the browser's own console login with the injected one. Requests
+// through the API server cannot carry a Couchbase login, as the API server consumes the
+// Authorization header.
+func injectCredentials(req *http.Request, viaAPIServer bool) {
+	credentials, ok := req.Context().Value(credentialsKey{}).(Credentials)
+	if !ok || viaAPIServer {
+		return
+	}
+
+	// Couchbase Server prefers a session over Basic auth, so drop any session from a manual login
+	req.Header.Del("ns-server-auth-token")
+	if cookies := req.Cookies(); len(cookies) > 0 {
+		req.Header.Del("Cookie")
+		for _, cookie := range cookies {
+			if !strings.HasPrefix(cookie.Name, "ui-auth-") {
+				req.AddCookie(cookie)
+			}
+		}
+	}
+	req.SetBasicAuth(credentials.Username, credentials.Password)
+}
+
+// credentialsTTL is how long looked up logins are reused, so that rotated passwords are picked up
+// without reading Secrets on every console request
+const credentialsTTL = time.Minute
+
+type credentialsCacheKey struct {
+	cluster       string
+	couchbaseUser string
+}
+
+type cachedCredentials struct {
+	credentials Credentials
+	expires     time.Time
+}
+
+// CredentialsCache looks up and briefly caches the logins injected for single sign-on
+type CredentialsCache struct {
+	lookup  func(ctx context.Context, clusterObj *unstructured.Unstructured, couchbaseUser string) (Credentials, error)
+	entries map[credentialsCacheKey]cachedCredentials
+	mutex   sync.Mutex
+}
+
+// NewCredentialsCache creates a cache over lookup, which reads the login of a CouchbaseUser of a
+// cluster, or of its administrator when couchbaseUser is empty
+func NewCredentialsCache(lookup func(ctx context.Context, clusterObj *unstructured.Unstructured, couchbaseUser string) (Credentials, error)) *CredentialsCache {
+	return &CredentialsCache{lookup: lookup, entries: make(map[credentialsCacheKey]cachedCredentials)}
+}
+
+// Get returns the login of a CouchbaseUser of a cluster, or of its administrator when
+// couchbaseUser is empty
+func (c *CredentialsCache) Get(ctx context.Context, clusterObj *unstructured.Unstructured, couchbaseUser string) (Credentials, error) {
+	key := credentialsCacheKey{cluster: clusterObj.GetName(), couchbaseUser: couchbaseUser}
+	c.mutex.Lock()
+	cached, exists := c.entries[key]
+	c.mutex.Unlock()
+	if exists && time.Now().Before(cached.expires) {
+		return cached.credentials, nil
+	}
+
+	credentials, err := c.lookup(ctx, clusterObj, couchbaseUser)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.mutex.Lock()
+	c.entries[key] = cachedCredentials{credentials: credentials, expires: time.Now().Add(credentialsTTL)}
+	c.mutex.Unlock()
+	return credentials, nil
+}
+
+// Remove forgets the cached logins of a cluster
+func (c *CredentialsCache) Remove(clusterName string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key := range c.entries {
+		if key.cluster == clusterName {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,664 @@
+package uiproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cod/internal/cluster"
+	"cod/internal/logger"
+	"cod/internal/metrics"
+	"cod/internal/utils"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// latencyBuckets are the upper bounds in seconds of the proxy latency histogram. The Couchbase UI
+// long-polls, so the slowest buckets are expected to fill too.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// defaultStripHeaders are upstream response headers that reveal server software or API server
+// internals, or make browsers prompt for Couchbase credentials
+var defaultStripHeaders = []string{"Server", "X-Powered-By", "WWW-Authenticate", "Audit-Id",
+	"X-Kubernetes-Pf-Flowschema-Uid", "X-Kubernetes-Pf-Prioritylevel-Uid"}
+
+// Config tunes the transport shared by every cluster's proxy
+type Config struct {
+	MaxConnsPerHost       int
+	MaxIdleConnsPerHost   int
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration // Must exceed the UI's long-poll interval
+	IdleConnTimeout       time.Duration
+	Mode                  string   // ModeAuto, ModeDirect or ModeAPIServer
+	StripHeaders          []string // Removed from upstream responses
+	OperatorIdentity      bool     // Present the operator's client certificate to clusters that require one
+}
+
+// ConfigFromEnv reads the proxy transport settings from COD_PROXY_* variables
+func ConfigFromEnv() Config {
+	config := Config{
+		MaxConnsPerHost:       utils.GetEnvInt("COD_PROXY_MAX_CONNS_PER_HOST", 64),
+		MaxIdleConnsPerHost:   utils.GetEnvInt("COD_PROXY_MAX_IDLE_CONNS_PER_HOST", 32),
+		DialTimeout:           utils.GetEnvDuration("COD_PROXY_DIAL_TIMEOUT", 5*time.Second),
+		ResponseHeaderTimeout: utils.GetEnvDuration("COD_PROXY_RESPONSE_TIMEOUT", 60*time.Second),
+		IdleConnTimeout:       utils.GetEnvDuration("COD_PROXY_IDLE_TIMEOUT", 90*time.Second),
+		Mode:                  ModeAuto,
+		StripHeaders:          defaultStripHeaders,
+		OperatorIdentity:      utils.GetEnvBool("COD_PROXY_OPERATOR_CLIENT_CERT", false),
+	}
+	if value, set := os.LookupEnv("COD_PROXY_STRIP_HEADERS"); set {
+		config.StripHeaders = nil
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				config.StripHeaders = append(config.StripHeaders, header)
+			}
+		}
+	}
+	switch mode := os.Getenv("COD_PROXY_MODE"); mode {
+	case ModeDirect, ModeAPIServer:
+		config.Mode = mode
+	case "", ModeAuto:
+	default:
+		logger.Log.Warn("Unknown COD_PROXY_MODE, using auto", zap.String("mode", mode))
+	}
+	return config
+}
+
+// Stats are the request counts, errors and latency of a cluster's proxy
+type Stats struct {
+	Cluster      string                    `json:"cluster"`
+	Target       string                    `json:"target"`
+	TLS          bool                      `json:"tls"`
+	ViaAPIServer bool                      `json:"viaAPIServer"`          // Proxied through the API server's services/proxy
+	Unavailable  string                    `json:"unavailable,omitempty"` // Why the console cannot be proxied
+	Requests     uint64                    `json:"requests"`
+	InFlight     int64                     `json:"inFlight"`
+	ProxyErrors  uint64                    `json:"proxyErrors"`  // Couchbase unreachable or timed out
+	ServerErrors uint64                    `json:"serverErrors"` // 5xx responses from Couchbase
+	Latency      metrics.DistributionStats `json:"latency"`      // Seconds until the response completed
+	LastError    string                    `json:"lastError,omitempty"`
+	LastErrorAt  *time.Time                `json:"lastErrorAt,omitempty"`
+}
+
+// upstream is where a proxy forwards to. It is replaced when the cluster's console Service or
+// TLS settings change.
+type upstream struct {
+	target      *url.URL
+	pathPrefix  string // services/proxy path when going through the API server
+	transport   http.RoundTripper
+	tls         *cluster.TLS // nil for plain HTTP
+	unavailable string       // Set instead of target when the console cannot be proxied
+}
+
+// equal reports whether two upstreams forward to the same place with the same TLS material
+func (u *upstream) equal(other *upstream) bool {
+	return u.targetURL() == other.targetURL() && u.unavailable == other.unavailable && u.tls.Equal(other.tls)
+}
+
+func (u *upstream) targetURL() string {
+	if u.target == nil {
+		return ""
+	}
+	return u.target.String() + u.pathPrefix
+}
+
+// closeIdleConnections releases the connections of a transport that is no longer used
+func closeIdleConnections(transport http.RoundTripper) {
+	if closer, ok := transport.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// Proxy forwards the UI and its API calls to one cluster
+type Proxy struct {
+	cluster      string
+	prefix       string // /cui/<cluster>
+	stripHeaders []string
+	upstream     atomic.Pointer[upstream]
+	ui           *httputil.ReverseProxy
+	api          *httputil.ReverseProxy
+	node         *httputil.ReverseProxy
+
+	requests     atomic.Uint64
+	inFlight     atomic.Int64
+	proxyErrors  atomic.Uint64
+	serverErrors atomic.Uint64
+
+	mutex        sync.Mutex
+	bucketCounts []uint64 // Non-cumulative, one per latency bucket plus +Inf
+	latencySum   float64
+	lastError    string
+	lastErrorAt  time.Time
+}
+
+// Registry holds a reverse proxy per cluster, created when the cluster appears and removed
+// when it is deleted
+type Registry struct {
+	clientset          kubernetes.Interface
+	namespace          string
+	config             Config
+	transport          *http.Transport   // Shared by clusters without TLS and cloned for each TLS cluster
+	apiServer          *url.URL          // Target of clusters proxied through services/proxy
+	apiServerTransport http.RoundTripper // Authenticates to the API server as the dashboard
+	proxies            map[string]*Proxy
+	mutex              sync.RWMutex
+	queue              workqueue.Interface  // Names of clusters whose proxy needs a sync
+	retries            map[string]retryWait // Backoff of on-access syncs of unavailable consoles
+	retriesMutex       sync.Mutex
+}
+
+// retryWait spaces out the syncs of a console that stays unavailable
+type retryWait struct {
+	next  time.Time
+	delay time.Duration
+}
+
+// Backoff of on-access syncs of an unavailable console
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// syncWorkers sync proxies concurrently, as a sync can wait on the API server and DNS for a while
+const syncWorkers = 4
+
+func NewRegistry(restConfig *rest.Config, clientset kubernetes.Interface, namespace string, config Config) (*Registry, error) {
+	apiServer, _, err := rest.DefaultServerUrlFor(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server URL: %w", err)
+	}
+	apiServerTransport, err := rest.TransportFor(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API server transport: %w", err)
+	}
+
+	dialer := &net.Dialer{Timeout: config.DialTimeout, KeepAlive: 30 * time.Second}
+	return &Registry{
+		clientset:          clientset,
+		namespace:          namespace,
+		config:             config,
+		apiServer:          &url.URL{Scheme: apiServer.Scheme, Host: apiServer.Host},
+		apiServerTransport: apiServerTransport,
+		transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          0, // Limited per host instead
+			MaxConnsPerHost:       config.MaxConnsPerHost,
+			MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+			IdleConnTimeout:       config.IdleConnTimeout,
+			TLSHandshakeTimeout:   config.DialTimeout,
+			ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+			ExpectContinueTimeout: time.Second,
+		},
+		proxies: make(map[string]*Proxy),
+		queue:   workqueue.New(),
+		retries: make(map[string]retryWait),
+	}, nil
+}
+
+// Enqueue schedules a sync of a cluster's proxy, so that informer handlers never wait on the
+// API server or DNS. A new cluster's proxy exists right away, unavailable until resolved.
+func (r *Registry) Enqueue(clusterName string) {
+	r.mutex.Lock()
+	if _, exists := r.proxies[clusterName]; !exists {
+		proxy := newProxy(clusterName, r.config.StripHeaders)
+		proxy.upstream.Store(&upstream{unavailable: fmt.Sprintf("The admin console of cluster %s is still being resolved", clusterName)})
+		r.proxies[clusterName] = proxy
+	}
+	r.mutex.Unlock()
+	r.queue.Add(clusterName)
+}
+
+// Retry schedules a sync of a cluster whose console is unavailable, e.g. because the operator has
+// not created its Service yet. Retries on access back off up to a minute, so that browsers loading
+// an unavailable console do not turn every request into API server calls.
+func (r *Registry) Retry(clusterName string) {
+	now := time.Now()
+	r.retriesMutex.Lock()
+	wait := r.retries[clusterName]
+	if now.Before(wait.next) {
+		r.retriesMutex.Unlock()
+		return
+	}
+	wait.delay = min(max(2*wait.delay, minRetryDelay), maxRetryDelay)
+	wait.next = now.Add(wait.delay)
+	r.retries[clusterName] = wait
+	r.retriesMutex.Unlock()
+	r.queue.Add(clusterName)
+}
+
+// Sync creates the proxy of a cluster, or updates it when the cluster's admin console Service,
+// spec.networking.tls settings or TLS Secrets changed. TLS clusters are proxied to the secure
+// console port.
+func (r *Registry) Sync(ctx context.Context, clusterObj *unstructured.Unstructured) {
+	clusterName := clusterObj.GetName()
+	clusterTLS, tlsErr := cluster.TLSSettings(ctx, r.clientset, clusterObj)
+	next, err := r.resolve(ctx, clusterObj, clusterTLS)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	proxy, exists := r.proxies[clusterName]
+	for _, err := range []error{tlsErr, err} {
+		if err == nil {
+			continue
+		}
+		logger.Log.Warn("Failed to resolve the Couchbase UI proxy target",
+			zap.Error(err),
+			zap.String("cluster", clusterName))
+		if exists && proxy.upstream.Load().unavailable == "" {
+			return // Keep the working settings until the API server answers
+		}
+	}
+	if next == nil {
+		next = &upstream{unavailable: fmt.Sprintf("The admin console Service of cluster %s could not be resolved: %v", clusterName, err)}
+	}
+	if exists && proxy.upstream.Load().equal(next) {
+		return
+	}
+
+	r.attachTransport(clusterName, next)
+	if !exists {
+		proxy = newProxy(clusterName, r.config.StripHeaders)
+		r.proxies[clusterName] = proxy
+	}
+	if previous := proxy.upstream.Swap(next); previous != nil && previous.transport != r.transport {
+		closeIdleConnections(previous.transport)
+	}
+	if next.unavailable != "" {
+		logger.Log.Warn("Couchbase UI cannot be proxied",
+			zap.String("cluster", clusterName),
+			zap.String("reason", next.unavailable))
+		return
+	}
+	r.retriesMutex.Lock()
+	delete(r.retries, clusterName)
+	r.retriesMutex.Unlock()
+	logger.Log.Info("Configured Couchbase UI proxy",
+		zap.String("cluster", clusterName),
+		zap.String("target", next.target.String()+next.pathPrefix),
+		zap.Bool("clientCertificate", clusterTLS != nil && len(clusterTLS.Certificate) > 0))
+}
+
+// Run syncs the queued proxies, and re-syncs every cluster's proxy each interval, so moved
+// Services and rotated TLS Secrets are picked up
+func (r *Registry) Run(ctx context.Context, interval time.Duration,
+	clusterNames func() []string,
+	clusterObject func(clusterName string) (*unstructured.Unstructured, bool)) {
+
+	for i := 0; i < syncWorkers; i++ {
+		go r.syncQueued(ctx, clusterObject)
+	}
+	defer r.queue.ShutDown()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, clusterName := range clusterNames() {
+			r.queue.Add(clusterName)
+		}
+	}
+}
+
+// syncQueued syncs the proxies of queued clusters until the queue shuts down
+func (r *Registry) syncQueued(ctx context.Context, clusterObject func(clusterName string) (*unstructured.Unstructured, bool)) {
+	for {
+		item, shutdown := r.queue.Get()
+		if shutdown {
+			return
+		}
+		clusterName := item.(string)
+		if clusterObj, exists := clusterObject(clusterName); exists {
+			syncCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			r.Sync(syncCtx, clusterObj)
+			cancel()
+		}
+		r.queue.Done(item)
+	}
+}
+
+// Remove tears down the proxy of a deleted cluster
+func (r *Registry) Remove(clusterName string) {
+	r.mutex.Lock()
+	proxy, exists := r.proxies[clusterName]
+	delete(r.proxies, clusterName)
+	r.mutex.Unlock()
+	r.retriesMutex.Lock()
+	delete(r.retries, clusterName)
+	r.retriesMutex.Unlock()
+	if exists && proxy.upstream.Load().transport != r.transport {
+		closeIdleConnections(proxy.upstream.Load().transport)
+	}
+}
+
+// attachTransport picks the transport of a resolved upstream: the API server's, the shared one
+// for plain HTTP, or a clone verifying the cluster's certificate for HTTPS
+func (r *Registry) attachTransport(clusterName string, next *upstream) {
+	switch {
+	case next.unavailable != "":
+	case next.pathPrefix != "":
+		next.transport = r.apiServerTransport
+		if next.tls != nil && next.tls.ClientCertificatePolicy == cluster.ClientCertificateMandatory {
+			logger.Log.Warn("The API server cannot present the client certificate this cluster requires",
+				zap.String("cluster", clusterName))
+		}
+	case next.tls == nil:
+		next.transport = r.transport
+	default:
+		transport := r.transport.Clone()
+		transport.TLSClientConfig = r.clientTLSConfig(clusterName, next.target.Hostname(), next.tls)
+		next.transport = transport
+	}
+}
+
+// clientTLSConfig verifies a cluster against its CA and presents the client certificate it requires
+func (r *Registry) clientTLSConfig(clusterName, host string, clusterTLS *cluster.TLS) *tls.Config {
+	config, err := clusterTLS.ClientConfig(clusterName, r.namespace, host)
+	if err != nil {
+		logger.Log.Error("Invalid cluster TLS material, verifying against the system roots without a client certificate",
+			zap.Error(err),
+			zap.String("cluster", clusterName))
+		config, _ = (&cluster.TLS{}).ClientConfig(clusterName, r.namespace, host)
+	}
+	return config
+}
+
+// Get returns the proxy of a cluster
+func (r *Registry) Get(clusterName string) (*Proxy, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	proxy, exists := r.proxies[clusterName]
+	return proxy, exists
+}
+
+// Stats returns the stats of every cluster's proxy
+func (r *Registry) Stats() []Stats {
+	r.mutex.RLock()
+	proxies := make([]*Proxy, 0, len(r.proxies))
+	for _, proxy := range r.proxies {
+		proxies = append(proxies, proxy)
+	}
+	r.mutex.RUnlock()
+
+	stats := make([]Stats, 0, len(proxies))
+	for _, proxy := range proxies {
+		stats = append(stats, proxy.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Cluster < stats[j].Cluster })
+	return stats
+}
+
+func newProxy(clusterName string, stripHeaders []string) *Proxy {
+	p := &Proxy{
+		cluster:      clusterName,
+		prefix:       "/cui/" + clusterName,
+		stripHeaders: stripHeaders,
+		bucketCounts: make([]uint64, len(latencyBuckets)+1),
+	}
+
+	p.ui = &httputil.ReverseProxy{
+		Transport: transportFunc(p.roundTrip),
+		Director: func(req *http.Request) {
+			// Rewrite path: remove /cui/<clustername> prefix
+			current := requestUpstream(req)
+			setTarget(req, current.target, current.pathPrefix+strings.TrimPrefix(req.URL.Path, p.prefix))
+			injectCredentials(req, current.pathPrefix != "")
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			return p.modifyResponse(resp, p.prefix, requestUpstream(resp.Request).pathPrefix)
+		},
+		ErrorHandler: p.errorHandler("UI proxy error"),
+	}
+
+	p.api = &httputil.ReverseProxy{
+		Transport: transportFunc(p.roundTrip),
+		Director: func(req *http.Request) {
+			// Keep the original path
+			current := requestUpstream(req)
+			setTarget(req, current.target, current.pathPrefix+req.URL.Path)
+			injectCredentials(req, current.pathPrefix != "")
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			p.observeStatus(resp)
+			p.stripResponseHeaders(resp)
+			return nil
+		},
+		ErrorHandler: p.errorHandler("API proxy error"),
+	}
+
+	p.node = &httputil.ReverseProxy{
+		Transport: transportFunc(p.roundTrip),
+		Director: func(req *http.Request) {
+			// Rewrite path: remove /cui/<clustername>/node/<pod> prefix
+			route := req.Context().Value(nodeRouteKey{}).(*nodeRoute)
+			setTarget(req, route.target, route.pathPrefix+strings.TrimPrefix(req.URL.Path, route.prefix))
+			injectCredentials(req, route.pathPrefix != "")
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			route := resp.Request.Context().Value(nodeRouteKey{}).(*nodeRoute)
+			return p.modifyResponse(resp, route.prefix, route.pathPrefix)
+		},
+		ErrorHandler: p.errorHandler("Node proxy error"),
+	}
+	return p
+}
+
+// modifyResponse keeps redirects and console pages under a cluster's or node's prefix
+func (p *Proxy) modifyResponse(resp *http.Response, prefix, pathPrefix string) error {
+	p.observeStatus(resp)
+	p.stripResponseHeaders(resp)
+	// Rewrite redirect Location headers to stay under the prefix
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if location := resp.Header.Get("Location"); location != "" {
+			redirectURL, err := url.Parse(location)
+			if err != nil {
+				logger.Log.Error("Failed to parse redirect URL",
+					zap.Error(err),
+					zap.String("location", location),
+					zap.String("cluster", p.cluster))
+			} else {
+				newLocation := prefix + strings.TrimPrefix(redirectURL.Path, pathPrefix)
+				resp.Header.Set("Location", newLocation)
+				logger.Log.Debug("Rewrote redirect location",
+					zap.String("originalLocation", location),
+					zap.String("newLocation", newLocation),
+					zap.String("cluster", p.cluster))
+			}
+		}
+	}
+	return p.rewriteHTML(resp, prefix, pathPrefix)
+}
+
+// stripResponseHeaders removes the configured headers from an upstream response
+func (p *Proxy) stripResponseHeaders(resp *http.Response) {
+	for _, header := range p.stripHeaders {
+		resp.Header.Del(header)
+	}
+}
+
+// transportFunc adapts a function to http.RoundTripper
+type transportFunc func(*http.Request) (*http.Response, error)
+
+func (f transportFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Target returns the URL requests are forwarded to, empty when the console cannot be proxied
+func (p *Proxy) Target() string {
+	return p.upstream.Load().targetURL()
+}
+
+// Unavailable explains why the console cannot be proxied, empty when it can
+func (p *Proxy) Unavailable() string {
+	return p.upstream.Load().unavailable
+}
+
+// ServeUI proxies /cui/<cluster>/... to the cluster's admin console. Console pages are rewritten
+// so that the console's own requests stay under /cui/<cluster>/.
+func (p *Proxy) ServeUI(w http.ResponseWriter, r *http.Request) {
+	if isRoutingScript(r, p.prefix) {
+		serveRoutingScript(w, p.prefix)
+		return
+	}
+	current := p.upstream.Load()
+	if current.unavailable != "" {
+		p.serveUnavailable(w, current.unavailable)
+		return
+	}
+	p.serve(p.ui, w, r, current)
+}
+
+// ServeAPI proxies a console request that escaped the /cui/<cluster>/ prefix, keeping its path
+func (p *Proxy) ServeAPI(w http.ResponseWriter, r *http.Request) {
+	current := p.upstream.Load()
+	if current.unavailable != "" {
+		p.serveUnavailable(w, current.unavailable)
+		return
+	}
+	p.serve(p.api, w, r, current)
+}
+
+// upstreamKey carries the upstream a request was routed to in its context
+type upstreamKey struct{}
+
+// requestUpstream returns the upstream a request was routed to. Sync may swap the proxy's upstream
+// at any time, so each request sticks to the one loaded when it arrived, keeping its target, path
+// prefix and transport consistent.
+func requestUpstream(req *http.Request) *upstream {
+	return req.Context().Value(upstreamKey{}).(*upstream)
+}
+
+func (p *Proxy) serve(proxy *httputil.ReverseProxy, w http.ResponseWriter, r *http.Request, current *upstream) {
+	r = r.WithContext(context.WithValue(r.Context(), upstreamKey{}, current))
+	p.requests.Add(1)
+	p.inFlight.Add(1)
+	start := time.Now()
+	defer func() {
+		p.inFlight.Add(-1)
+		p.observeLatency(time.Since(start).Seconds())
+	}()
+	proxy.ServeHTTP(w, r)
+}
+
+// setTarget points an outgoing request at a target with the given path
+func setTarget(req *http.Request, target *url.URL, path string) {
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path = path
+	req.URL.RawPath = ""
+	req.Host = target.Host
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// Explicitly disable the default Go User-Agent, as httputil.NewSingleHostReverseProxy does
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+func (p *Proxy) roundTrip(req *http.Request) (*http.Response, error) {
+	current := requestUpstream(req)
+	if current.transport == nil {
+		return nil, errors.New(current.unavailable)
+	}
+	return current.transport.RoundTrip(req)
+}
+
+func (p *Proxy) errorHandler(message string) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		p.proxyErrors.Add(1)
+		p.recordError(err.Error())
+		logger.Log.Error(message,
+			zap.Error(err),
+			zap.String("cluster", p.cluster),
+			zap.String("target", requestUpstream(r).targetURL()),
+			zap.String("path", r.URL.Path),
+			zap.String("method", r.Method),
+			zap.String("remoteAddr", r.RemoteAddr))
+		http.Error(w, fmt.Sprintf("Proxy error: %v", err), http.StatusBadGateway)
+	}
+}
+
+func (p *Proxy) observeStatus(resp *http.Response) {
+	if resp.StatusCode >= 500 {
+		p.serverErrors.Add(1)
+		p.recordError(fmt.Sprintf("%s %s returned %s", resp.Request.Method, resp.Request.URL.Path, resp.Status))
+	}
+}
+
+func (p *Proxy) recordError(message string) {
+	p.mutex.Lock()
+	p.lastError = message
+	p.lastErrorAt = time.Now()
+	p.mutex.Unlock()
+}
+
+func (p *Proxy) observeLatency(seconds float64) {
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	p.mutex.Lock()
+	p.bucketCounts[i]++
+	p.latencySum += seconds
+	p.mutex.Unlock()
+}
+
+// Stats returns the proxy's counters and latency distribution
+func (p *Proxy) Stats() Stats {
+	current := p.upstream.Load()
+	stats := Stats{
+		Cluster:      p.cluster,
+		Target:       current.targetURL(),
+		TLS:          current.tls != nil,
+		ViaAPIServer: current.pathPrefix != "",
+		Unavailable:  current.unavailable,
+		Requests:     p.requests.Load(),
+		InFlight:     p.inFlight.Load(),
+		ProxyErrors:  p.proxyErrors.Load(),
+		ServerErrors: p.serverErrors.Load(),
+	}
+
+	// Summarise the latency histogram with the metrics package's quantile estimation
+	histogram := &dto.Histogram{}
+	var cumulative uint64
+	p.mutex.Lock()
+	for i, upperBound := range latencyBuckets {
+		cumulative += p.bucketCounts[i]
+		histogram.Bucket = append(histogram.Bucket, &dto.Bucket{UpperBound: proto.Float64(upperBound), CumulativeCount: proto.Uint64(cumulative)})
+	}
+	cumulative += p.bucketCounts[len(latencyBuckets)]
+	histogram.SampleCount = proto.Uint64(cumulative)
+	histogram.SampleSum = proto.Float64(p.latencySum)
+	stats.LastError = p.lastError
+	if !p.lastErrorAt.IsZero() {
+		lastErrorAt := p.lastErrorAt
+		stats.LastErrorAt = &lastErrorAt
+	}
+	p.mutex.Unlock()
+
+	family := &dto.MetricFamily{
+		Name:   proto.String("cod_proxy_latency_seconds"),
+		Type:   dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{Histogram: histogram}},
+	}
+	stats.Latency = metrics.Distributions([]*dto.MetricFamily{family}, metrics.DefaultQuantiles)[0].Series[0].Current
+	return stats
+}
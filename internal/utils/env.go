@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"cod/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// GetEnvInt reads an integer from the environment, falling back to def when unset or invalid
+func GetEnvInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Log.Warn("Invalid integer in environment, using default",
+			zap.String("key", key),
+			zap.String("value", value),
+			zap.Int("default", def))
+		return def
+	}
+	return parsed
+}
+
+// GetEnvDuration reads a Go duration (e.g. "5m") from the environment, falling back to def when unset or invalid
+func GetEnvDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Log.Warn("Invalid duration in environment, using default",
+			zap.String("key", key),
+			zap.String("value", value),
+			zap.Duration("default", def))
+		return def
+	}
+	return parsed
+}
+
+// GetEnvBool reads a boolean (e.g. "true", "1") from the environment, falling back to def when unset or invalid
+func GetEnvBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Log.Warn("Invalid boolean in environment, using default",
+			zap.String("key", key),
+			zap.String("value", value),
+			zap.Bool("default", def))
+		return def
+	}
+	return parsed
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig builds a client TLS config from an optional CA bundle and client certificate
+func TLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	var caData, certData, keyData []byte
+	var err error
+	if caFile != "" {
+		if caData, err = os.ReadFile(caFile); err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		if certData, err = os.ReadFile(certFile); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		if keyData, err = os.ReadFile(keyFile); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+	}
+	return TLSConfigFromPEM(caData, certData, keyData, insecureSkipVerify)
+}
+
+// TLSConfigFromPEM builds a client TLS config from an optional PEM CA bundle and client certificate
+func TLSConfigFromPEM(caData, certData, keyData []byte, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if len(caData) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificates found in CA bundle")
+		}
+	}
+	if len(certData) > 0 || len(keyData) > 0 {
+		certificate, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
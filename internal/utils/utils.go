@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"time"
 
 	"cod/internal/logger"
 
@@ -23,6 +24,12 @@ type Message struct {
 	SessionID   string                              `json:"sessionId,omitempty"`
 	Clusters    []string                            `json:"clusters,omitempty"`
 	Conditions  map[string][]map[string]interface{} `json:"conditions,omitempty"`
+	Seq         uint64                              `json:"seq,omitempty"`
+	Deleted     bool                                `json:"deleted,omitempty"`
+	Data        interface{}                         `json:"data,omitempty"` // Structured payload for subsystem updates
+	ClientID    string                              `json:"-"`              // Routes a message to a single client, never serialized
+	OccurredAt  time.Time                           `json:"-"`              // When a K8s event last occurred, for storm detection
+	Replayed    bool                                `json:"-"`              // A K8s event listed when its watcher started, not a new one
 }
 
 // GetPodLabels retrieves labels of an involved pod
@@ -0,0 +1,312 @@
+package volumes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cod/internal/logger"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Volume is a PVC owned by a cluster with its capacity and usage
+type Volume struct {
+	Name            string  `json:"name"`
+	Pod             string  `json:"pod,omitempty"`
+	Node            string  `json:"node,omitempty"`
+	StorageClass    string  `json:"storageClass,omitempty"`
+	Phase           string  `json:"phase"`
+	RequestedBytes  int64   `json:"requestedBytes"`
+	CapacityBytes   int64   `json:"capacityBytes"` // Bound capacity from the PVC status
+	UsageKnown      bool    `json:"usageKnown"`    // Usage comes from the kubelet and may be unavailable
+	UsedBytes       int64   `json:"usedBytes,omitempty"`
+	AvailableBytes  int64   `json:"availableBytes,omitempty"`
+	FSCapacityBytes int64   `json:"fsCapacityBytes,omitempty"` // Filesystem size as seen by the kubelet
+	UsedPercent     float64 `json:"usedPercent,omitempty"`
+	ExpansionStatus string  `json:"expansionStatus,omitempty"`
+	Warning         string  `json:"warning,omitempty"`
+}
+
+// Report is the volume summary of a single cluster
+type Report struct {
+	Cluster             string    `json:"cluster"`
+	Volumes             []Volume  `json:"volumes"`
+	TotalRequestedBytes int64     `json:"totalRequestedBytes"`
+	TotalCapacityBytes  int64     `json:"totalCapacityBytes"`
+	TotalUsedBytes      int64     `json:"totalUsedBytes"`
+	Warnings            []string  `json:"warnings,omitempty"`
+	CollectedAt         time.Time `json:"collectedAt"`
+}
+
+// Warning is raised when a volume crosses the fill threshold
+type Warning struct {
+	Cluster     string  `json:"cluster"`
+	Volume      string  `json:"volume"`
+	UsedPercent float64 `json:"usedPercent"`
+	Message     string  `json:"message"`
+}
+
+// volumeStats is the usage of a single PVC from the kubelet summary API
+type volumeStats struct {
+	UsedBytes      *int64 `json:"usedBytes"`
+	CapacityBytes  *int64 `json:"capacityBytes"`
+	AvailableBytes *int64 `json:"availableBytes"`
+	PVCRef         *struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"pvcRef"`
+}
+
+// kubeletSummary holds the parts of /stats/summary we need
+type kubeletSummary struct {
+	Pods []struct {
+		Volumes []volumeStats `json:"volume"`
+	} `json:"pods"`
+}
+
+// Collector periodically gathers PVC capacity and kubelet usage per cluster
+type Collector struct {
+	clientset     *kubernetes.Clientset
+	namespace     string
+	fillThreshold float64           // Used percentage at which a volume raises a warning
+	reports       map[string]Report // Latest report per cluster
+	warned        map[string]bool   // Volumes currently above the threshold, to raise warnings once
+	reportsMutex  sync.RWMutex
+}
+
+func NewCollector(clientset *kubernetes.Clientset, namespace string, fillThreshold float64) *Collector {
+	return &Collector{
+		clientset:     clientset,
+		namespace:     namespace,
+		fillThreshold: fillThreshold,
+		reports:       make(map[string]Report),
+		warned:        make(map[string]bool),
+	}
+}
+
+// Run collects reports every interval. clusterNames lists the tracked clusters and pods
+// resolves a cluster's pods so each PVC can be mapped to the node whose kubelet reports it.
+func (c *Collector) Run(ctx context.Context, interval time.Duration,
+	clusterNames func() []string,
+	pods func(clusterName string) ([]*v1.Pod, error),
+	onWarning func(warning Warning)) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, warning := range c.collect(ctx, clusterNames(), pods) {
+			onWarning(warning)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Report returns the latest report of a cluster
+func (c *Collector) Report(clusterName string) (Report, bool) {
+	c.reportsMutex.RLock()
+	defer c.reportsMutex.RUnlock()
+
+	report, exists := c.reports[clusterName]
+	return report, exists
+}
+
+// Forget drops the report of a deleted cluster
+func (c *Collector) Forget(clusterName string) {
+	c.reportsMutex.Lock()
+	delete(c.reports, clusterName)
+	for key := range c.warned {
+		if strings.HasPrefix(key, clusterName+"/") {
+			delete(c.warned, key)
+		}
+	}
+	c.reportsMutex.Unlock()
+}
+
+func (c *Collector) collect(ctx context.Context, clusterNames []string, pods func(clusterName string) ([]*v1.Pod, error)) []Warning {
+	// One PVC list for all clusters
+	pvcList, err := c.clientset.CoreV1().PersistentVolumeClaims(c.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "couchbase_cluster",
+	})
+	if err != nil {
+		logger.Log.Error("Failed to list persistent volume claims",
+			zap.Error(err),
+			zap.String("namespace", c.namespace))
+		return nil
+	}
+
+	// Map each claim to the pod and node mounting it
+	type mount struct{ pod, node string }
+	mounts := make(map[string]mount)
+	nodes := make(map[string]bool)
+	for _, clusterName := range clusterNames {
+		clusterPods, err := pods(clusterName)
+		if err != nil {
+			continue
+		}
+		for _, pod := range clusterPods {
+			for _, volume := range pod.Spec.Volumes {
+				if volume.PersistentVolumeClaim != nil {
+					mounts[volume.PersistentVolumeClaim.ClaimName] = mount{pod: pod.Name, node: pod.Spec.NodeName}
+					if pod.Spec.NodeName != "" {
+						nodes[pod.Spec.NodeName] = true
+					}
+				}
+			}
+		}
+	}
+
+	// One kubelet summary per node
+	usage := make(map[string]volumeStats)
+	for node := range nodes {
+		stats, err := c.fetchNodeVolumeStats(ctx, node)
+		if err != nil {
+			logger.Log.Debug("Failed to fetch kubelet volume stats",
+				zap.Error(err),
+				zap.String("node", node))
+			continue
+		}
+		for claim, stat := range stats {
+			usage[claim] = stat
+		}
+	}
+
+	reports := make(map[string]*Report, len(clusterNames))
+	for _, clusterName := range clusterNames {
+		reports[clusterName] = &Report{Cluster: clusterName, Volumes: []Volume{}, CollectedAt: time.Now()}
+	}
+
+	var warnings []Warning
+	c.reportsMutex.Lock()
+	defer c.reportsMutex.Unlock()
+
+	for i := range pvcList.Items {
+		pvc := &pvcList.Items[i]
+		clusterName := pvc.Labels["couchbase_cluster"]
+		report, ok := reports[clusterName]
+		if !ok {
+			continue
+		}
+
+		volume := c.buildVolume(pvc)
+		volume.Pod = mounts[pvc.Name].pod
+		volume.Node = mounts[pvc.Name].node
+
+		if stat, ok := usage[pvc.Name]; ok && stat.UsedBytes != nil && stat.CapacityBytes != nil && *stat.CapacityBytes > 0 {
+			volume.UsageKnown = true
+			volume.UsedBytes = *stat.UsedBytes
+			volume.FSCapacityBytes = *stat.CapacityBytes
+			if stat.AvailableBytes != nil {
+				volume.AvailableBytes = *stat.AvailableBytes
+			}
+			volume.UsedPercent = float64(volume.UsedBytes) / float64(volume.FSCapacityBytes) * 100
+		}
+
+		key := clusterName + "/" + pvc.Name
+		if volume.UsageKnown && volume.UsedPercent >= c.fillThreshold {
+			volume.Warning = fmt.Sprintf("volume is %.1f%% full (threshold %.0f%%)", volume.UsedPercent, c.fillThreshold)
+			report.Warnings = append(report.Warnings, pvc.Name+": "+volume.Warning)
+
+			// Only raise the warning when the threshold is first crossed
+			if !c.warned[key] {
+				c.warned[key] = true
+				logger.Log.Warn("Volume crossed fill threshold",
+					zap.String("cluster", clusterName),
+					zap.String("pvc", pvc.Name),
+					zap.Float64("usedPercent", volume.UsedPercent))
+				warnings = append(warnings, Warning{
+					Cluster:     clusterName,
+					Volume:      pvc.Name,
+					UsedPercent: volume.UsedPercent,
+					Message:     volume.Warning,
+				})
+			}
+		} else if volume.UsageKnown {
+			delete(c.warned, key)
+		}
+
+		report.TotalRequestedBytes += volume.RequestedBytes
+		report.TotalCapacityBytes += volume.CapacityBytes
+		report.TotalUsedBytes += volume.UsedBytes
+		report.Volumes = append(report.Volumes, volume)
+	}
+
+	for clusterName, report := range reports {
+		sort.Slice(report.Volumes, func(i, j int) bool { return report.Volumes[i].Name < report.Volumes[j].Name })
+		c.reports[clusterName] = *report
+	}
+
+	return warnings
+}
+
+func (c *Collector) buildVolume(pvc *v1.PersistentVolumeClaim) Volume {
+	volume := Volume{
+		Name:  pvc.Name,
+		Phase: string(pvc.Status.Phase),
+	}
+	if pvc.Spec.StorageClassName != nil {
+		volume.StorageClass = *pvc.Spec.StorageClassName
+	}
+	if requested, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]; ok {
+		volume.RequestedBytes = requested.Value()
+	}
+	if capacity, ok := pvc.Status.Capacity[v1.ResourceStorage]; ok {
+		volume.CapacityBytes = capacity.Value()
+	}
+
+	// Resize conditions are the most specific signal, then the allocation status
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Status == v1.ConditionTrue &&
+			(condition.Type == v1.PersistentVolumeClaimResizing || condition.Type == v1.PersistentVolumeClaimFileSystemResizePending) {
+			volume.ExpansionStatus = string(condition.Type)
+		}
+	}
+	if volume.ExpansionStatus == "" {
+		if status, ok := pvc.Status.AllocatedResourceStatuses[v1.ResourceStorage]; ok {
+			volume.ExpansionStatus = string(status)
+		} else if volume.CapacityBytes > 0 && volume.RequestedBytes > volume.CapacityBytes {
+			volume.ExpansionStatus = "ExpansionPending"
+		}
+	}
+
+	return volume
+}
+
+// fetchNodeVolumeStats reads the kubelet summary through the API server node proxy
+// and returns the usage of every PVC-backed volume in the watched namespace
+func (c *Collector) fetchNodeVolumeStats(ctx context.Context, node string) (map[string]volumeStats, error) {
+	raw, err := c.clientset.CoreV1().RESTClient().Get().
+		AbsPath("/api/v1/nodes", node, "proxy", "stats", "summary").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary kubeletSummary
+	if err := json.Unmarshal(raw, &summary); err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]volumeStats)
+	for _, pod := range summary.Pods {
+		for _, volume := range pod.Volumes {
+			if volume.PVCRef != nil && volume.PVCRef.Namespace == c.namespace {
+				stats[volume.PVCRef.Name] = volume
+			}
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,88 @@
+// Audit Log Functionality
+document.addEventListener('DOMContentLoaded', () => {
+    setupAuditFiltering();
+
+    // Load entries if URL hash is #audit
+    if (window.location.hash === '#audit') {
+        loadAuditEntries();
+    }
+});
+
+const AUDIT_SEARCH_DEBOUNCE_DELAY = 300; // Delay in ms for search debounce
+let auditSearchTimeout = null;
+
+// Reload the entries whenever a filter changes
+function setupAuditFiltering() {
+    ['auditCluster', 'auditSource', 'auditSince'].forEach(id => {
+        const element = document.getElementById(id);
+        if (element) {
+            element.addEventListener('change', loadAuditEntries);
+        }
+    });
+    ['auditSearch', 'auditUser'].forEach(id => {
+        const element = document.getElementById(id);
+        if (element) {
+            element.addEventListener('input', () => {
+                clearTimeout(auditSearchTimeout);
+                auditSearchTimeout = setTimeout(loadAuditEntries, AUDIT_SEARCH_DEBOUNCE_DELAY);
+            });
+        }
+    });
+}
+
+// Fetch the audit entries matching the filters, newest first
+async function loadAuditEntries() {
+    const tbody = document.getElementById('auditEntries');
+    if (!tbody) return;
+
+    const params = new URLSearchParams();
+    const filters = { q: 'auditSearch', cluster: 'auditCluster', source: 'auditSource', user: 'auditUser', since: 'auditSince' };
+    for (const [param, id] of Object.entries(filters)) {
+        const value = document.getElementById(id)?.value.trim();
+        if (value) params.set(param, value);
+    }
+
+    try {
+        const response = await fetch(`/api/audit?${params}`);
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        renderAuditEntries(tbody, await response.json());
+    } catch (error) {
+        console.error('Error fetching audit entries:', error);
+        tbody.innerHTML = `<tr><td colspan="7" class="audit-empty">Failed to load audit entries: ${escapeAuditHTML(error.message)}</td></tr>`;
+    }
+}
+
+function renderAuditEntries(tbody, entries) {
+    if (!entries || entries.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="7" class="audit-empty">No audited actions</td></tr>';
+        return;
+    }
+
+    tbody.innerHTML = entries.map(entry => {
+        const statusClass = entry.status >= 400 ? 'audit-status-error' : 'audit-status-ok';
+        const cluster = entry.node ? `${entry.cluster} / ${entry.node}` : entry.cluster;
+        const blocked = entry.rule ? `<span class="audit-rule" title="Blocked by policy rule">${escapeAuditHTML(entry.rule)}</span>` : '';
+        return `
+            <tr>
+                <td title="${escapeAuditHTML(entry.remoteAddr)}">${escapeAuditHTML(new Date(entry.time).toLocaleString())}</td>
+                <td>${escapeAuditHTML(entry.user || '-')}</td>
+                <td>${escapeAuditHTML(cluster || '-')}</td>
+                <td><span class="audit-source">${escapeAuditHTML(entry.source)}</span> <strong>${escapeAuditHTML(entry.method)}</strong> <code>${escapeAuditHTML(entry.path)}</code></td>
+                <td class="audit-body">${escapeAuditHTML(entry.body || '')}</td>
+                <td class="${statusClass}">${entry.status} ${blocked}</td>
+                <td>${entry.durationMs ? `${entry.durationMs.toFixed(1)} ms` : '-'}</td>
+            </tr>
+        `;
+    }).join('');
+}
+
+function escapeAuditHTML(value) {
+    return String(value ?? '')
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&#39;');
+}
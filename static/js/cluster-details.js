@@ -1,5 +1,5 @@
 // ==================== IMPORTS ======================
-import { socket, LOG_BATCH_INTERVAL, EVENT_BATCH_INTERVAL, SEARCH_DEBOUNCE_DELAY, generateSessionId, highlightMatches } from './core.js';
+import { socket, LOG_BATCH_INTERVAL, EVENT_BATCH_INTERVAL, SEARCH_DEBOUNCE_DELAY, generateSessionId, highlightMatches, applyConditionsMessage, escapeHTML, formatBytes } from './core.js';
 
 // ==================== CONSTANTS AND GLOBALS ======================
 let currentLogSessionId = null;
@@ -8,6 +8,7 @@ let logFragment = null;
 let batchTimeoutId = null;
 let eventFragment = null;
 let eventBatchTimeoutId = null;
+let stormEntries = {}; // Event storm feed entries by storm ID, updated in place
 
 
 let eventsFuse = null;
@@ -36,6 +37,33 @@ document.addEventListener('DOMContentLoaded', () => {
             window.open(`/cui/${clusterName}/`, '_blank');
         });
     }
+
+    // Load the reconcile status; later changes arrive over the WebSocket
+    loadReconcileStatus(clusterName);
+
+    // Load the pod topology; later changes arrive over the WebSocket
+    loadTopology(clusterName);
+
+    // Load volume capacity and usage
+    loadVolumes(clusterName);
+    const refreshVolumesBtn = document.getElementById('refreshVolumes');
+    if (refreshVolumesBtn) {
+        refreshVolumesBtn.addEventListener('click', () => loadVolumes(clusterName));
+    }
+
+    // Load Couchbase Server bucket and node stats
+    loadServerStats(clusterName);
+    const refreshServerStatsBtn = document.getElementById('refreshServerStats');
+    if (refreshServerStatsBtn) {
+        refreshServerStatsBtn.addEventListener('click', () => loadServerStats(clusterName));
+    }
+
+    // Load spec history and allow manual refresh
+    loadSpecHistory(clusterName);
+    const refreshSpecHistoryBtn = document.getElementById('refreshSpecHistory');
+    if (refreshSpecHistoryBtn) {
+        refreshSpecHistoryBtn.addEventListener('click', () => loadSpecHistory(clusterName));
+    }
 });
 
 // ==================== INITIALIZATION FUNCTIONS ==================
@@ -252,8 +280,11 @@ function initializeSearchFunctionality() {
 function handleWebSocketMessage(event) {
     const data = JSON.parse(event.data);
     
-    if (data.type === "clusterConditions") {
-        renderConditions(data.conditions);
+    if (data.type === "clusterConditions" || data.type === "clusterConditionsDelta") {
+        const conditions = applyConditionsMessage(data);
+        if (conditions) {
+            renderConditions(conditions);
+        }
         return;
     }
     
@@ -266,6 +297,30 @@ function handleWebSocketMessage(event) {
         updateLogs(data);
         return;
     }
+
+    if (data.type === "topology") {
+        const clusterName = document.getElementById('clusterNameHolder').getAttribute('data-name');
+        if (data.cluster === clusterName) {
+            renderTopology(data.topology);
+        }
+        return;
+    }
+
+    if (data.type === "volumeWarning") {
+        const clusterName = document.getElementById('clusterNameHolder').getAttribute('data-name');
+        if (data.cluster === clusterName) {
+            loadVolumes(clusterName);
+        }
+        return;
+    }
+
+    if (data.type === "reconcileStatus") {
+        const clusterName = document.getElementById('clusterNameHolder').getAttribute('data-name');
+        if (data.cluster === clusterName) {
+            renderReconcileStatus(data.status);
+        }
+        return;
+    }
 }
 
 // ==================== SEARCH FUNCTIONS ====================
@@ -376,6 +431,14 @@ function searchLogs(query) {
 
 // ==================== UPDATE FUNCTIONS ====================
 function updateEvents(eventData) {
+    // Storm summaries are updated in place rather than appended
+    const stormEntry = eventData.kind === 'EventStorm' && stormEntries[eventData.name];
+    if (stormEntry && stormEntry.parentNode) {
+        stormEntry.querySelector('.event-message').textContent = eventData.message;
+        stormEntry.classList.toggle('event-storm-ended', !eventData.data.active);
+        return;
+    }
+
     if (eventsFuse) {
         eventsFuse.add(eventData);
     }
@@ -394,6 +457,11 @@ function updateEvents(eventData) {
         </div>
         <div class="event-message">${eventData.message}</div>
     `;
+    if (eventData.kind === 'EventStorm') {
+        eventElement.classList.add('event-storm');
+        eventElement.classList.toggle('event-storm-ended', !eventData.data.active);
+        stormEntries[eventData.name] = eventElement;
+    }
     
     // Initialize fragment if it doesn't exist
     if (!eventFragment) {
@@ -562,6 +630,345 @@ function renderConditions(allConditions) {
     });
 }
 
+async function loadReconcileStatus(clusterName) {
+    const container = document.getElementById('reconcileStatusContainer');
+    if (!container) return;
+
+    try {
+        const response = await fetch(`/api/clusters/${encodeURIComponent(clusterName)}/reconcile`);
+        if (!response.ok) {
+            throw new Error(`Error fetching reconcile status: ${response.status}`);
+        }
+        renderReconcileStatus(await response.json());
+    } catch (error) {
+        console.error('Failed to load reconcile status:', error);
+        container.innerHTML = '<div class="no-conditions">Failed to load reconcile status</div>';
+    }
+}
+
+function renderReconcileStatus(status) {
+    const container = document.getElementById('reconcileStatusContainer');
+    if (!container || !status) return;
+
+    const formatTime = value => value ? new Date(value).toLocaleString() : 'Never';
+    const color = {
+        'Reconciled': 'green',
+        'Reconciling': 'blue',
+        'Failing': 'orange',
+        'Stuck': 'red'
+    }[status.state] || 'grey';
+
+    container.innerHTML = `
+        <div class="condition-card status-${color}">
+            <div class="condition-header">
+                <h3>${escapeHTML(status.state || 'Unknown')}</h3>
+                <span class="condition-status">Generation ${status.observedGeneration} / ${status.generation}</span>
+            </div>
+            <div class="condition-details">
+                <div class="condition-field">
+                    <span class="field-label">Reason:</span>
+                    <span class="field-value">${escapeHTML(status.reason || 'None')}</span>
+                </div>
+                <div class="condition-field">
+                    <span class="field-label">Reconcile Lag:</span>
+                    <span class="field-value">${status.pendingSince ? `${Math.round(status.lagSeconds)}s` : 'None'}</span>
+                </div>
+                <div class="condition-field">
+                    <span class="field-label">Reconcile Failures:</span>
+                    <span class="field-value">${status.reconcileFailures}</span>
+                </div>
+                <div class="condition-field">
+                    <span class="field-label">Last Error:</span>
+                    <span class="field-value">${escapeHTML(status.lastError || 'None')}</span>
+                </div>
+                <div class="condition-timestamps">
+                    <div class="condition-field">
+                        <span class="field-label">Last Operator Activity:</span>
+                        <span class="field-value">${formatTime(status.lastActivityAt)}</span>
+                    </div>
+                    <div class="condition-field">
+                        <span class="field-label">Last Failure:</span>
+                        <span class="field-value">${formatTime(status.lastFailureAt)}</span>
+                    </div>
+                </div>
+            </div>
+        </div>
+    `;
+}
+
+async function loadTopology(clusterName) {
+    const container = document.getElementById('topologyContainer');
+    if (!container) return;
+
+    try {
+        const response = await fetch(`/api/clusters/${encodeURIComponent(clusterName)}/topology`);
+        if (!response.ok) {
+            throw new Error(`Error fetching topology: ${response.status}`);
+        }
+        renderTopology(await response.json());
+    } catch (error) {
+        console.error('Failed to load topology:', error);
+        container.innerHTML = '<div class="no-conditions">Failed to load pod topology</div>';
+    }
+}
+
+function renderTopology(topology) {
+    const container = document.getElementById('topologyContainer');
+    const violationsContainer = document.getElementById('topologyViolations');
+    if (!container || !topology) return;
+
+    violationsContainer.innerHTML = '';
+    (topology.violations || []).forEach(violation => {
+        const item = document.createElement('div');
+        item.className = `topology-violation violation-${violation.type}`;
+        item.textContent = `${violation.pod ? violation.pod + ': ' : ''}${violation.message}`;
+        violationsContainer.appendChild(item);
+    });
+
+    container.innerHTML = '';
+    if (!topology.serverClasses || topology.serverClasses.length === 0) {
+        container.innerHTML = '<div class="no-conditions">No server classes found for this cluster</div>';
+        return;
+    }
+
+    topology.serverClasses.forEach(serverClass => {
+        const pods = serverClass.pods || [];
+        const classEl = document.createElement('div');
+        classEl.className = 'server-class';
+
+        let podRows = '';
+        pods.forEach(pod => {
+            const color = pod.problem ? 'red' : (pod.ready ? 'green' : 'orange');
+            podRows += `
+                <tr>
+                    <td><span class="pod-status-dot status-${color}" title="${escapeHTML(pod.problem || pod.phase)}"></span>${escapeHTML(pod.name)}
+                        <a class="pod-console-link" href="/cui/${encodeURIComponent(topology.cluster)}/node/${encodeURIComponent(pod.name)}/" target="_blank" rel="noopener" title="Open this node's Couchbase UI">UI</a></td>
+                    <td>${escapeHTML(pod.node || 'Unscheduled')}</td>
+                    <td>${escapeHTML(pod.zone || '-')}</td>
+                    <td>${escapeHTML(pod.serverGroup || '-')}</td>
+                    <td>${escapeHTML((pod.pvcs || []).join(', ') || '-')}</td>
+                    <td>${escapeHTML(pod.phase)}${pod.ready ? ' (Ready)' : ''}</td>
+                    <td>${pod.restarts}</td>
+                </tr>`;
+        });
+
+        classEl.innerHTML = `
+            <div class="server-class-header">
+                <span class="server-class-name">${escapeHTML(serverClass.name || 'unknown')}</span>
+                <span class="server-class-meta">${pods.length}/${serverClass.size} pods · ${escapeHTML((serverClass.services || []).join(', '))}</span>
+            </div>
+            ${podRows ? `
+            <table class="topology-table">
+                <thead><tr><th>Pod</th><th>Node</th><th>Zone</th><th>Server Group</th><th>PVCs</th><th>Status</th><th>Restarts</th></tr></thead>
+                <tbody>${podRows}</tbody>
+            </table>` : ''}
+        `;
+        container.appendChild(classEl);
+    });
+}
+
+async function loadVolumes(clusterName) {
+    const container = document.getElementById('volumesContainer');
+    if (!container) return;
+
+    try {
+        const response = await fetch(`/api/clusters/${encodeURIComponent(clusterName)}/volumes`);
+        if (response.status === 503) {
+            container.innerHTML = '<div class="no-conditions">Volume usage has not been collected yet</div>';
+            return;
+        }
+        if (!response.ok) {
+            throw new Error(`Error fetching volumes: ${response.status}`);
+        }
+        renderVolumes(await response.json());
+    } catch (error) {
+        console.error('Failed to load volumes:', error);
+        container.innerHTML = '<div class="no-conditions">Failed to load volumes</div>';
+    }
+}
+
+function renderVolumes(report) {
+    const container = document.getElementById('volumesContainer');
+    if (!container || !report) return;
+
+    const volumes = report.volumes || [];
+    if (volumes.length === 0) {
+        container.innerHTML = '<div class="no-conditions">No persistent volumes found for this cluster</div>';
+        return;
+    }
+
+    let rows = '';
+    volumes.forEach(volume => {
+        const usage = volume.usageKnown
+            ? `${formatBytes(volume.usedBytes)} / ${formatBytes(volume.fsCapacityBytes)} (${volume.usedPercent.toFixed(1)}%)`
+            : 'Unavailable';
+        rows += `
+            <tr class="${volume.warning ? 'volume-warning' : ''}" title="${escapeHTML(volume.warning || '')}">
+                <td>${escapeHTML(volume.name)}</td>
+                <td>${escapeHTML(volume.pod || '-')}</td>
+                <td>${escapeHTML(volume.storageClass || '-')}</td>
+                <td>${escapeHTML(volume.phase)}</td>
+                <td>${formatBytes(volume.requestedBytes)}</td>
+                <td>${formatBytes(volume.capacityBytes)}</td>
+                <td>${escapeHTML(volume.expansionStatus || '-')}</td>
+                <td>
+                    <div class="volume-usage-bar"><div class="volume-usage-fill" style="width: ${volume.usageKnown ? Math.min(volume.usedPercent, 100) : 0}%"></div></div>
+                    ${usage}
+                </td>
+            </tr>`;
+    });
+
+    container.innerHTML = `
+        <div class="volumes-summary">
+            Requested ${formatBytes(report.totalRequestedBytes)} · Bound ${formatBytes(report.totalCapacityBytes)} · Used ${formatBytes(report.totalUsedBytes)}
+        </div>
+        <table class="topology-table">
+            <thead><tr><th>PVC</th><th>Pod</th><th>Storage Class</th><th>Phase</th><th>Requested</th><th>Bound</th><th>Expansion</th><th>Usage</th></tr></thead>
+            <tbody>${rows}</tbody>
+        </table>
+    `;
+}
+
+async function loadServerStats(clusterName) {
+    const container = document.getElementById('serverStatsContainer');
+    if (!container) return;
+
+    try {
+        const response = await fetch(`/api/clusters/${encodeURIComponent(clusterName)}/serverstats`);
+        if (response.status === 503) {
+            container.innerHTML = '<div class="no-conditions">Server metrics have not been collected yet</div>';
+            return;
+        }
+        if (!response.ok) {
+            throw new Error(`Error fetching server metrics: ${response.status}`);
+        }
+        renderServerStats(await response.json());
+    } catch (error) {
+        console.error('Failed to load server metrics:', error);
+        container.innerHTML = '<div class="no-conditions">Failed to load server metrics</div>';
+    }
+}
+
+function formatServerStat(stat, value) {
+    if (value === undefined || value === null) return '-';
+    switch (stat.unit) {
+        case 'bytes':
+            return formatBytes(value);
+        case '%':
+            return `${value.toFixed(1)}%`;
+        case 'ops/s':
+            return value.toFixed(1);
+        default:
+            return Math.round(value).toLocaleString();
+    }
+}
+
+function renderServerStats(report) {
+    const container = document.getElementById('serverStatsContainer');
+    if (!container || !report) return;
+
+    if (report.error) {
+        container.innerHTML = `<div class="no-conditions">Server metrics unavailable: ${escapeHTML(report.error)}</div>`;
+        return;
+    }
+
+    const stats = report.stats || [];
+    const header = stats.map(stat => `<th>${escapeHTML(stat.title)}</th>`).join('');
+    const cells = values => stats.map(stat => `<td>${formatServerStat(stat, (values || {})[stat.name])}</td>`).join('');
+
+    let bucketRows = '';
+    (report.buckets || []).forEach(bucket => {
+        bucketRows += `<tr><td>${escapeHTML(bucket.bucket)}</td>${cells(bucket.values)}</tr>`;
+    });
+    if (bucketRows) {
+        bucketRows += `<tr class="server-stats-total"><td>Total</td>${cells(report.totals)}</tr>`;
+    }
+
+    let nodeRows = '';
+    (report.nodes || []).forEach(node => {
+        nodeRows += node.error
+            ? `<tr class="volume-warning" title="${escapeHTML(node.error)}"><td>${escapeHTML(node.node)}</td><td colspan="${stats.length}">${escapeHTML(node.error)}</td></tr>`
+            : `<tr><td>${escapeHTML(node.node)}</td>${cells(node.values)}</tr>`;
+    });
+
+    const collectedAt = report.collectedAt ? new Date(report.collectedAt).toLocaleString() : 'Unknown';
+    container.innerHTML = `
+        <div class="volumes-summary">Collected ${collectedAt}</div>
+        ${bucketRows ? `
+        <table class="topology-table">
+            <thead><tr><th>Bucket</th>${header}</tr></thead>
+            <tbody>${bucketRows}</tbody>
+        </table>` : '<div class="no-conditions">No bucket statistics reported</div>'}
+        ${nodeRows ? `
+        <table class="topology-table">
+            <thead><tr><th>Node</th>${header}</tr></thead>
+            <tbody>${nodeRows}</tbody>
+        </table>` : ''}
+    `;
+}
+
+async function loadSpecHistory(clusterName) {
+    const container = document.getElementById('specHistoryContainer');
+    if (!container) return;
+
+    try {
+        const response = await fetch(`/api/clusters/${encodeURIComponent(clusterName)}/history`);
+        if (!response.ok) {
+            throw new Error(`Error fetching spec history: ${response.status}`);
+        }
+        renderSpecHistory(await response.json());
+    } catch (error) {
+        console.error('Failed to load spec history:', error);
+        container.innerHTML = `<div class="no-conditions">Failed to load spec history</div>`;
+    }
+}
+
+function renderSpecHistory(changes) {
+    const container = document.getElementById('specHistoryContainer');
+    container.innerHTML = '';
+
+    if (!changes || changes.length === 0) {
+        container.innerHTML = '<div class="no-conditions">No spec history recorded yet</div>';
+        return;
+    }
+
+    changes.forEach(change => {
+        const entry = document.createElement('div');
+        entry.className = 'spec-change';
+
+        const timestamp = change.timestamp ? new Date(change.timestamp).toLocaleString() : 'Unknown';
+        const title = change.initial
+            ? `Generation ${change.generation} (first observed)`
+            : `Generation ${change.previousGeneration} → ${change.generation}`;
+        const managers = (change.managers || []).map(escapeHTML).join(', ');
+
+        let diffRows = '';
+        (change.diff || []).forEach(item => {
+            diffRows += `
+                <tr class="diff-${item.op}">
+                    <td class="diff-path">${escapeHTML(item.path)}</td>
+                    <td>${item.op}</td>
+                    <td class="diff-value">${item.old !== undefined ? escapeHTML(JSON.stringify(item.old)) : ''}</td>
+                    <td class="diff-value">${item.new !== undefined ? escapeHTML(JSON.stringify(item.new)) : ''}</td>
+                    <td>${(item.managers || []).map(escapeHTML).join(', ')}</td>
+                </tr>`;
+        });
+
+        entry.innerHTML = `
+            <div class="spec-change-header">
+                <span class="spec-change-title">${title}</span>
+                <span class="spec-change-meta">${timestamp}${managers ? ` · ${managers}` : ''}</span>
+            </div>
+            ${diffRows ? `
+            <table class="spec-diff-table">
+                <thead><tr><th>Field</th><th>Change</th><th>Old</th><th>New</th><th>Manager</th></tr></thead>
+                <tbody>${diffRows}</tbody>
+            </table>` : ''}
+        `;
+        container.appendChild(entry);
+    });
+}
+
 function getConditionColor(status, type) {
     if (status === 'Unknown') {
         return 'grey';
@@ -1,16 +1,74 @@
 // core.js - Common global variables and utility functions
-export const socket = new WebSocket("ws://" + window.location.host + "/ws");
+export const socket = new WebSocket((window.location.protocol === "https:" ? "wss://" : "ws://") + window.location.host + "/ws");
 
 // Timing constants
 export const LOG_BATCH_INTERVAL = 500;
 export const EVENT_BATCH_INTERVAL = 10;
 export const SEARCH_DEBOUNCE_DELAY = 300; // Delay in ms for search debounce
 
+// Cluster conditions state, kept in sync from snapshot and delta messages
+let clusterConditions = {};
+let conditionsSeq = 0;
+let conditionsSnapshotReceived = false;
+
+// Applies a clusterConditions snapshot or clusterConditionsDelta message to the local state.
+// Returns the full conditions map to render, or null if the message was already applied.
+export function applyConditionsMessage(data) {
+    if (data.type === "clusterConditions") {
+        // Snapshots come from the server's informer cache, so they are always at least as fresh as our deltas
+        clusterConditions = data.conditions || {};
+        conditionsSeq = Math.max(conditionsSeq, data.seq || 0);
+        conditionsSnapshotReceived = true;
+        return clusterConditions;
+    }
+
+    if (data.type !== "clusterConditionsDelta" || data.seq <= conditionsSeq) {
+        return null;
+    }
+
+    // A gap means we missed a delta for some other cluster - ask for a fresh snapshot
+    if (conditionsSnapshotReceived && data.seq !== conditionsSeq + 1) {
+        socket.send(JSON.stringify({ type: "conditionsSnapshot" }));
+    }
+    conditionsSeq = data.seq;
+
+    if (data.deleted) {
+        delete clusterConditions[data.cluster];
+    } else {
+        clusterConditions[data.cluster] = data.conditions || [];
+    }
+    return clusterConditions;
+}
+
 // Session ID generator utility
 export function generateSessionId() {
     return Date.now().toString() + window.crypto.getRandomValues(new Uint32Array(1))[0];
 }
 
+// Headers carrying the CSRF token the dashboard sets in the cod_csrf cookie, for requests that change state
+export function csrfHeaders() {
+    const match = document.cookie.match(/(?:^|; )cod_csrf=([^;]*)/);
+    return match ? { 'X-COD-CSRF-Token': match[1] } : {};
+}
+
+// Escapes text for safe insertion into innerHTML
+export function escapeHTML(value) {
+    return String(value)
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&#39;');
+}
+
+// Formats a byte count with binary units
+export function formatBytes(bytes) {
+    if (!bytes) return '0 B';
+    const units = ['B', 'KiB', 'MiB', 'GiB', 'TiB', 'PiB'];
+    const exponent = Math.min(Math.floor(Math.log(bytes) / Math.log(1024)), units.length - 1);
+    return `${(bytes / Math.pow(1024, exponent)).toFixed(exponent === 0 ? 0 : 1)} ${units[exponent]}`;
+}
+
 // Text highlighting utility
 export function highlightMatches(text, matches) {
     if (!matches || !text) return text;
@@ -97,7 +97,7 @@ export function getOverallTileColor(conditions) {
 }
 
 // Function to render cluster tiles
-export function renderClusterTiles(clusterConditions) {
+export function renderClusterTiles(clusterConditions, reconcileStatuses = {}, eventAnomalies = {}) {
   const container = document.getElementById('clusterTilesContainer');
   if (!container || !clusterConditions) return;
   
@@ -124,6 +124,26 @@ export function renderClusterTiles(clusterConditions) {
     const titleEl = document.createElement('h3');
     titleEl.textContent = clusterName;
     tile.appendChild(titleEl);
+
+    // Flag clusters the operator has not reconciled
+    const reconcileStatus = reconcileStatuses[clusterName];
+    if (reconcileStatus && reconcileStatus.state !== 'Reconciled') {
+      const badge = document.createElement('span');
+      badge.className = `reconcile-badge reconcile-${reconcileStatus.state.toLowerCase()}`;
+      badge.textContent = reconcileStatus.state === 'Stuck' ? 'Reconcile stuck' : reconcileStatus.state;
+      badge.title = reconcileStatus.reason || '';
+      tile.appendChild(badge);
+    }
+
+    // Flag clusters whose events are storming
+    const anomaly = eventAnomalies[clusterName];
+    if (anomaly && anomaly.anomalous) {
+      const badge = document.createElement('span');
+      badge.className = 'reconcile-badge event-anomaly-badge';
+      badge.textContent = 'Event storm';
+      badge.title = `${anomaly.activeStorms} active storms, ${anomaly.ratePerMinute} events in the last minute (baseline ${anomaly.baselinePerMinute.toFixed(1)}/min)`;
+      tile.appendChild(badge);
+    }
     
     const conditionsList = document.createElement('ul');
     conditionsList.className = 'conditions-list';
@@ -168,4 +188,139 @@ export function renderClusterTiles(clusterConditions) {
     tile.appendChild(conditionsList);
     container.appendChild(tile);
   });
-} 
\ No newline at end of file
+} 
+// Renders the pending and firing alerts, most severe first.
+// onSilence(alert, duration) is called when a silence button is clicked.
+export function renderAlerts(alerts, onSilence) {
+  const container = document.getElementById('alertsContainer');
+  if (!container) return;
+
+  container.innerHTML = '';
+  if (alerts.length === 0) {
+    const empty = document.createElement('div');
+    empty.className = 'no-alerts';
+    empty.textContent = 'No active alerts';
+    container.appendChild(empty);
+    return;
+  }
+
+  const severityOrder = { 'critical': 1, 'warning': 2, 'info': 3 };
+  const sortedAlerts = [...alerts].sort((a, b) => {
+    if (a.state !== b.state) return a.state === 'firing' ? -1 : 1;
+    return (severityOrder[a.severity] || 4) - (severityOrder[b.severity] || 4);
+  });
+
+  sortedAlerts.forEach(alert => {
+    const item = document.createElement('div');
+    item.className = `alert-item alert-${alert.severity} alert-${alert.state}`;
+
+    const header = document.createElement('div');
+    header.className = 'alert-header';
+
+    const title = document.createElement('span');
+    title.className = 'alert-title';
+    title.textContent = `${alert.rule} · ${alert.cluster}`;
+    header.appendChild(title);
+
+    const badge = document.createElement('span');
+    badge.className = 'alert-badge';
+    badge.textContent = alert.silenced ? 'silenced' : alert.state;
+    header.appendChild(badge);
+
+    if (alert.state === 'firing' && !alert.silenced) {
+      const silenceButton = document.createElement('button');
+      silenceButton.className = 'secondary-button';
+      silenceButton.textContent = 'Silence 1h';
+      silenceButton.addEventListener('click', () => onSilence(alert, '1h'));
+      header.appendChild(silenceButton);
+    }
+
+    const summary = document.createElement('div');
+    summary.className = 'alert-summary';
+    summary.textContent = alert.summary;
+
+    const since = document.createElement('div');
+    since.className = 'alert-since';
+    since.textContent = `Active since ${new Date(alert.activeSince).toLocaleString()}`;
+
+    item.appendChild(header);
+    item.appendChild(summary);
+    item.appendChild(since);
+    container.appendChild(item);
+  });
+}
+
+// Renders the fleet health ranking, least healthy cluster first, with every deduction
+// behind the score so it can be audited.
+export function renderFleetHealth(fleet) {
+  const container = document.getElementById('fleetHealthContainer');
+  if (!container) return;
+
+  container.innerHTML = '';
+  if (fleet.length === 0) {
+    const empty = document.createElement('div');
+    empty.className = 'no-alerts';
+    empty.textContent = 'No clusters evaluated yet';
+    container.appendChild(empty);
+    return;
+  }
+
+  const counts = {};
+  fleet.forEach(summary => { counts[summary.status] = (counts[summary.status] || 0) + 1; });
+  const totals = document.createElement('div');
+  totals.className = 'fleet-health-totals';
+  ['Critical', 'Degraded', 'Healthy'].forEach(status => {
+    const total = document.createElement('span');
+    total.className = `health-badge health-${status.toLowerCase()}`;
+    total.textContent = `${counts[status] || 0} ${status}`;
+    totals.appendChild(total);
+  });
+  container.appendChild(totals);
+
+  const table = document.createElement('table');
+  table.className = 'fleet-health-table';
+  const headerRow = table.createTHead().insertRow();
+  ['#', 'Cluster', 'Score', 'Pods ready', 'Warnings', 'Deductions'].forEach(label => {
+    const th = document.createElement('th');
+    th.textContent = label;
+    headerRow.appendChild(th);
+  });
+
+  const body = table.createTBody();
+  fleet.forEach(summary => {
+    const row = body.insertRow();
+    row.insertCell().textContent = summary.rank;
+
+    const link = document.createElement('a');
+    link.href = `/cluster/${encodeURIComponent(summary.cluster)}`;
+    link.target = '_blank';
+    link.textContent = summary.cluster;
+    row.insertCell().appendChild(link);
+
+    const score = document.createElement('span');
+    score.className = `health-badge health-${summary.status.toLowerCase()}`;
+    score.textContent = summary.score;
+    score.title = summary.status;
+    row.insertCell().appendChild(score);
+
+    row.insertCell().textContent = `${summary.podsReady}/${summary.podsTotal}`;
+    row.insertCell().textContent = summary.warningEvents;
+
+    const deductionsCell = row.insertCell();
+    if (summary.deductions.length === 0) {
+      deductionsCell.textContent = 'None';
+      deductionsCell.className = 'fleet-health-none';
+    } else {
+      const list = document.createElement('ul');
+      list.className = 'fleet-health-deductions';
+      summary.deductions.forEach(deduction => {
+        const item = document.createElement('li');
+        item.textContent = `−${deduction.points} ${deduction.signal}: ${deduction.reason}`;
+        list.appendChild(item);
+      });
+      deductionsCell.appendChild(list);
+    }
+  });
+
+  container.appendChild(table);
+}
@@ -1,6 +1,6 @@
 // ==================== IMPORTS ======================
-import { socket, LOG_BATCH_INTERVAL, EVENT_BATCH_INTERVAL, SEARCH_DEBOUNCE_DELAY, generateSessionId, highlightMatches } from './core.js';
-import { renderClusterTiles } from './dashboard.js';
+import { socket, LOG_BATCH_INTERVAL, EVENT_BATCH_INTERVAL, SEARCH_DEBOUNCE_DELAY, generateSessionId, highlightMatches, applyConditionsMessage, csrfHeaders } from './core.js';
+import { renderClusterTiles, renderAlerts, renderFleetHealth } from './dashboard.js';
 
 // ==================== GLOBALS ======================
 let currentLogSessionId = null;
@@ -9,6 +9,11 @@ let logFragment = null;
 let batchTimeoutId = null;
 let eventFragments = {}; // Map to store event fragments by cluster name
 let eventBatchTimeoutId = null;
+let stormEntries = {}; // Event storm feed entries by storm ID, updated in place
+let latestConditions = {}; // Last rendered cluster conditions
+let reconcileStatuses = {}; // Reconcile status per cluster
+let eventAnomalies = {}; // Event storm anomaly state per cluster
+let activeAlerts = {}; // Pending and firing alerts by key
 
 // Search data storage
 let eventsFuse = null;
@@ -25,6 +30,12 @@ document.addEventListener('DOMContentLoaded', () => {
     
     // Set up WebSocket event handler
     socket.onmessage = handleWebSocketMessage;
+
+    // Load current reconcile statuses; later changes arrive over the WebSocket
+    loadReconcileStatuses();
+    loadAlerts();
+    loadFleetHealth();
+    loadEventAnomalies();
     
     // Initialize page-specific logic
     const hash = window.location.hash.substring(1);
@@ -317,11 +328,120 @@ function handleWebSocketMessage(event) {
         return;
     }
     
-    if (data.type === "clusterConditions") {
-        console.log("conditions triggered")
-        renderClusterTiles(data.conditions);
+    if (data.type === "clusterConditions" || data.type === "clusterConditionsDelta") {
+        const conditions = applyConditionsMessage(data);
+        if (conditions) {
+            latestConditions = conditions;
+            renderClusterTiles(latestConditions, reconcileStatuses, eventAnomalies);
+        }
+        return;
+    }
+
+    if (data.type === "reconcileStatus") {
+        reconcileStatuses[data.cluster] = data.status;
+        renderClusterTiles(latestConditions, reconcileStatuses, eventAnomalies);
+        return;
+    }
+
+    if (data.type === "eventAnomaly") {
+        eventAnomalies[data.cluster] = data.anomaly;
+        renderClusterTiles(latestConditions, reconcileStatuses, eventAnomalies);
+        return;
+    }
+
+    if (data.type === "fleetHealth") {
+        renderFleetHealth(data.fleet);
         return;
     }
+
+    if (data.type === "alert") {
+        if (data.alert.state === 'resolved') {
+            delete activeAlerts[data.alert.key];
+        } else {
+            activeAlerts[data.alert.key] = data.alert;
+        }
+        renderAlerts(Object.values(activeAlerts), silenceAlert);
+        return;
+    }
+}
+
+async function loadReconcileStatuses() {
+    try {
+        const response = await fetch('/api/reconcile');
+        if (!response.ok) {
+            throw new Error(`Error fetching reconcile statuses: ${response.status}`);
+        }
+        const statuses = await response.json();
+        statuses.forEach(status => {
+            reconcileStatuses[status.cluster] = status;
+        });
+        renderClusterTiles(latestConditions, reconcileStatuses, eventAnomalies);
+    } catch (error) {
+        console.error('Failed to load reconcile statuses:', error);
+    }
+}
+
+async function loadEventAnomalies() {
+    try {
+        const response = await fetch('/api/events/anomalies');
+        if (!response.ok) {
+            throw new Error(`Error fetching event anomalies: ${response.status}`);
+        }
+        const anomalies = await response.json();
+        anomalies.forEach(anomaly => {
+            eventAnomalies[anomaly.cluster] = anomaly;
+        });
+        renderClusterTiles(latestConditions, reconcileStatuses, eventAnomalies);
+    } catch (error) {
+        console.error('Failed to load event anomalies:', error);
+    }
+}
+
+async function loadFleetHealth() {
+    try {
+        const response = await fetch('/api/health');
+        if (!response.ok) {
+            throw new Error(`Error fetching fleet health: ${response.status}`);
+        }
+        renderFleetHealth(await response.json());
+    } catch (error) {
+        console.error('Failed to load fleet health:', error);
+    }
+}
+
+async function loadAlerts() {
+    try {
+        const response = await fetch('/api/alerts');
+        if (!response.ok) {
+            throw new Error(`Error fetching alerts: ${response.status}`);
+        }
+        const state = await response.json();
+        activeAlerts = {};
+        state.alerts.forEach(alert => {
+            activeAlerts[alert.key] = alert;
+        });
+        renderAlerts(Object.values(activeAlerts), silenceAlert);
+    } catch (error) {
+        console.error('Failed to load alerts:', error);
+    }
+}
+
+async function silenceAlert(alert, duration) {
+    try {
+        const response = await fetch('/api/alerts/silences', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', ...csrfHeaders() },
+            body: JSON.stringify({ rule: alert.rule, cluster: alert.cluster, duration: duration, comment: 'Silenced from the dashboard' })
+        });
+        if (!response.ok) {
+            throw new Error(`Error creating silence: ${response.status}`);
+        }
+        // Silencing is applied on the next evaluation; reflect it right away
+        activeAlerts[alert.key] = { ...alert, silenced: true };
+        renderAlerts(Object.values(activeAlerts), silenceAlert);
+    } catch (error) {
+        console.error('Failed to silence alert:', error);
+    }
 }
 
 // ==================== SEARCH FUNCTIONS ====================
@@ -470,6 +590,14 @@ function updateClusterContainer(containerId, checkboxClass, clusters, changeHand
 }
 
 function updateEvents(eventData) {
+    // Storm summaries are updated in place rather than appended
+    const stormEntry = eventData.kind === 'EventStorm' && stormEntries[eventData.name];
+    if (stormEntry && stormEntry.parentNode) {
+        stormEntry.querySelector('.event-message').textContent = eventData.message;
+        stormEntry.classList.toggle('event-storm-ended', !eventData.data.active);
+        return;
+    }
+
     // Add the event data directly to Fuse index
     if (eventsFuse) {
         eventsFuse.add(eventData);
@@ -545,6 +673,11 @@ function updateEvents(eventData) {
         </div>
         <div class="event-message">${eventData.message}</div>
     `;
+    if (eventData.kind === 'EventStorm') {
+        eventEntry.classList.add('event-storm');
+        eventEntry.classList.toggle('event-storm-ended', !eventData.data.active);
+        stormEntries[eventData.name] = eventEntry;
+    }
     
     // Add to the fragment for this cluster
     eventFragments[eventData.clusterName].appendChild(eventEntry);
@@ -3,6 +3,9 @@ document.addEventListener('DOMContentLoaded', () => {
     // Initialize filter functionality
     setupMetricsFiltering();
     
+    // Offer longer history ranges when an external Prometheus is configured
+    setupHistoryRange();
+    
     // Initialize metrics if URL hash is #metrics
     if (window.location.hash === '#metrics') {
         startMetricsRefresh();
@@ -18,11 +21,16 @@ let currentMetricsData = []; // Store the current metrics data
 const METRICS_SEARCH_DEBOUNCE_DELAY = 300; // Delay in ms for search debounce
 let metricsSearchTimeout = null;
 const metricCardsCache = new Map(); // Cache to store metric cards by metric name
+const historyCharts = new Map(); // Open history charts by metric name
+let historyRange = '1h'; // Time range shown in history charts
+let prometheusEnabled = false; // History comes from an external Prometheus rather than the sidecar
+const RATE_WINDOW = '2m'; // Window used to compute counter rates
+const DISTRIBUTION_WINDOW = '5m'; // Window of the histogram and summary stats
 
 // Cache DOM references
 const DOM = {
     metricsGrid: () => document.querySelector('.metrics-grid'),
-    chartsContainer: () => document.querySelector('.charts-container'),
+    chartsContainer: () => document.querySelector('.metrics-charts'),
     metricsHeader: () => document.querySelector('.metrics-dashboard .metrics-header'),
     refreshIndicator: () => document.getElementById('refreshIndicator'),
     refreshDot: () => document.querySelector('.refresh-dot'),
@@ -123,6 +131,9 @@ async function fetchAndDisplayMetrics() {
         // Process and organize metrics
         const organizedMetrics = organizeMetrics(metricsData);
         
+        // Keep open history charts current
+        refreshHistoryCharts();
+        
         // Initialize fuzzy search
         initializeMetricsFuse(organizedMetrics);
         
@@ -135,8 +146,8 @@ async function fetchAndDisplayMetrics() {
             // Otherwise render metrics as usual
             renderMetricCards(organizedMetrics.simpleMetrics);
             
-            // Add placeholders for histograms and summaries
-            renderHistogramSummaryPlaceholders();
+            // Render histogram and summary stats
+            renderDistributions();
             
             // Apply any active type filters
             const typeSelect = DOM.metricsType();
@@ -150,30 +161,109 @@ async function fetchAndDisplayMetrics() {
     }
 }
 
-// Add placeholders for histograms and summaries
-function renderHistogramSummaryPlaceholders() {
+// Render the server-computed stats of histogram and summary families, optionally only those matching a search
+async function renderDistributions(query) {
     const chartsContainer = DOM.chartsContainer();
     if (!chartsContainer) return;
     
-    // Clear existing content
+    let distributions;
+    try {
+        const response = await fetch(`/api/metrics/distributions?window=${DISTRIBUTION_WINDOW}`);
+        if (!response.ok) {
+            throw new Error(`Error fetching distributions: ${response.status}`);
+        }
+        distributions = (await response.json()).distributions || [];
+    } catch (error) {
+        console.error('Failed to load histograms and summaries:', error);
+        return;
+    }
+    
+    if (query) {
+        const needle = query.toLowerCase();
+        distributions = distributions.filter(d => d.name.toLowerCase().includes(needle));
+    }
+    
     chartsContainer.innerHTML = '';
+    distributions.forEach(distribution => chartsContainer.appendChild(createDistributionCard(distribution)));
     
-    // Add placeholders
-    const histogramPlaceholder = document.createElement('div');
-    histogramPlaceholder.className = 'coming-soon-container';
-    histogramPlaceholder.innerHTML = `
-        <h3 class="coming-soon-title">Histograms</h3>
-        <p class="coming-soon-description">Histogram visualizations will be available in a future update.</p>
-    `;
-    chartsContainer.appendChild(histogramPlaceholder);
+    const typeSelect = DOM.metricsType();
+    if (typeSelect && typeSelect.value !== 'all') {
+        filterMetrics();
+    }
+}
+
+// Create a card listing the count, average and quantiles of each series of a histogram or summary
+function createDistributionCard(distribution) {
+    const card = document.createElement('div');
+    card.className = `metric-card distribution-card ${distribution.type}-card`;
+    card.setAttribute('data-metric-type', distribution.type);
+    card.setAttribute('data-metric-name', distribution.name);
+    
+    const metricHeader = document.createElement('div');
+    metricHeader.className = 'metric-header';
+    const metricTitle = document.createElement('h3');
+    metricTitle.className = 'metric-name';
+    metricTitle.textContent = distribution.name;
+    const metricType = document.createElement('span');
+    metricType.className = `metric-type ${distribution.type}`;
+    metricType.textContent = distribution.type.toUpperCase();
+    metricHeader.appendChild(metricTitle);
+    metricHeader.appendChild(metricType);
+    card.appendChild(metricHeader);
     
-    const summaryPlaceholder = document.createElement('div');
-    summaryPlaceholder.className = 'coming-soon-container';
-    summaryPlaceholder.innerHTML = `
-        <h3 class="coming-soon-title">Summaries</h3>
-        <p class="coming-soon-description">Summary visualizations will be available in a future update.</p>
+    if (distribution.help) {
+        const helpText = document.createElement('div');
+        helpText.className = 'metric-help';
+        helpText.textContent = distribution.help;
+        card.appendChild(helpText);
+    }
+    
+    const table = document.createElement('table');
+    table.className = 'distribution-table';
+    table.innerHTML = `
+        <thead>
+            <tr><th rowspan="2">Series</th><th colspan="5">Since start</th><th colspan="5">Last ${DISTRIBUTION_WINDOW}</th></tr>
+            <tr><th>Count</th><th>Avg</th><th>p50</th><th>p90</th><th>p99</th><th>Rate</th><th>Avg</th><th>p50</th><th>p90</th><th>p99</th></tr>
+        </thead>
     `;
-    chartsContainer.appendChild(summaryPlaceholder);
+    const body = document.createElement('tbody');
+    distribution.series.forEach(series => {
+        const current = series.current;
+        const window = series.window;
+        const cells = [
+            generateEntryId(series.labels) || '-',
+            formatNumber(current.count),
+            formatDistributionValue(current.average),
+            ...quantileValues(current),
+            window && window.rate !== null ? `${formatNumber(window.rate, 2)}/s` : '-',
+            formatDistributionValue(window ? window.average : null),
+            ...quantileValues(window)
+        ];
+        const row = document.createElement('tr');
+        cells.forEach((text, i) => {
+            const cell = document.createElement('td');
+            if (i === 0) cell.className = 'distribution-labels';
+            cell.textContent = text;
+            row.appendChild(cell);
+        });
+        body.appendChild(row);
+    });
+    table.appendChild(body);
+    card.appendChild(table);
+    
+    return card;
+}
+
+// The p50, p90 and p99 of distribution stats, or dashes where unavailable
+function quantileValues(stats) {
+    return [0.5, 0.9, 0.99].map(q => {
+        const match = ((stats && stats.quantiles) || []).find(entry => entry.quantile === q);
+        return formatDistributionValue(match ? match.value : null);
+    });
+}
+
+function formatDistributionValue(value) {
+    return value === null || value === undefined ? '-' : formatNumber(value, 3);
 }
 
 // Search metrics using Fuse.js
@@ -196,8 +286,7 @@ function searchMetrics(query) {
     // Render the filtered results
     if (Object.keys(simpleMetrics).length > 0) {
         renderMetricCards(simpleMetrics);
-        // Add placeholders
-        renderHistogramSummaryPlaceholders();
+        renderDistributions(query);
     } else {
         // Show no results message
         DOM.metricsGrid().innerHTML = '<div class="no-results">No matching metrics found</div>';
@@ -398,9 +487,150 @@ function createMetricCard(metric) {
     
     card.appendChild(valuesContainer);
     
+    // History chart, loaded on demand from the server-side metrics history
+    const historyToggle = document.createElement('button');
+    historyToggle.className = 'metric-history-toggle';
+    historyToggle.textContent = 'Show history';
+    historyToggle.addEventListener('click', () => toggleMetricHistory(card, metric));
+    card.appendChild(historyToggle);
+    
     return card;
 }
 
+// Show or hide the history chart of a metric card
+function toggleMetricHistory(card, metric) {
+    const toggle = card.querySelector('.metric-history-toggle');
+    const existing = card.querySelector('.metric-history');
+    
+    if (existing) {
+        const chart = historyCharts.get(metric.name);
+        if (chart) chart.destroy();
+        historyCharts.delete(metric.name);
+        existing.remove();
+        card.classList.remove('with-history');
+        toggle.textContent = 'Show history';
+        return;
+    }
+    
+    const historyContainer = document.createElement('div');
+    historyContainer.className = 'metric-history';
+    const canvas = document.createElement('canvas');
+    historyContainer.appendChild(canvas);
+    card.insertBefore(historyContainer, toggle);
+    card.classList.add('with-history');
+    toggle.textContent = 'Hide history';
+    
+    loadMetricHistory(metric, canvas);
+}
+
+// Fetch a metric's history and draw it; counters are shown as per-second rates
+async function loadMetricHistory(metric, canvas) {
+    const fn = metric.type === 'COUNTER' ? 'rate' : 'raw';
+    const params = new URLSearchParams({ metric: metric.name, fn: fn, range: historyRange, window: RATE_WINDOW });
+    
+    try {
+        const response = await fetch(`/api/metrics/range?${params}`);
+        if (!response.ok) {
+            throw new Error(`Error fetching metric history: ${response.status}`);
+        }
+        const series = await response.json();
+        
+        const datasets = (series || []).map(s => ({
+            label: generateEntryId(s.labels),
+            data: s.points.map(p => ({ x: p.t, y: p.v })),
+            borderWidth: 1.5,
+            pointRadius: 0,
+            tension: 0.2
+        }));
+        
+        const existing = historyCharts.get(metric.name);
+        if (existing && existing.canvas === canvas) {
+            existing.data.datasets = datasets;
+            existing.update('none');
+            return;
+        }
+        
+        historyCharts.set(metric.name, new Chart(canvas, {
+            type: 'line',
+            data: { datasets: datasets },
+            options: {
+                animation: false,
+                maintainAspectRatio: false,
+                parsing: false,
+                plugins: {
+                    legend: { display: datasets.length > 1, labels: { boxWidth: 10, font: { size: 10 } } },
+                    title: { display: true, text: `${fn === 'rate' ? `per-second rate (${RATE_WINDOW} window)` : 'value'}${prometheusEnabled ? ' · Prometheus' : ''}`, font: { size: 11 } }
+                },
+                scales: {
+                    x: {
+                        type: 'linear',
+                        ticks: {
+                            maxTicksLimit: 6,
+                            callback: value => formatHistoryTick(value)
+                        }
+                    },
+                    y: { beginAtZero: true }
+                }
+            }
+        }));
+    } catch (error) {
+        console.error('Failed to load metric history:', error);
+        canvas.parentElement.textContent = 'History unavailable';
+    }
+}
+
+// Label chart ticks with the time, and the date for ranges over a day
+function formatHistoryTick(value) {
+    const date = new Date(value);
+    if (['1h', '6h', '24h'].includes(historyRange)) {
+        return date.toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+    }
+    return date.toLocaleDateString([], { month: 'short', day: 'numeric' });
+}
+
+// Populate the history range selector, adding long ranges served by Prometheus
+async function setupHistoryRange() {
+    const rangeSelect = document.getElementById('metricsHistoryRange');
+    if (!rangeSelect) return;
+    
+    rangeSelect.addEventListener('change', () => {
+        historyRange = rangeSelect.value;
+        refreshHistoryCharts();
+    });
+    
+    try {
+        const response = await fetch('/api/prometheus');
+        if (!response.ok) return;
+        const status = await response.json();
+        prometheusEnabled = status.enabled;
+    } catch (error) {
+        console.error('Failed to check the Prometheus integration:', error);
+        return;
+    }
+    
+    if (prometheusEnabled) {
+        [['24h', 'Last 24 hours'], ['168h', 'Last 7 days'], ['720h', 'Last 30 days']].forEach(([value, label]) => {
+            const option = document.createElement('option');
+            option.value = value;
+            option.textContent = label;
+            rangeSelect.appendChild(option);
+        });
+    }
+}
+
+// Reload the data of every open history chart
+function refreshHistoryCharts() {
+    for (const [metricName, chart] of historyCharts.entries()) {
+        const card = metricCardsCache.get(metricName);
+        if (!card) {
+            chart.destroy();
+            historyCharts.delete(metricName);
+            continue;
+        }
+        loadMetricHistory({ name: metricName, type: card.getAttribute('data-metric-type').toUpperCase() }, chart.canvas);
+    }
+}
+
 // Create an entry for a single metric value with its labels
 function createMetricValueEntry(valueObj) {
     const entry = document.createElement('div');
@@ -629,27 +859,15 @@ function filterMetrics() {
     
     // If "all" is selected, show everything
     if (filterType === 'all') {
-        document.querySelectorAll('.metric-card, .coming-soon-container').forEach(el => {
-            el.style.display = 'block';
+        document.querySelectorAll('.metric-card').forEach(el => {
+            el.style.display = '';
         });
         return;
     }
     
-    // Filter metric cards
+    // Filter metric, histogram and summary cards
     document.querySelectorAll('.metric-card').forEach(card => {
         const cardType = card.getAttribute('data-metric-type');
-        card.style.display = cardType === filterType ? 'block' : 'none';
-    });
-    
-    // Show or hide placeholders based on filter
-    document.querySelectorAll('.coming-soon-container').forEach(container => {
-        const title = container.querySelector('.coming-soon-title').textContent;
-        
-        if ((title === 'Histograms' && filterType === 'histogram') || 
-            (title === 'Summaries' && filterType === 'summary')) {
-            container.style.display = 'block';
-        } else {
-            container.style.display = 'none';
-        }
+        card.style.display = cardType === filterType ? '' : 'none';
     });
-} 
\ No newline at end of file
+}
\ No newline at end of file
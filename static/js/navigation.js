@@ -149,6 +149,11 @@ function showPage(pageId) {
     if (typeof stopMetricsRefresh === 'function') {
         stopMetricsRefresh();
     }
+    
+    // Load the audit entries each time the audit page is shown
+    if (pageId === 'audit' && typeof loadAuditEntries === 'function') {
+        loadAuditEntries();
+    }
 }
 
 // Update the active state in the navigation